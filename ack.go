@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AckSender layers at-least-once delivery on any Sender: a message only
+// counts as delivered once an attempt is acknowledged (Send returns nil),
+// and an attempt that isn't acked within AckTimeout is retried while the
+// slow one keeps going. When the slow attempt lands too, the server has
+// received the message twice; those are counted as duplicates.
+type AckSender struct {
+	Next       Sender
+	AckTimeout time.Duration
+	MaxRetries int
+
+	stragglers sync.WaitGroup // attempts still running after Send returned
+
+	unique      uint64 // messages acked at least once
+	duplicated  uint64 // messages acked more than once
+	deliveries  uint64 // successful attempts, including duplicates
+	retries     uint64
+	gaveUp      uint64
+	unacked     int64
+	unackedPeak int64
+}
+
+func NewAckSender(next Sender, ackTimeout time.Duration, maxRetries int) *AckSender {
+	return &AckSender{Next: next, AckTimeout: ackTimeout, MaxRetries: maxRetries}
+}
+
+func (a *AckSender) Send(ctx context.Context, msg Message) error {
+	a.trackUnacked(1)
+	defer a.trackUnacked(-1)
+
+	// buffered for every possible attempt so late results never block
+	results := make(chan error, a.MaxRetries+1)
+	acked := atomic.Bool{}
+	var landed atomic.Int32
+	attempt := func() {
+		defer a.stragglers.Done()
+		// Attempts outlive Send on purpose, so they don't use its context.
+		err := a.Next.Send(context.WithoutCancel(ctx), msg)
+		if err == nil {
+			atomic.AddUint64(&a.deliveries, 1)
+			if acked.CompareAndSwap(false, true) {
+				atomic.AddUint64(&a.unique, 1)
+			}
+			if landed.Add(1) == 2 {
+				atomic.AddUint64(&a.duplicated, 1)
+			}
+		}
+		results <- err
+	}
+
+	var lastErr error
+	for try := 0; try <= a.MaxRetries; try++ {
+		if try > 0 {
+			atomic.AddUint64(&a.retries, 1)
+		}
+		a.stragglers.Add(1)
+		go attempt()
+
+		timer := time.NewTimer(a.AckTimeout)
+		select {
+		case err := <-results:
+			timer.Stop()
+			if err == nil {
+				return nil
+			}
+			lastErr = err
+		case <-timer.C:
+			lastErr = fmt.Errorf("no ack within %v", a.AckTimeout)
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+		if acked.Load() {
+			return nil // an earlier, slower attempt got acked meanwhile
+		}
+	}
+	atomic.AddUint64(&a.gaveUp, 1)
+	return lastErr
+}
+
+func (a *AckSender) trackUnacked(delta int64) {
+	n := atomic.AddInt64(&a.unacked, delta)
+	for {
+		peak := atomic.LoadInt64(&a.unackedPeak)
+		if n <= peak || atomic.CompareAndSwapInt64(&a.unackedPeak, peak, n) {
+			return
+		}
+	}
+}
+
+// Close waits for abandoned attempts to finish so their duplicates are
+// counted, then closes the underlying sender.
+func (a *AckSender) Close() error {
+	a.stragglers.Wait()
+	return a.Next.Close()
+}
+
+func (a *AckSender) printSummary() {
+	unique := atomic.LoadUint64(&a.unique)
+	dups := atomic.LoadUint64(&a.deliveries) - unique
+	fmt.Printf("   At-least-once: %d acked | %d duplicates (%.2f%%) | %d ack retries | %d gave up | peak un-acked %d\n",
+		unique, dups, pct(dups, unique), atomic.LoadUint64(&a.retries),
+		atomic.LoadUint64(&a.gaveUp), atomic.LoadInt64(&a.unackedPeak))
+}
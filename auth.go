@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// bearerTokenEnv is read for the token when -bearer-token isn't given, so
+// it stays out of shell history and process listings.
+const bearerTokenEnv = "SOLAR_BEARER_TOKEN"
+
+// headerFlag is the repeatable -header "Key: Value", added to every
+// request. Repeating a key sends it more than once.
+type headerFlag struct{ h http.Header }
+
+func (f *headerFlag) String() string {
+	var names []string
+	for k := range f.h {
+		names = append(names, k)
+	}
+	return strings.Join(names, ", ")
+}
+
+func (f *headerFlag) Set(v string) error {
+	k, val, ok := strings.Cut(v, ":")
+	k = strings.TrimSpace(k)
+	if !ok || k == "" || strings.ContainsAny(k, " \t") {
+		return fmt.Errorf("want \"Key: Value\", got %q", v)
+	}
+	switch http.CanonicalHeaderKey(k) {
+	case "Content-Type", "Content-Encoding", "Content-Length", "Host":
+		return fmt.Errorf("%s is set per request; use its own flag", k)
+	}
+	if f.h == nil {
+		f.h = http.Header{}
+	}
+	f.h.Add(k, strings.TrimSpace(val))
+	return nil
+}
+
+// applyAuth merges the -header values and the bearer token into header.
+// The token comes from -bearer-token, else from $SOLAR_BEARER_TOKEN.
+func applyAuth(header http.Header, extra headerFlag, token string) {
+	for k, vs := range extra.h {
+		for _, v := range vs {
+			header.Add(k, v)
+		}
+	}
+	if token == "" {
+		token = os.Getenv(bearerTokenEnv)
+	}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+}
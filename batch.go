@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// batcher groups concurrent Sends so they go out together. Each caller
+// blocks until its batch has run and gets the batch's result. A batch runs
+// when it is full or linger after its first body, whichever comes first, so
+// a pool with fewer workers than the batch size still makes progress.
+type batcher struct {
+	mu  sync.Mutex
+	cur *pendingBatch
+}
+
+type pendingBatch struct {
+	bodies [][]byte
+	run    func(bodies [][]byte) error
+	timer  *time.Timer
+	done   chan struct{}
+	err    error
+}
+
+// add puts body in the open batch, starting one if needed, and waits for it.
+func (q *batcher) add(ctx context.Context, body []byte, size int, linger time.Duration, run func([][]byte) error) error {
+	q.mu.Lock()
+	b := q.cur
+	if b == nil {
+		b = &pendingBatch{run: run, done: make(chan struct{})}
+		b.timer = time.AfterFunc(linger, func() { q.flush(b) })
+		q.cur = b
+	}
+	b.bodies = append(b.bodies, body)
+	full := len(b.bodies) >= size
+	q.mu.Unlock()
+	if full {
+		q.flush(b)
+	}
+
+	select {
+	case <-b.done:
+		return b.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// flush detaches b, if it is still the open batch, and runs it. Whoever
+// detaches it (a full add or the linger timer) runs it, exactly once.
+func (q *batcher) flush(b *pendingBatch) {
+	q.mu.Lock()
+	if q.cur != b {
+		q.mu.Unlock()
+		return
+	}
+	q.cur = nil
+	q.mu.Unlock()
+	b.timer.Stop()
+	b.err = b.run(b.bodies)
+	close(b.done)
+}
+
+// flushOpen runs the partial batch, if there is one.
+func (q *batcher) flushOpen() {
+	q.mu.Lock()
+	b := q.cur
+	q.mu.Unlock()
+	if b != nil {
+		q.flush(b)
+	}
+}
+
+// jsonArray joins JSON bodies into one array.
+func jsonArray(bodies [][]byte) []byte {
+	return append(append([]byte("["), bytes.Join(bodies, []byte(","))...), ']')
+}
+
+// BatchSender delivers records in bulk (-batch): up to Size records, across
+// formats, are POSTed to Next as one JSON array. Every record in a batch
+// shares its outcome, so Sent and Failed still count records, not batches.
+type BatchSender struct {
+	Next   Sender
+	Size   int
+	Linger time.Duration
+
+	pending batcher
+	hist    Histogram
+
+	batches, failedBatches, records uint64
+}
+
+func (s *BatchSender) Send(ctx context.Context, msg Message) error {
+	return s.pending.add(ctx, msg.Body, s.Size, s.Linger, s.run)
+}
+
+func (s *BatchSender) run(bodies [][]byte) error {
+	atomic.AddUint64(&s.batches, 1)
+	atomic.AddUint64(&s.records, uint64(len(bodies)))
+	start := time.Now()
+	err := s.Next.Send(requestCtx, Message{Body: jsonArray(bodies), ContentType: "application/json"})
+	s.hist.Record(time.Since(start))
+	if err != nil {
+		atomic.AddUint64(&s.failedBatches, 1)
+		return fmt.Errorf("batch of %d: %w", len(bodies), err)
+	}
+	return nil
+}
+
+// Target is where batches are sent.
+func (s *BatchSender) Target() string { return targetOf(s.Next) }
+
+// Close sends any partial batch, then closes Next.
+func (s *BatchSender) Close() error {
+	s.pending.flushOpen()
+	return s.Next.Close()
+}
+
+func (s *BatchSender) printSummary() {
+	batches, records := atomic.LoadUint64(&s.batches), atomic.LoadUint64(&s.records)
+	if batches == 0 {
+		return
+	}
+	fmt.Printf("   Batches: %d sent | %d failed | avg %.1f records each (max %d)\n",
+		batches, atomic.LoadUint64(&s.failedBatches), float64(records)/float64(batches), s.Size)
+	fmt.Printf("     batch latency: p50 %v | p90 %v | p99 %v | max %v\n",
+		s.hist.Quantile(0.50).Round(time.Microsecond), s.hist.Quantile(0.90).Round(time.Microsecond),
+		s.hist.Quantile(0.99).Round(time.Microsecond), s.hist.Max().Round(time.Microsecond))
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// BenchConfig is a -bench capacity search: the rate range to search, how
+// long each probe runs, what a passing probe must meet, and how many
+// independent searches to run.
+type BenchConfig struct {
+	Min, Max  int
+	Step      time.Duration
+	Cooldown  time.Duration
+	MaxError  float64       // highest passing error rate (0-1)
+	P99       time.Duration // highest passing p99
+	Reps      int
+	Tolerance float64 // stop once the bracket is this narrow, relative to its low end
+}
+
+// benchAchieved is how close to the offered rate a probe must get to pass;
+// a server that silently can't keep up fails even without errors.
+const benchAchieved = 0.95
+
+// BenchProbe is one rate tried during a search.
+type BenchProbe struct {
+	Rep  int  `json:"rep"`
+	Pass bool `json:"pass"`
+	SweepStep
+}
+
+// BenchResult is the outcome of a -bench run: each repetition's capacity
+// (0 when even Min failed) and their mean with a 95% confidence interval.
+type BenchResult struct {
+	Probes     []BenchProbe `json:"probes"`
+	Capacities []int        `json:"capacities"`
+	Mean       float64      `json:"mean"`
+	CI95       float64      `json:"ci95"` // half-width
+}
+
+func (c BenchConfig) passes(s SweepStep) bool {
+	return s.ErrorRate <= c.MaxError &&
+		s.P99Ms <= ms(c.P99) &&
+		s.ActualRate >= benchAchieved*float64(s.Rate)
+}
+
+// runBench binary-searches the highest passing rate in [Min, Max], once
+// per repetition. Each search starts from scratch so the repetitions are
+// independent samples of the server's capacity.
+func runBench(pool *workerPool, c BenchConfig) BenchResult {
+	var r BenchResult
+	probe := func(rep, rate int) bool {
+		if len(r.Probes) > 0 && c.Cooldown > 0 {
+			pause(c.Cooldown)
+		}
+		fmt.Printf("🎯 Bench %d/%d: probing %d/sec for %v\n", rep, c.Reps, rate, c.Step)
+		s := runStep(pool, rate, c.Step, nil)
+		p := BenchProbe{Rep: rep, Pass: c.passes(s), SweepStep: s}
+		r.Probes = append(r.Probes, p)
+		return p.Pass
+	}
+	for rep := 1; rep <= c.Reps && !stopReached(); rep++ {
+		lo, hi := 0, c.Max // lo passed (0 = nothing yet), hi is the lowest known failure or the cap
+		switch {
+		case !probe(rep, c.Min):
+			r.Capacities = append(r.Capacities, 0)
+			continue
+		case probe(rep, c.Max):
+			r.Capacities = append(r.Capacities, c.Max)
+			continue
+		}
+		lo = c.Min
+		for hi-lo > max(1, int(float64(lo)*c.Tolerance)) && !stopReached() {
+			mid := lo + (hi-lo)/2
+			if probe(rep, mid) {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		r.Capacities = append(r.Capacities, lo)
+	}
+	r.Mean, r.CI95 = meanCI95(r.Capacities)
+	return r
+}
+
+// meanCI95 returns the mean of xs and the half-width of its 95%
+// confidence interval, from Student's t for small samples.
+func meanCI95(xs []int) (mean, half float64) {
+	n := float64(len(xs))
+	if n == 0 {
+		return 0, 0
+	}
+	for _, x := range xs {
+		mean += float64(x)
+	}
+	mean /= n
+	if n < 2 {
+		return mean, 0
+	}
+	var ss float64
+	for _, x := range xs {
+		ss += (float64(x) - mean) * (float64(x) - mean)
+	}
+	sd := math.Sqrt(ss / (n - 1))
+	return mean, tCritical95(len(xs)-1) * sd / math.Sqrt(n)
+}
+
+// tCritical95 is the two-sided 95% critical value of Student's t.
+func tCritical95(df int) float64 {
+	table := []float64{12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228}
+	if df <= len(table) {
+		return table[df-1]
+	}
+	return 1.96
+}
+
+func printBench(r BenchResult, c BenchConfig) {
+	fmt.Println("\n🏁 Bench probes")
+	fmt.Printf("   %4s %8s %10s %7s %9s %5s\n", "rep", "rate", "actual/s", "err%", "p99ms", "pass")
+	for _, p := range r.Probes {
+		verdict := "no"
+		if p.Pass {
+			verdict = "yes"
+		}
+		fmt.Printf("   %4d %8d %10.2f %7.2f %9.1f %5s\n", p.Rep, p.Rate, p.ActualRate, p.ErrorRate*100, p.P99Ms, verdict)
+	}
+	fmt.Printf("   Criteria: error rate ≤ %.2f%% | p99 ≤ %v | ≥ %.0f%% of offered rate achieved\n",
+		c.MaxError*100, c.P99, benchAchieved*100)
+	fmt.Printf("   Capacity per repetition: %v\n", r.Capacities)
+	switch {
+	case len(r.Capacities) == 0:
+		fmt.Println("   Capacity: no repetition finished")
+	case r.Mean == 0:
+		fmt.Printf("   Capacity: below %d/sec (the lowest rate searched)\n", c.Min)
+	case len(r.Capacities) < 2:
+		fmt.Printf("   Capacity: ≈%.0f/sec (one repetition, no confidence interval)\n", r.Mean)
+	default:
+		fmt.Printf("   Capacity: %.0f/sec ± %.0f (95%% CI over %d repetitions)\n", r.Mean, r.CI95, len(r.Capacities))
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"sync/atomic"
+)
+
+// payloadChecksum adds a checksum field to every payload (-payload-checksum)
+// so the server, and -verify-echo, can detect corruption in transit.
+var payloadChecksum bool
+
+var checksumMismatches uint64
+
+// checksumField must not be a field of any format.
+const checksumField = "checksum"
+
+// canonicalCRC is the CRC-32 (IEEE), as 8 lowercase hex digits, of the
+// payload with its checksum field removed, re-encoded compactly with
+// object keys sorted at every level and numbers kept exactly as sent.
+// That is what the server must recompute.
+func canonicalCRC(m map[string]any) (string, error) {
+	stripped := make(map[string]any, len(m))
+	for k, v := range m {
+		if k != checksumField {
+			stripped[k] = v
+		}
+	}
+	b, err := json.Marshal(stripped) // maps marshal with sorted keys
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%08x", crc32.ChecksumIEEE(b)), nil
+}
+
+// addChecksum returns body with its checksum field set.
+func addChecksum(body []byte) ([]byte, error) {
+	var crcErr error
+	out, err := reencode(body, func(m map[string]any) {
+		var sum string
+		sum, crcErr = canonicalCRC(m)
+		m[checksumField] = sum
+	})
+	if err == nil {
+		err = crcErr
+	}
+	return out, err
+}
+
+// verifyChecksum reports whether an echoed body still matches the
+// checksum it carries.
+func verifyChecksum(echoed []byte) (bool, error) {
+	dec := json.NewDecoder(bytes.NewReader(echoed))
+	dec.UseNumber()
+	var m map[string]any
+	if err := dec.Decode(&m); err != nil {
+		return false, err
+	}
+	got, ok := m[checksumField].(string)
+	if !ok {
+		return false, nil
+	}
+	want, err := canonicalCRC(m)
+	if err != nil {
+		return false, err
+	}
+	if got != want {
+		atomic.AddUint64(&checksumMismatches, 1)
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// compareTransport is one entry of -protocol-compare. Kind is the sender
+// its scheme picks: http, mqtt, udp or ws. An mqtt entry's path, if any,
+// is the topic, and Addr is the broker without it; a udp entry's Addr is
+// its host:port.
+type compareTransport struct {
+	Name  string
+	URL   string
+	Kind  string
+	Addr  string
+	Topic string
+}
+
+// CompareResult is one transport's outcome in a -protocol-compare run.
+type CompareResult struct {
+	Transport string `json:"transport"`
+	SweepStep
+}
+
+// compareWorkloadMax caps the records generated up front for a
+// comparison; a longer step loops over them.
+const compareWorkloadMax = 200000
+
+// parseTransports parses "[name=]url,..." and picks each entry's sender
+// from its scheme.
+func parseTransports(s string) ([]compareTransport, error) {
+	var ts []compareTransport
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		t := compareTransport{Name: f, URL: f}
+		if name, u, ok := strings.Cut(f, "="); ok && !strings.Contains(name, "://") {
+			t = compareTransport{Name: name, URL: u}
+		}
+		u, err := url.Parse(t.URL)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", t.Name, err)
+		}
+		switch u.Scheme {
+		case "http", "https":
+			t.Kind = "http"
+		case "mqtt", "mqtts", "tcp", "ssl", "tls":
+			t.Kind = "mqtt"
+			t.Addr = u.Scheme + "://" + u.Host
+			t.Topic = strings.TrimPrefix(u.Path, "/")
+		case "udp":
+			t.Kind = "udp"
+			t.Addr = u.Host
+			if err := checkUDPAddr(u.Host); err != nil {
+				return nil, fmt.Errorf("%s: %w", t.Name, err)
+			}
+		case "ws", "wss":
+			t.Kind = "ws"
+		case "":
+			return nil, fmt.Errorf("%s: missing scheme", t.Name)
+		default:
+			return nil, fmt.Errorf("%s: no %s transport in this build (want http(s), mqtt(s), tcp, ssl, tls, udp or ws(s))", t.Name, u.Scheme)
+		}
+		if u.Host == "" {
+			return nil, fmt.Errorf("%s: missing host", t.Name)
+		}
+		ts = append(ts, t)
+	}
+	if len(ts) < 2 {
+		return nil, fmt.Errorf("need at least two transports to compare")
+	}
+	return ts, nil
+}
+
+// runCompare runs the same workload against each transport in turn, each
+// with its own worker pool. The records are generated once, up front and
+// from seed, so every transport is sent the same bytes: the same devices,
+// field values and timestamps, in the same order.
+func runCompare(transports []compareTransport, dial func(compareTransport) Sender, workers, rate int, step, cooldown time.Duration, seed int64) []CompareResult {
+	workload := compareWorkload(rate, step, seed)
+	var out []CompareResult
+	for i, t := range transports {
+		if stopReached() {
+			break
+		}
+		fmt.Printf("🔀 Transport %d/%d: %s at %d/sec for %v\n", i+1, len(transports), t.Name, rate, step)
+
+		if workload != nil {
+			workload.next, workload.loops = 0, 0
+		}
+		sender := dial(t)
+		pool := startWorkerPool(workers, sender)
+		s := runStep(pool, rate, step, workload)
+		pool.close()
+		sender.Close()
+		out = append(out, CompareResult{Transport: t.Name, SweepStep: s})
+
+		if i < len(transports)-1 && cooldown > 0 {
+			pause(cooldown)
+		}
+	}
+	return out
+}
+
+// compareWorkload generates a step's worth of records, up to
+// compareWorkloadMax, single-threaded from seed so the same seed always
+// gives the same workload. The run's own rng is put back afterwards. With
+// -body-file every record is the same already, and it returns nil.
+func compareWorkload(rate int, step time.Duration, seed int64) *payloadReplay {
+	if fixedBody != nil {
+		return nil
+	}
+	runRng := rng
+	rng = rand.New(&lockedSource{src: rand.NewSource(seed)})
+	defer func() { rng = runRng }()
+
+	n := min(rate*int(math.Ceil(step.Seconds())), compareWorkloadMax)
+	w := &payloadReplay{loop: true}
+	for i := range n {
+		device, ok := pickDevice()
+		if !ok {
+			break
+		}
+		format := rotateFormat(i)
+		var seq uint64
+		if deviceSeq {
+			seq = nextSeq(device)
+		}
+		rec, err := generate(format, device, seq)
+		if err != nil {
+			logError("generate failed", "format", format+1, "device", device, "err", err)
+			continue
+		}
+		identities.note(rec.Device, rec.DeviceID, rec.Serial)
+		w.events = append(w.events, replayEvent{Format: format, Device: device, Name: rec.Device, Body: rec.Body})
+	}
+	return w
+}
+
+func printCompareTable(results []CompareResult) {
+	fmt.Println("\n🔀 Transport comparison")
+	fmt.Printf("   %-24s %10s %9s %8s %7s %9s %9s %9s %9s\n",
+		"transport", "actual/s", "sent", "failed", "err%", "p50ms", "p90ms", "p99ms", "maxms")
+	for _, r := range results {
+		fmt.Printf("   %-24s %10.2f %9d %8d %7.2f %9.1f %9.1f %9.1f %9.1f\n",
+			r.Transport, r.ActualRate, r.Sent, r.Failed, r.ErrorRate*100, r.P50Ms, r.P90Ms, r.P99Ms, r.MaxMs)
+	}
+}
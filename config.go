@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Range is a min/max for one generated value and how values are drawn
+// from it: "uniform" (default) or "normal", centered on nominal (default:
+// between min and max) with ±3σ reaching the nearer limit and clamped to
+// the range. Setting nominal makes the default dist normal.
+type Range struct {
+	Min     float64  `json:"min"`
+	Max     float64  `json:"max"`
+	Nominal *float64 `json:"nominal,omitempty"`
+	Dist    string   `json:"dist,omitempty"`
+}
+
+func (r Range) normal() bool {
+	return r.Dist == "normal" || r.Dist == "" && r.Nominal != nil
+}
+
+// center is where a normal range peaks.
+func (r Range) center() float64 {
+	if r.Nominal != nil {
+		return *r.Nominal
+	}
+	return (r.Min + r.Max) / 2
+}
+
+// sigma is a normal range's standard deviation.
+func (r Range) sigma() float64 {
+	c := r.center()
+	return min(c-r.Min, r.Max-c) / 3
+}
+
+// Sample draws a value from r with the run's rng.
+func (r Range) Sample() float64 {
+	return r.SampleFrom(rng)
+}
+
+// SampleFrom draws a value from r with src.
+func (r Range) SampleFrom(src *rand.Rand) float64 {
+	if r.normal() {
+		v := r.center() + src.NormFloat64()*r.sigma()
+		return min(max(v, r.Min), r.Max)
+	}
+	return r.Min + src.Float64()*(r.Max-r.Min)
+}
+
+// SampleInt is Sample truncated to an int, matching the integer fields most
+// formats report.
+func (r Range) SampleInt() int {
+	return int(r.Sample())
+}
+
+func (r Range) validate(name string) error {
+	if r.Min > r.Max {
+		return fmt.Errorf("%s: min %v > max %v", name, r.Min, r.Max)
+	}
+	if r.Dist != "" && r.Dist != "uniform" && r.Dist != "normal" {
+		return fmt.Errorf("%s: unknown dist %q (want uniform or normal)", name, r.Dist)
+	}
+	if n := r.Nominal; n != nil {
+		if *n < r.Min || *n > r.Max {
+			return fmt.Errorf("%s: nominal %v outside %v..%v", name, *n, r.Min, r.Max)
+		}
+		if r.Dist == "uniform" {
+			return fmt.Errorf("%s: nominal needs dist normal", name)
+		}
+	}
+	return nil
+}
+
+// Config is the optional -config file. Ranges are in the raw units Format1
+// reports (see generateFormat); the other formats scale from them.
+type Config struct {
+	VoltageRange     Range `json:"voltage"`
+	PowerRange       Range `json:"power"`
+	FrequencyRange   Range `json:"frequency"`
+	TodayEnergyRange Range `json:"today_energy"`
+	TotalEnergyRange Range `json:"total_energy"`
+	TemperatureRange Range `json:"temperature"`
+
+	// Sites devices are grouped under with -geo; empty means defaultSites.
+	Sites []Site `json:"sites,omitempty"`
+
+	// ResponseFields lists, per format number ("1"-"4"), the dotted paths
+	// the server may add to its response under -strict-schema.
+	ResponseFields map[string][]string `json:"response_fields,omitempty"`
+}
+
+// defaultConfig matches the values the generators always used.
+func defaultConfig() Config {
+	return Config{
+		VoltageRange:     Range{Min: 6100, Max: 6300},
+		PowerRange:       Range{Min: 147000, Max: 147500},
+		FrequencyRange:   Range{Min: 700, Max: 750},
+		TodayEnergyRange: Range{Min: 0, Max: 1000},
+		TotalEnergyRange: Range{Min: 500000, Max: 510000},
+		TemperatureRange: Range{Min: 645, Max: 655},
+	}
+}
+
+// loadConfig reads path over the defaults, so a file only needs the
+// fields it changes.
+func loadConfig(path string) (Config, error) {
+	cfg := defaultConfig()
+	if path == "" {
+		return cfg, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, cfg.validate()
+}
+
+// rangeNames are the metrics a Config has ranges for, by their JSON name.
+var rangeNames = []string{"voltage", "power", "frequency", "today_energy", "total_energy", "temperature"}
+
+// rangeOf returns the named metric's range, or nil for an unknown name.
+func (c *Config) rangeOf(name string) *Range {
+	switch name {
+	case "voltage":
+		return &c.VoltageRange
+	case "power":
+		return &c.PowerRange
+	case "frequency":
+		return &c.FrequencyRange
+	case "today_energy":
+		return &c.TodayEnergyRange
+	case "total_energy":
+		return &c.TotalEnergyRange
+	case "temperature":
+		return &c.TemperatureRange
+	}
+	return nil
+}
+
+func (c Config) validate() error {
+	for _, name := range rangeNames {
+		if err := c.rangeOf(name).validate(name); err != nil {
+			return err
+		}
+	}
+	return validateSites(c.Sites)
+}
+
+// rangeFlag collects -range NAME=MIN:MAX[:NOMINAL] overrides, applied over
+// -config.
+type rangeFlag []struct {
+	name string
+	r    Range
+}
+
+func (f *rangeFlag) String() string {
+	var parts []string
+	for _, o := range *f {
+		s := fmt.Sprintf("%s=%v:%v", o.name, o.r.Min, o.r.Max)
+		if o.r.Nominal != nil {
+			s += fmt.Sprintf(":%v", *o.r.Nominal)
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (f *rangeFlag) Set(v string) error {
+	name, spec, ok := strings.Cut(v, "=")
+	if !ok || (&Config{}).rangeOf(name) == nil {
+		return fmt.Errorf("want NAME=MIN:MAX[:NOMINAL] with NAME one of %s", strings.Join(rangeNames, ", "))
+	}
+	fields := strings.Split(spec, ":")
+	if len(fields) < 2 || len(fields) > 3 {
+		return fmt.Errorf("%s: want MIN:MAX or MIN:MAX:NOMINAL, got %q", name, spec)
+	}
+	var nums [3]float64
+	for i, s := range fields {
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a number", name, s)
+		}
+		nums[i] = n
+	}
+	r := Range{Min: nums[0], Max: nums[1]}
+	if len(fields) == 3 {
+		r.Nominal = &nums[2]
+	}
+	if err := r.validate(name); err != nil {
+		return err
+	}
+	*f = append(*f, struct {
+		name string
+		r    Range
+	}{name, r})
+	return nil
+}
+
+// apply replaces the named ranges in c. A range's dist carries over from
+// -config unless the override sets a nominal.
+func (f rangeFlag) apply(c *Config) error {
+	for _, o := range f {
+		r := c.rangeOf(o.name)
+		dist := r.Dist
+		*r = o.r
+		if o.r.Nominal == nil {
+			r.Dist = dist
+		}
+		if err := r.validate(o.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
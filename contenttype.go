@@ -0,0 +1,26 @@
+package main
+
+// heartbeatFormat indexes the heartbeat entry in formatContentTypes, after
+// the telemetry formats.
+const heartbeatFormat = numFormats
+
+// formatContentTypes is the Content-Type each generator declares for its
+// encoding, indexed by format (telemetry formats, then heartbeat).
+var formatContentTypes = []string{
+	"application/json",
+	"application/json",
+	"application/json",
+	"application/json",
+	"application/x-protobuf",
+	"application/json",
+}
+
+// -content-type, overriding every generator when set
+var contentTypeOverride string
+
+func contentTypeFor(format int) string {
+	if contentTypeOverride != "" {
+		return contentTypeOverride
+	}
+	return formatContentTypes[format]
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// cgroupCPULimit returns the container's CPU quota in CPUs, from cgroup v2
+// cpu.max or cgroup v1 cfs quota/period, and false when there is none.
+func cgroupCPULimit() (float64, bool) {
+	if b, err := os.ReadFile("/sys/fs/cgroup/cpu.max"); err == nil {
+		f := strings.Fields(string(b)) // "max 100000" or "150000 100000"
+		if len(f) == 2 && f[0] != "max" {
+			return quotaCPUs(f[0], f[1])
+		}
+		return 0, false
+	}
+	q, err1 := os.ReadFile("/sys/fs/cgroup/cpu/cpu.cfs_quota_us")
+	p, err2 := os.ReadFile("/sys/fs/cgroup/cpu/cpu.cfs_period_us")
+	if err1 != nil || err2 != nil {
+		return 0, false
+	}
+	return quotaCPUs(strings.TrimSpace(string(q)), strings.TrimSpace(string(p)))
+}
+
+func quotaCPUs(quota, period string) (float64, bool) {
+	q, err1 := strconv.ParseFloat(quota, 64)
+	p, err2 := strconv.ParseFloat(period, 64)
+	if err1 != nil || err2 != nil || q <= 0 || p <= 0 {
+		return 0, false // v1 reports -1 for no quota
+	}
+	return q / p, true
+}
+
+// availableCPUs is the CPU the process may use: the cgroup quota when
+// there is one, otherwise every CPU. The runtime already caps GOMAXPROCS
+// to the quota since Go 1.25; this is for sizing the worker pool.
+func availableCPUs() (cpus float64, limited bool) {
+	n := float64(runtime.NumCPU())
+	if limit, ok := cgroupCPULimit(); ok && limit < n {
+		return limit, true
+	}
+	return n, false
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// CustomFormat is one payload shape from a -formats file, generated as a
+// map instead of a Go struct so new device types need no code change:
+//
+//	{"formats": [{
+//	  "name": "acme_v2",
+//	  "fields": [
+//	    {"path": "device_type", "value": "acme_v2"},
+//	    {"path": "device", "source": "device_name", "prefix": "ACME_"},
+//	    {"path": "ts", "source": "timestamp", "layout": "unix"},
+//	    {"path": "data.power_kw", "source": "power", "scale": 0.001, "decimals": 2, "unit": "kW"},
+//	    {"path": "data.humidity", "range": {"min": 20, "max": 80}, "unit": "%"}
+//	  ]}]}
+//
+// Dotted paths nest objects.
+type CustomFormat struct {
+	Name        string        `json:"name"`
+	ContentType string        `json:"content_type,omitempty"` // default application/json
+	Fields      []CustomField `json:"fields"`
+}
+
+// CustomField is one value of a custom format: a constant (value), one of
+// the simulator's generated quantities (source) or a draw from its own
+// range. Numbers come out as value*scale+offset, rounded to decimals
+// (0 = an integer); unit only documents what that yields.
+type CustomField struct {
+	Path     string          `json:"path"`
+	Value    json.RawMessage `json:"value,omitempty"`
+	Source   string          `json:"source,omitempty"`
+	Range    *Range          `json:"range,omitempty"`
+	Prefix   string          `json:"prefix,omitempty"` // device_name, device_id, serial
+	Layout   string          `json:"layout,omitempty"` // timestamp: unix, unix_ms, rfc3339 (default) or a Go layout
+	Scale    float64         `json:"scale,omitempty"`  // default 1
+	Offset   float64         `json:"offset,omitempty"`
+	Decimals int             `json:"decimals,omitempty"`
+	Unit     string          `json:"unit,omitempty"`
+}
+
+// customSources are the generated quantities a field can take, in the raw
+// units of their Config ranges.
+var customSources = []string{
+	"device_name", "device_id", "serial", "timestamp",
+	"voltage", "power", "frequency", "today_energy", "total_energy", "temperature", "fault",
+}
+
+// customFormats replaces the built-in formats when -formats is set; format
+// i is customFormats[i].
+var customFormats []*CustomFormat
+
+func loadCustomFormats(path string) ([]*CustomFormat, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Formats []*CustomFormat `json:"formats"`
+	}
+	if err := json.Unmarshal(b, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(file.Formats) == 0 || len(file.Formats) > numFormats {
+		return nil, fmt.Errorf("%s: want 1-%d formats, got %d", path, numFormats, len(file.Formats))
+	}
+	names := map[string]bool{}
+	for i, f := range file.Formats {
+		if f.Name == "" || names[f.Name] {
+			return nil, fmt.Errorf("%s: format %d needs a unique name", path, i+1)
+		}
+		names[f.Name] = true
+		if err := f.validate(); err != nil {
+			return nil, fmt.Errorf("%s: format %q: %w", path, f.Name, err)
+		}
+	}
+	return file.Formats, nil
+}
+
+func (f *CustomFormat) validate() error {
+	if len(f.Fields) == 0 {
+		return fmt.Errorf("no fields")
+	}
+	leaves := map[string]bool{}
+	for _, fd := range f.Fields {
+		if fd.Path == "" || slices.Contains(strings.Split(fd.Path, "."), "") {
+			return fmt.Errorf("invalid path %q", fd.Path)
+		}
+		kinds := 0
+		for _, set := range []bool{fd.Value != nil, fd.Source != "", fd.Range != nil} {
+			if set {
+				kinds++
+			}
+		}
+		if kinds != 1 {
+			return fmt.Errorf("%s: want exactly one of value, source or range", fd.Path)
+		}
+		if fd.Source != "" && !slices.Contains(customSources, fd.Source) {
+			return fmt.Errorf("%s: unknown source %q (want one of %s)", fd.Path, fd.Source, strings.Join(customSources, ", "))
+		}
+		if fd.Range != nil {
+			if err := fd.Range.validate(fd.Path); err != nil {
+				return err
+			}
+		}
+		if fd.Value != nil && !json.Valid(fd.Value) {
+			return fmt.Errorf("%s: value is not JSON", fd.Path)
+		}
+		if fd.Decimals < 0 {
+			return fmt.Errorf("%s: decimals must not be negative", fd.Path)
+		}
+		// a path can't be both a value and an object holding others
+		if leaves[fd.Path] {
+			return fmt.Errorf("%s: set twice", fd.Path)
+		}
+		for p := range leaves {
+			if strings.HasPrefix(p, fd.Path+".") || strings.HasPrefix(fd.Path, p+".") {
+				return fmt.Errorf("%s and %s overlap", p, fd.Path)
+			}
+		}
+		leaves[fd.Path] = true
+	}
+	return nil
+}
+
+// setupCustomFormats puts the custom formats in the built-ins' place:
+// they are numbered from 1 in file order and none of them is opt-in.
+func setupCustomFormats(formats []*CustomFormat) {
+	customFormats = formats
+	optInFormats = formatSet{}
+	for i := range disabledFormats {
+		if i >= len(formats) {
+			disabledFormats[i] = true
+			continue
+		}
+		formatContentTypes[i] = cmp.Or(formats[i].ContentType, "application/json")
+	}
+}
+
+// generateCustom builds one record of custom format f, its device fields
+// from rd.
+func generateCustom(f *CustomFormat, deviceNum int, now time.Time, meta PayloadMeta, rd reading) (record, error) {
+	payload := map[string]any{}
+	var rec record
+	for _, fd := range f.Fields {
+		var v any
+		var num float64
+		isNum := true
+		switch {
+		case fd.Value != nil:
+			v, isNum = fd.Value, false
+		case fd.Range != nil:
+			num = fd.Range.Sample()
+		default:
+			isNum = false
+			switch fd.Source {
+			case "device_name":
+				rec.Device = deviceName(cmp.Or(fd.Prefix, f.Name+"_"), deviceNum)
+				v = rec.Device
+			case "device_id":
+				rec.DeviceID = fmt.Sprintf("%s%d", fd.Prefix, deviceIDNum(deviceNum))
+				v = rec.DeviceID
+			case "serial":
+				rec.Serial = fmt.Sprintf("%s%d", fd.Prefix, rd.Serial)
+				v = rec.Serial
+			case "timestamp":
+				v = formatTimestamp(now, fd.Layout)
+			default:
+				isNum = true
+				switch fd.Source {
+				case "voltage":
+					num = float64(rd.Voltage)
+				case "power":
+					num = float64(rd.Power)
+				case "frequency":
+					num = float64(rd.Frequency)
+				case "today_energy":
+					num = float64(rd.TodayEnergy)
+				case "total_energy":
+					num = float64(rd.TotalEnergy)
+				case "temperature":
+					num = float64(rd.Temperature)
+				case "fault":
+					num = float64(rd.Fault)
+				}
+			}
+		}
+		if isNum {
+			v = scaleValue(num, fd)
+		}
+		setPath(payload, fd.Path, v)
+	}
+	if rec.Device == "" {
+		rec.Device = deviceName(f.Name+"_", deviceNum) // for results and identity counts
+	}
+
+	// run_id, seq, schema_version and geo, as the built-in formats carry
+	m, err := json.Marshal(meta)
+	if err != nil {
+		return record{}, err
+	}
+	var extra map[string]any
+	if err := json.Unmarshal(m, &extra); err != nil {
+		return record{}, err
+	}
+	for k, v := range extra {
+		if _, taken := payload[k]; !taken {
+			payload[k] = v
+		}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return record{}, fmt.Errorf("JSON marshal error: %w", err)
+	}
+	rec.Body = body
+	return rec, nil
+}
+
+// scaleValue applies a field's scale, offset and rounding.
+func scaleValue(v float64, fd CustomField) any {
+	scale := fd.Scale
+	if scale == 0 {
+		scale = 1
+	}
+	v = v*scale + fd.Offset
+	if fd.Decimals == 0 {
+		return int64(math.Round(v))
+	}
+	p := math.Pow10(fd.Decimals)
+	return math.Round(v*p) / p
+}
+
+func formatTimestamp(t time.Time, layout string) any {
+	switch layout {
+	case "unix":
+		return t.Unix()
+	case "unix_ms":
+		return t.UnixMilli()
+	case "", "rfc3339":
+		return t.Format(time.RFC3339)
+	}
+	return t.Format(layout)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"golang.org/x/term"
+)
+
+const (
+	dashRefresh   = 250 * time.Millisecond
+	sparkSamples  = 60
+	gaugeWidth    = 30
+	statsInterval = 10 * time.Second
+)
+
+var sparkRunes = []rune("▁▂▃▄▅▆▇█")
+
+type dashTick time.Time
+type dashDone struct{}
+
+type dashboard struct {
+	start      time.Time
+	rate       float64 // target records/sec, for scaling the sparkline
+	timeout    time.Duration
+	lastSent   uint64
+	lastLatSum int64
+	lastLatN   int64
+	lastTick   time.Time
+	spark      []float64
+	avgLatency time.Duration
+	maxLatency time.Duration
+	quit       bool // q or Ctrl-C pressed
+}
+
+func (d *dashboard) Init() tea.Cmd { return dashTickCmd() }
+
+func dashTickCmd() tea.Cmd {
+	return tea.Tick(dashRefresh, func(t time.Time) tea.Msg { return dashTick(t) })
+}
+
+func (d *dashboard) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "ctrl+c":
+			d.quit = true
+			return d, tea.Quit
+		}
+	case dashDone:
+		return d, tea.Quit
+	case dashTick:
+		d.sample(time.Time(msg))
+		return d, dashTickCmd()
+	}
+	return d, nil
+}
+
+func (d *dashboard) sample(now time.Time) {
+	sent := atomic.LoadUint64(&totalSent)
+	latSum := atomic.LoadInt64(&latencySumNs)
+	latN := atomic.LoadInt64(&latencyCount)
+
+	if !d.lastTick.IsZero() {
+		secs := now.Sub(d.lastTick).Seconds()
+		d.spark = append(d.spark, float64(sent-d.lastSent)/secs)
+		if len(d.spark) > sparkSamples {
+			d.spark = d.spark[1:]
+		}
+		if n := latN - d.lastLatN; n > 0 {
+			d.avgLatency = time.Duration((latSum - d.lastLatSum) / n)
+		}
+	}
+	d.maxLatency = time.Duration(atomic.SwapInt64(&latencyWindowMaxNs, 0))
+	d.lastSent, d.lastLatSum, d.lastLatN, d.lastTick = sent, latSum, latN, now
+}
+
+func (d *dashboard) View() string {
+	sent := atomic.LoadUint64(&totalSent)
+	failed := atomic.LoadUint64(&totalFailed)
+	reused := atomic.LoadUint64(&connsReused)
+	fresh := atomic.LoadUint64(&connsNew)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "☀️  Inverter simulator — %v elapsed   (q to quit)\n\n", time.Since(d.start).Round(time.Second))
+
+	cur := 0.0
+	if len(d.spark) > 0 {
+		cur = d.spark[len(d.spark)-1]
+	}
+	fmt.Fprintf(&b, " Throughput  %s  %.0f/s\n", sparkline(d.spark, d.rate), cur)
+	fmt.Fprintf(&b, " Sent %d | Failed %d | Error rate %.2f%%\n\n", sent, failed, pct(failed, sent+failed))
+
+	for _, i := range enabledFormats {
+		fmt.Fprintf(&b, " Format %d  %d\n", i+1, atomic.LoadUint64(&formatCounts[i]))
+	}
+	fmt.Fprintf(&b, "\n Avg latency %s %v\n", gauge(d.avgLatency, d.timeout), d.avgLatency.Round(time.Millisecond))
+	fmt.Fprintf(&b, " Max latency %s %v\n", gauge(d.maxLatency, d.timeout), d.maxLatency.Round(time.Millisecond))
+	fmt.Fprintf(&b, "\n Connection reuse %.1f%% (%d reused / %d new)\n", pct(reused, reused+fresh), reused, fresh)
+	return b.String()
+}
+
+func sparkline(samples []float64, scale float64) string {
+	for _, v := range samples {
+		scale = max(scale, v)
+	}
+	var b strings.Builder
+	for _, v := range samples {
+		i := 0
+		if scale > 0 {
+			i = int(v / scale * float64(len(sparkRunes)-1))
+		}
+		b.WriteRune(sparkRunes[i])
+	}
+	return b.String()
+}
+
+// gauge draws v as a bar relative to full (the request timeout).
+func gauge(v, full time.Duration) string {
+	n := 0
+	if full > 0 {
+		n = min(int(float64(v)/float64(full)*gaugeWidth), gaugeWidth)
+	}
+	return "[" + strings.Repeat("█", n) + strings.Repeat(" ", gaugeWidth-n) + "]"
+}
+
+func pct(part, whole uint64) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return float64(part) / float64(whole) * 100
+}
+
+// startDashboard shows live stats until the returned stop func is called.
+// With -tui on a terminal that is the interactive dashboard; otherwise it
+// falls back to a plain stats line every few seconds. The dashboard puts
+// the terminal in raw mode, so Ctrl-C reaches it as a key rather than as
+// SIGINT; it and q stop the run through requestStop, as a signal does.
+func startDashboard(rate float64, timeout time.Duration) (stop func()) {
+	if !term.IsTerminal(int(os.Stdout.Fd())) {
+		return startStatsPrinter()
+	}
+
+	d := &dashboard{start: time.Now(), rate: rate, timeout: timeout}
+	p := tea.NewProgram(d, tea.WithAltScreen())
+	requestLogMuted.Store(true)
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		if _, err := p.Run(); err != nil {
+			fmt.Fprintln(os.Stderr, "❌ dashboard:", err)
+		}
+		requestLogMuted.Store(false)
+		if d.quit {
+			requestStop("quit from the dashboard")
+		}
+	}()
+	return func() {
+		p.Send(dashDone{})
+		<-exited
+	}
+}
+
+func startStatsPrinter() (stop func()) {
+	start := time.Now()
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(statsInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			total := atomic.LoadUint64(&totalSent)
+			fmt.Printf("📊 Sent=%d | Failed=%d | Rate=%.2f/s\n",
+				total, atomic.LoadUint64(&totalFailed),
+				float64(total)/time.Since(start).Seconds())
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,32 @@
+package main
+
+import "time"
+
+// Per-device clock drift (-device-clock-skew): each device's clock is off
+// by its own fixed amount, up to deviceSkewMax, on top of -clock-skew.
+// Clocks run behind, except for the deviceSkewFuture fraction of devices
+// (-device-clock-future), which run ahead and send future timestamps.
+var (
+	deviceSkewMax    time.Duration
+	deviceSkewFuture float64
+)
+
+// deviceClockOffset is how far deviceNum's clock is off. It is derived from
+// the seed and the device number, so it holds for the whole run and a rerun
+// with the same -seed drifts the same way.
+func deviceClockOffset(deviceNum int) time.Duration {
+	if deviceSkewMax == 0 {
+		return 0
+	}
+	h := splitmix64(uint64(runSeed) ^ uint64(deviceNum) ^ 0xc10c)
+	off := time.Duration(h % uint64(deviceSkewMax+1))
+	if float64(splitmix64(h)>>11)/(1<<53) < deviceSkewFuture {
+		return off
+	}
+	return -off
+}
+
+// deviceClock is the time as deviceNum's own clock reads it.
+func deviceClock(deviceNum int) time.Time {
+	return deviceNow().Add(deviceClockOffset(deviceNum))
+}
@@ -0,0 +1,65 @@
+package main
+
+// deviceIDRange is the device ID and serial number space (-device-id-range):
+// numbers are drawn from 1..deviceIDRange.
+var deviceIDRange = 600
+
+// deviceIdentity is the fixed ID and serial number a device reports for the
+// whole run.
+type deviceIdentity struct {
+	ID, Serial int
+}
+
+// fleetIdentities holds devices 1..numDevices, drawn once at startup.
+var fleetIdentities []deviceIdentity
+
+// setupIdentities draws every device's identity. While the ID range is at
+// least the fleet size, no two devices share an ID or a serial; a smaller
+// range makes them collide, as badly provisioned fleets do.
+func setupIdentities() {
+	ids, serials := drawNumbers(numDevices, deviceIDRange), drawNumbers(numDevices, deviceIDRange)
+	fleetIdentities = make([]deviceIdentity, numDevices)
+	for i := range fleetIdentities {
+		fleetIdentities[i] = deviceIdentity{ID: ids[i], Serial: serials[i]}
+	}
+}
+
+// drawNumbers returns n numbers from 1..space in random order, distinct
+// when space allows (Floyd's sampling, so a huge space costs nothing).
+func drawNumbers(n, space int) []int {
+	out := make([]int, 0, n)
+	if n > space {
+		for range n {
+			out = append(out, rng.Intn(space)+1)
+		}
+		return out
+	}
+	seen := make(map[int]bool, n)
+	for j := space - n + 1; j <= space; j++ {
+		t := rng.Intn(j) + 1
+		if seen[t] {
+			t = j
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	rng.Shuffle(len(out), func(i, j int) { out[i], out[j] = out[j], out[i] })
+	return out
+}
+
+// identityOf returns the device's identity. Devices that joined with
+// -devices-churn are past the drawn fleet; theirs is derived from the seed
+// and their number, so it is just as stable.
+func identityOf(deviceNum int) deviceIdentity {
+	if deviceNum >= 1 && deviceNum <= len(fleetIdentities) {
+		return fleetIdentities[deviceNum-1]
+	}
+	h := splitmix64(uint64(runSeed) ^ uint64(deviceNum))
+	return deviceIdentity{
+		ID:     int(h%uint64(deviceIDRange)) + 1,
+		Serial: int(splitmix64(h)%uint64(deviceIDRange)) + 1,
+	}
+}
+
+// deviceIDNum is the number a device's ID is built from.
+func deviceIDNum(deviceNum int) int { return identityOf(deviceNum).ID }
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+)
+
+// assertDistribution accumulates every sampled field value and checks,
+// after the run, that its mean and spread match the configured Range
+// (-assert-distribution). A mismatch points at a generator bug.
+var assertDistribution bool
+
+// minDistSamples is how many values a field needs before it is checked.
+const minDistSamples = 30
+
+// fieldStats is a running mean and variance (Welford).
+type fieldStats struct {
+	r    Range
+	n    float64
+	mean float64
+	m2   float64
+}
+
+var (
+	distMu    sync.Mutex
+	distStats = map[string]*fieldStats{}
+)
+
+// sampleInt draws from r, recording the value under name when
+// -assert-distribution is on.
+func sampleInt(name string, r Range) int {
+	v := r.SampleInt()
+	if assertDistribution {
+		distMu.Lock()
+		s := distStats[name]
+		if s == nil {
+			s = &fieldStats{r: r}
+			distStats[name] = s
+		}
+		s.n++
+		d := float64(v) - s.mean
+		s.mean += d / s.n
+		s.m2 += d * (float64(v) - s.mean)
+		distMu.Unlock()
+	}
+	return v
+}
+
+// expected returns the mean and standard deviation r should produce after
+// SampleInt truncates toward zero. A clamped normal loses a little spread
+// at ±3σ, which the tolerance absorbs.
+func (r Range) expected() (mean, sd float64) {
+	if r.normal() {
+		return r.center() - 0.5, r.sigma() // truncation drops 0.5 on average
+	}
+	return (r.Min+r.Max)/2 - 0.5, (r.Max - r.Min) / math.Sqrt(12)
+}
+
+// checkDistribution writes observed vs expected statistics per field to w and
+// reports whether every checked field is within tolerance: four standard
+// errors plus one unit of rounding for the mean, and the same or 5% for
+// the spread.
+func checkDistribution(w io.Writer) bool {
+	distMu.Lock()
+	defer distMu.Unlock()
+	names := make([]string, 0, len(distStats))
+	for name := range distStats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ok := true
+	fmt.Fprintln(w, "   Value distribution:")
+	for _, name := range names {
+		s := distStats[name]
+		wantMean, wantSD := s.r.expected()
+		sd := math.Sqrt(s.m2 / s.n)
+		verdict := "ok"
+		switch {
+		case s.n < minDistSamples:
+			verdict = "too few samples"
+		case math.Abs(s.mean-wantMean) > 4*wantSD/math.Sqrt(s.n)+1,
+			math.Abs(sd-wantSD) > 4*wantSD/math.Sqrt(2*s.n)+0.05*wantSD+1:
+			verdict = "DRIFT"
+			ok = false
+		}
+		fmt.Fprintf(w, "     %-13s n=%-8.0f mean %.2f (want %.2f)  sd %.2f (want %.2f)  %s\n",
+			name, s.n, s.mean, wantMean, sd, wantSD, verdict)
+	}
+	return ok
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// The simulated clock (-sim-start, -time-scale) is what device timestamps
+// read: it starts at simStart when the run starts and runs timeScale times
+// faster than the wall clock, so a 15-minute run at -time-scale 96 covers
+// a whole day. simStart is zero unless one of the two flags is set; devices
+// then report wall-clock time.
+var (
+	simStart  time.Time
+	timeScale = 1.0
+	simEpoch  time.Time // wall-clock moment simStart corresponds to
+)
+
+// diurnal makes power follow the sun over the simulated day (-diurnal);
+// the energy counters integrate whatever power is reported.
+var diurnal bool
+
+// Daylight on the simulated clock, in local hours.
+const sunrise, sunset = 6.0, 18.0
+
+// startSimClock pins simStart to now; a zero start means the current time.
+func startSimClock(start time.Time, scale float64) {
+	simEpoch = time.Now()
+	simStart = start
+	if simStart.IsZero() {
+		simStart = simEpoch
+	}
+	timeScale = scale
+}
+
+// simNow is the simulated time, or the wall clock without a simulated one.
+func simNow() time.Time {
+	if simStart.IsZero() {
+		return time.Now()
+	}
+	return simStart.Add(time.Duration(float64(time.Since(simEpoch)) * timeScale))
+}
+
+// parseSimStart accepts RFC 3339 or a local "2006-01-02T15:04"; a bare
+// "15:04" means that time today.
+func parseSimStart(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02T15:04", s, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("15:04", s, time.Local); err == nil {
+		y, m, d := time.Now().Date()
+		return time.Date(y, m, d, t.Hour(), t.Minute(), 0, 0, time.Local), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (want RFC 3339, 2006-01-02T15:04 or 15:04)", s)
+}
+
+// daylight is the fraction of peak output at t: a half sine from sunrise
+// to sunset, zero at night.
+func daylight(t time.Time) float64 {
+	h := float64(t.Hour()) + float64(t.Minute())/60 + float64(t.Second())/3600
+	if h <= sunrise || h >= sunset {
+		return 0
+	}
+	return math.Sin(math.Pi * (h - sunrise) / (sunset - sunrise))
+}
+
+// devicePower is a device's output power at now. The configured power
+// range is its peak; with -diurnal the curve scales it down toward night.
+func devicePower(now time.Time) int {
+	p := sampleInt("power", cfg.PowerRange)
+	if diurnal {
+		p = int(float64(p) * daylight(now))
+	}
+	return p
+}
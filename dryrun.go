@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// DryRunSender writes every message to a file instead of sending it
+// (-dry-run): JSON bodies pretty-printed, one document after another, and
+// anything else (protobuf, multipart, gzip) as a small JSON wrapper with
+// the body in base64, so the output stays one stream of JSON. Every Send
+// succeeds, so the counters and summary read as for a real run.
+type DryRunSender struct {
+	mu   sync.Mutex
+	w    io.Writer
+	buf  *bufio.Writer // nil for stdout
+	f    *os.File      // nil for stdout, or once closed
+	name string
+	err  error
+	n    int
+}
+
+// NewDryRunSender writes to path, or to stdout for "-".
+func NewDryRunSender(path string) (*DryRunSender, error) {
+	if path == "-" {
+		// unbuffered, so payloads interleave with the live output in order
+		return &DryRunSender{w: os.Stdout, name: "stdout"}, nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	buf := bufio.NewWriterSize(f, 256*1024)
+	return &DryRunSender{w: buf, buf: buf, f: f, name: path}, nil
+}
+
+func (d *DryRunSender) Send(ctx context.Context, msg Message) error {
+	var out bytes.Buffer
+	if msg.Encoding != "" || json.Indent(&out, msg.Body, "", "  ") != nil {
+		out.Reset()
+		b, _ := json.MarshalIndent(struct {
+			ContentType     string `json:"content_type"`
+			ContentEncoding string `json:"content_encoding,omitempty"`
+			Bytes           int    `json:"bytes"`
+			Payload         []byte `json:"payload_base64"`
+		}{msg.ContentType, msg.Encoding, len(msg.Body), msg.Body}, "", "  ")
+		out.Write(b)
+	}
+	out.WriteByte('\n')
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, err := d.w.Write(out.Bytes()); err != nil && d.err == nil {
+		d.err = err
+	}
+	d.n++
+	return nil
+}
+
+// Target names where the payloads go.
+func (d *DryRunSender) Target() string {
+	return "dry-run:" + d.name
+}
+
+// Close flushes and closes the file and reports the first write error.
+// It may be called more than once.
+func (d *DryRunSender) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.f != nil {
+		if err := d.buf.Flush(); err != nil && d.err == nil {
+			d.err = err
+		}
+		if err := d.f.Close(); err != nil && d.err == nil {
+			d.err = err
+		}
+		d.f = nil
+		d.w = io.Discard
+	}
+	return d.err
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// verifyEcho makes every send check that the server echoed back what we sent
+var verifyEcho bool
+
+var totalCorrupted uint64
+
+// diffEcho compares what we sent against what the server echoed and returns
+// the first mismatching path, or "" if every field we sent came back intact.
+// Fields the server added on its own are ignored.
+func diffEcho(sent, echoed []byte) (string, error) {
+	want, err := decodeNumbers(sent)
+	if err != nil {
+		return "", fmt.Errorf("decode sent: %w", err)
+	}
+	got, err := decodeNumbers(echoed)
+	if err != nil {
+		return "", fmt.Errorf("decode echo: %w", err)
+	}
+	return diffValue("", want, got), nil
+}
+
+func decodeNumbers(b []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v any
+	err := dec.Decode(&v)
+	return v, err
+}
+
+func diffValue(path string, want, got any) string {
+	switch w := want.(type) {
+	case map[string]any:
+		g, ok := got.(map[string]any)
+		if !ok {
+			return pathOrRoot(path)
+		}
+		for k, wv := range w {
+			gv, ok := g[k]
+			if !ok {
+				return joinPath(path, k)
+			}
+			if p := diffValue(joinPath(path, k), wv, gv); p != "" {
+				return p
+			}
+		}
+		return ""
+	case []any:
+		g, ok := got.([]any)
+		if !ok || len(g) != len(w) {
+			return pathOrRoot(path)
+		}
+		for i := range w {
+			if p := diffValue(fmt.Sprintf("%s[%d]", path, i), w[i], g[i]); p != "" {
+				return p
+			}
+		}
+		return ""
+	case json.Number:
+		// 650 and 650.0 are the same reading, so compare numerically
+		g, ok := got.(json.Number)
+		if !ok {
+			return pathOrRoot(path)
+		}
+		wf, err1 := strconv.ParseFloat(w.String(), 64)
+		gf, err2 := strconv.ParseFloat(g.String(), 64)
+		if err1 != nil || err2 != nil || wf != gf {
+			return pathOrRoot(path)
+		}
+		return ""
+	default:
+		if want != got {
+			return pathOrRoot(path)
+		}
+		return ""
+	}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func pathOrRoot(path string) string {
+	if path == "" {
+		return "<root>"
+	}
+	return path
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync/atomic"
+)
+
+// endpointPicks are the values -endpoint-pick accepts.
+var endpointPicks = []string{"round-robin", "random"}
+
+// parseEndpoints splits -endpoints into its URLs, each an http:// or
+// https:// URL given once.
+func parseEndpoints(s string) ([]string, error) {
+	var urls []string
+	for _, e := range strings.Split(s, ",") {
+		e = strings.TrimSpace(e)
+		if u, err := url.Parse(e); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("%q is not an http:// or https:// URL", e)
+		}
+		for _, seen := range urls {
+			if seen == e {
+				return nil, fmt.Errorf("%s is listed twice", e)
+			}
+		}
+		urls = append(urls, e)
+	}
+	if len(urls) < 2 {
+		return nil, fmt.Errorf("want at least two URLs, got %q", s)
+	}
+	return urls, nil
+}
+
+// EndpointSender spreads requests over several replicas (-endpoints)
+// without a load balancer in front: each Send goes to the next one in turn,
+// or to one drawn at random, and is counted against it. Under -retries
+// each attempt picks again, as a balancer would.
+type EndpointSender struct {
+	Next   []Sender
+	Random bool
+
+	turn         uint64
+	sent, failed []uint64
+}
+
+func NewEndpointSender(next []Sender, random bool) *EndpointSender {
+	return &EndpointSender{Next: next, Random: random, sent: make([]uint64, len(next)), failed: make([]uint64, len(next))}
+}
+
+func (s *EndpointSender) Send(ctx context.Context, msg Message) error {
+	_, err := s.do(ctx, func(next Sender) ([]byte, error) { return nil, next.Send(ctx, msg) })
+	return err
+}
+
+// Exchange is Send through a replica's Exchange; every replica is an
+// HTTPSender, so each has one.
+func (s *EndpointSender) Exchange(ctx context.Context, msg Message) ([]byte, error) {
+	return s.do(ctx, func(next Sender) ([]byte, error) { return next.(Exchanger).Exchange(ctx, msg) })
+}
+
+func (s *EndpointSender) do(ctx context.Context, attempt func(Sender) ([]byte, error)) ([]byte, error) {
+	i := s.pick()
+	if p, ok := ctx.Value(endpointKey{}).(*string); ok {
+		*p = targetOf(s.Next[i])
+	}
+	body, err := attempt(s.Next[i])
+	if err != nil {
+		atomic.AddUint64(&s.failed[i], 1)
+	} else {
+		atomic.AddUint64(&s.sent[i], 1)
+	}
+	return body, err
+}
+
+func (s *EndpointSender) pick() int {
+	if s.Random {
+		return rng.Intn(len(s.Next))
+	}
+	return int((atomic.AddUint64(&s.turn, 1) - 1) % uint64(len(s.Next)))
+}
+
+// Target lists the replicas; deliver reports the one each request hit.
+func (s *EndpointSender) Target() string {
+	targets := make([]string, len(s.Next))
+	for i, next := range s.Next {
+		targets[i] = targetOf(next)
+	}
+	return strings.Join(targets, ",")
+}
+
+func (s *EndpointSender) Close() error {
+	for _, next := range s.Next {
+		next.Close()
+	}
+	return nil
+}
+
+// printSummary reports each replica's requests, so one that drops records
+// stands out against the others.
+func (s *EndpointSender) printSummary() {
+	fmt.Printf("   Endpoints: %d\n", len(s.Next))
+	for i, next := range s.Next {
+		sent, failed := atomic.LoadUint64(&s.sent[i]), atomic.LoadUint64(&s.failed[i])
+		fmt.Printf("     %s: %d ok | %d failed (%.1f%%)\n", targetOf(next), sent, failed, pct(failed, sent+failed))
+	}
+}
+
+// endpointKey carries a *string through a Send's context; EndpointSender
+// sets it to the replica the request went to, for -results-csv and
+// -record-failures.
+type endpointKey struct{}
+
+func withEndpoint(ctx context.Context, target *string) context.Context {
+	return context.WithValue(ctx, endpointKey{}, target)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// energyResetHour is the local hour at which a device's daily energy
+// counter goes back to zero (-energy-reset-hour), -1 to draw daily energy
+// at random instead.
+var energyResetHour = 0
+
+var (
+	energyMu     sync.Mutex
+	energyDay    = map[int]time.Time{} // device -> start of the day it last reported in
+	energyResets uint64
+)
+
+// energyDayStart returns the most recent reset boundary at or before t, in
+// t's location.
+func energyDayStart(t time.Time) time.Time {
+	y, m, d := t.Date()
+	b := resetBoundary(y, m, d, t.Location())
+	if t.Before(b) {
+		b = resetBoundary(y, m, d-1, t.Location())
+	}
+	return b
+}
+
+// resetBoundary is the first instant of the given day whose local clock
+// reads energyResetHour or later. When a DST change skips that hour,
+// time.Date lands before the gap, so step forward to where it ends.
+// Calendar arithmetic keeps 23- and 25-hour days right.
+func resetBoundary(y int, m time.Month, d int, loc *time.Location) time.Time {
+	b := time.Date(y, m, d, energyResetHour, 0, 0, 0, loc)
+	day := b.Day()
+	for b.Hour() < energyResetHour && b.Day() == day {
+		b = b.Add(time.Minute)
+	}
+	return b
+}
+
+// noteEnergyDay records that the device reported in the day starting at
+// start and reports whether that crossed a reset boundary.
+func noteEnergyDay(deviceNum int, start time.Time) bool {
+	energyMu.Lock()
+	defer energyMu.Unlock()
+	last, ok := energyDay[deviceNum]
+	energyDay[deviceNum] = start
+	if ok && !last.Equal(start) {
+		energyResets++
+		return true
+	}
+	return false
+}
+
+// deviceEnergy returns the device's daily and lifetime energy at now, in
+// the raw units (Wh) of TodayEnergyRange and TotalEnergyRange. Both are
+// integrated from the power (W) it reports, trapezoid-wise between
+// reports, so the total never goes backwards. Daily energy restarts at
+// each reset boundary, or with -energy-reset-hour -1 is drawn at random.
+func deviceEnergy(deviceNum int, now time.Time, power int) (today, total int) {
+	start := energyDayStart(now)
+	reset := energyResetHour >= 0 && noteEnergyDay(deviceNum, start)
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	st := stateOf(deviceNum)
+	if reset {
+		st.TodayEnergy = 0
+	}
+	if !st.lastReport.IsZero() && now.After(st.lastReport) {
+		avg := float64(power+st.lastPower) / 2
+		st.TotalEnergy += avg * now.Sub(st.lastReport).Hours()
+		st.TodayEnergy += avg * now.Sub(later(st.lastReport, start)).Hours()
+	}
+	st.lastReport, st.lastPower = now, power
+	if energyResetHour < 0 {
+		return sampleInt("today_energy", cfg.TodayEnergyRange), int(st.TotalEnergy)
+	}
+	return int(st.TodayEnergy), int(st.TotalEnergy)
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// printEnergyResets reports the resets, if there were any or the hour was
+// asked for with -energy-reset-hour.
+func printEnergyResets(asked bool) {
+	energyMu.Lock()
+	defer energyMu.Unlock()
+	if !asked && energyResets == 0 {
+		return
+	}
+	fmt.Printf("   Daily energy resets: %d (at %02d:00 local)\n", energyResets, energyResetHour)
+}
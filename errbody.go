@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// errorBodyLimit caps how much of a non-200 response body is kept; enough
+// for the JSON error most servers send back.
+const errorBodyLimit = 512
+
+// maxServerErrors bounds how many distinct error messages are tracked;
+// the rest are counted together.
+const maxServerErrors = 1000
+
+var (
+	serverErrMu     sync.Mutex
+	serverErrors    = map[string]uint64{} // "400 Bad Request: field x is required" -> responses
+	serverErrOthers uint64
+)
+
+// readErrorBody returns up to errorBodyLimit bytes of r as text, cut at a
+// rune boundary.
+func readErrorBody(r io.Reader) string {
+	b, _ := io.ReadAll(io.LimitReader(r, errorBodyLimit))
+	for len(b) > 0 && !utf8.Valid(b) {
+		b = b[:len(b)-1]
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// errorMessage pulls the explanation out of an error body: the "error",
+// "message" or "detail" field of a JSON object (or error.message), else
+// the first line of the text.
+func errorMessage(body string) string {
+	var m map[string]any
+	if json.Unmarshal([]byte(body), &m) == nil {
+		if e, ok := m["error"].(map[string]any); ok {
+			if s, ok := e["message"].(string); ok {
+				return s
+			}
+		}
+		for _, k := range []string{"error", "message", "detail"} {
+			if s, ok := m[k].(string); ok {
+				return s
+			}
+		}
+	}
+	line, _, _ := strings.Cut(body, "\n")
+	return strings.TrimSpace(line)
+}
+
+// noteServerError counts one rejected response by status and message.
+func noteServerError(se *StatusError) {
+	key := se.Status
+	if msg := errorMessage(se.Body); msg != "" {
+		key += ": " + msg
+	}
+	serverErrMu.Lock()
+	defer serverErrMu.Unlock()
+	if _, ok := serverErrors[key]; ok || len(serverErrors) < maxServerErrors {
+		serverErrors[key]++
+	} else {
+		serverErrOthers++
+	}
+}
+
+// printServerErrors lists the most frequent distinct error responses.
+func printServerErrors() {
+	serverErrMu.Lock()
+	defer serverErrMu.Unlock()
+	if len(serverErrors) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(serverErrors))
+	for k := range serverErrors {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if serverErrors[keys[i]] != serverErrors[keys[j]] {
+			return serverErrors[keys[i]] > serverErrors[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	fmt.Printf("   Server errors: %d distinct\n", len(serverErrors))
+	for i, k := range keys {
+		if i == 10 {
+			fmt.Printf("     ... and %d more\n", len(keys)-i)
+			break
+		}
+		fmt.Printf("     %d× %s\n", serverErrors[k], k)
+	}
+	if serverErrOthers > 0 {
+		fmt.Printf("     %d more responses past the first %d distinct messages\n", serverErrOthers, maxServerErrors)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"syscall"
+)
+
+// failureKind is why a send failed, so an overloaded server (timeouts,
+// resets) reads differently from one that is down (refused) or rejecting
+// records (non-200).
+type failureKind int
+
+const (
+	failTimeout failureKind = iota
+	failRefused
+	failReset
+	failDNS
+	failTLS
+	failStatus
+	failOther
+	numFailureKinds
+)
+
+var failureNames = [numFailureKinds]string{"timeout", "connection refused", "connection reset", "DNS", "TLS", "non-200 status", "other"}
+
+var failureCounts [numFailureKinds]uint64
+
+// classifyFailure sorts a Send error into its failureKind. DNS comes
+// before timeout, since a lookup that times out is still a DNS problem.
+func classifyFailure(err error) failureKind {
+	var se *StatusError
+	var dns *net.DNSError
+	var ne net.Error
+	var alert tls.AlertError
+	var rec tls.RecordHeaderError
+	var cert *tls.CertificateVerificationError
+	var unknownCA x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	switch {
+	case errors.As(err, &se):
+		return failStatus
+	case errors.As(err, &dns):
+		return failDNS
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &ne) && ne.Timeout():
+		return failTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return failRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE), errors.Is(err, syscall.ECONNABORTED),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return failReset
+	case errors.As(err, &alert), errors.As(err, &rec), errors.As(err, &cert),
+		errors.As(err, &unknownCA), errors.As(err, &hostname),
+		strings.Contains(err.Error(), "server gave HTTP response to HTTPS client"): // net/http drops the TLS error
+		return failTLS
+	}
+	return failOther
+}
+
+func noteFailure(err error) {
+	atomic.AddUint64(&failureCounts[classifyFailure(err)], 1)
+}
+
+// printFailureKinds breaks the failed sends down by cause. Records that
+// were answered 200 and failed a later check (-verify-echo,
+// -strict-schema) are counted in their own lines, not here.
+func printFailureKinds() {
+	var parts []string
+	for k, name := range failureNames {
+		if n := atomic.LoadUint64(&failureCounts[k]); n > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d", name, n))
+		}
+	}
+	if parts != nil {
+		fmt.Printf("   Failures by cause: %s\n", strings.Join(parts, " | "))
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// FailureRecord is one failed or rejected send, as written by
+// -record-failures: enough to see why it failed and to send the exact
+// payload again with -replay.
+type FailureRecord struct {
+	Time          time.Time `json:"timestamp"`
+	Format        int       `json:"format"` // 1-5
+	Device        string    `json:"device"`
+	Endpoint      string    `json:"endpoint"`
+	Status        int       `json:"status"` // 0 if the request never got an answer
+	Error         string    `json:"error"`
+	Response      string    `json:"response,omitempty"` // start of the server's answer to a rejected send
+	ContentType   string    `json:"content_type"`
+	Payload       string    `json:"payload,omitempty"`        // the body as sent, when it is UTF-8
+	PayloadBase64 []byte    `json:"payload_base64,omitempty"` // otherwise
+}
+
+// body returns the payload bytes exactly as they were sent.
+func (r *FailureRecord) body() []byte {
+	if r.PayloadBase64 != nil {
+		return r.PayloadBase64
+	}
+	return []byte(r.Payload)
+}
+
+// failures is nil unless -record-failures is set.
+var failures *FailureWriter
+
+// FailureWriter appends one JSON line per failed send. Successful sends
+// cost nothing, so capture overhead tracks the failure rate. It is safe
+// for concurrent use.
+type FailureWriter struct {
+	mu  sync.Mutex
+	f   *os.File
+	buf *bufio.Writer
+	enc *json.Encoder
+	n   int
+	err error // first write error, reported on Close
+}
+
+func NewFailureWriter(path string) (*FailureWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	buf := bufio.NewWriterSize(f, 64*1024)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	return &FailureWriter{f: f, buf: buf, enc: enc}, nil
+}
+
+func (fw *FailureWriter) Write(r FailureRecord, body []byte) {
+	if utf8.Valid(body) {
+		r.Payload = string(body)
+	} else {
+		r.PayloadBase64 = body
+	}
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if err := fw.enc.Encode(r); err != nil && fw.err == nil {
+		fw.err = err
+	}
+	fw.n++
+}
+
+func (fw *FailureWriter) Close() error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if err := fw.buf.Flush(); err != nil && fw.err == nil {
+		fw.err = err
+	}
+	if err := fw.f.Close(); err != nil && fw.err == nil {
+		fw.err = err
+	}
+	return fw.err
+}
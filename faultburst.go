@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// faultMeanDuration switches the random fault model to bursts
+// (-fault-mean-duration): a healthy device goes into fault with
+// probability faultRate per record, then reports that one code on every
+// record until the burst ends, after an exponentially distributed time
+// with this mean on the device's clock. 0 keeps faults independent per
+// record.
+var faultMeanDuration time.Duration
+
+var faultBursts, faultBurstNs int64 // bursts started, and their drawn lengths
+
+// burstFault is the fault code deviceNum reports at now under the burst
+// model.
+func burstFault(deviceNum int, now time.Time) int {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	st := stateOf(deviceNum)
+	if st.faultCode != 0 && now.Before(st.faultUntil) {
+		return st.faultCode
+	}
+	st.faultCode = 0
+	if faultRate > 0 && rng.Float64() < faultRate {
+		d := time.Duration(rng.ExpFloat64() * float64(faultMeanDuration))
+		st.faultCode, st.faultUntil = faultCodes[rng.Intn(len(faultCodes))], now.Add(d)
+		atomic.AddInt64(&faultBursts, 1)
+		atomic.AddInt64(&faultBurstNs, int64(d))
+	}
+	return st.faultCode
+}
+
+func printFaultBursts() {
+	n := atomic.LoadInt64(&faultBursts)
+	if n == 0 {
+		fmt.Println("   Fault bursts: none started")
+		return
+	}
+	fmt.Printf("   Fault bursts: %d started | mean %v (configured %v)\n",
+		n, (time.Duration(atomic.LoadInt64(&faultBurstNs)) / time.Duration(n)).Round(time.Millisecond), faultMeanDuration)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// fdHeadroom is what we budget for descriptors that aren't connections:
+// stdio, the results CSV, the state file, DNS lookups, the poller.
+const fdHeadroom = 64
+
+// filesNeeded estimates the descriptors a run needs: one connection per
+// worker for each target host (idle connections to hosts a comparison has
+// already moved past stay open until they time out), plus headroom.
+func filesNeeded(workers, hosts int) uint64 {
+	return uint64(workers*max(hosts, 1) + fdHeadroom)
+}
+
+// checkFileLimit makes sure the open-file limit covers need, raising the
+// soft limit when the hard limit allows. want > 0 (-max-open-files) asks
+// for that soft limit instead. Go already raises the soft limit to the
+// hard one at startup on most Unixes, so on those a warning means the
+// hard limit itself is too low.
+func checkFileLimit(need, want uint64) {
+	soft, hard, err := fileLimit()
+	if err != nil {
+		return // no such limit on this platform
+	}
+	target := max(need, want)
+	if raised := min(target, hard); raised > soft {
+		if err := setFileLimit(raised); err == nil {
+			fmt.Printf("   Open-file limit raised from %d to %d\n", soft, raised)
+			soft = raised
+		}
+	}
+	if need > soft {
+		fmt.Printf("⚠️  Open-file limit %d is below the ≈%d this run needs; expect \"too many open files\" (raise ulimit -n or lower -workers)\n", soft, need)
+	}
+	fdLimit = soft
+}
+
+// peak descriptor usage, sampled once a second
+var (
+	fdLimit uint64
+	fdPeak  int64
+)
+
+// openFiles counts the process's open descriptors, -1 where the platform
+// doesn't expose them.
+func openFiles() int {
+	for _, dir := range []string{"/proc/self/fd", "/dev/fd"} {
+		if entries, err := os.ReadDir(dir); err == nil {
+			return len(entries) - 1 // ReadDir's own descriptor
+		}
+	}
+	return -1
+}
+
+func runFDSampler(done <-chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		sampleFDs()
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func sampleFDs() {
+	n := int64(openFiles())
+	for {
+		peak := atomic.LoadInt64(&fdPeak)
+		if n <= peak || atomic.CompareAndSwapInt64(&fdPeak, peak, n) {
+			return
+		}
+	}
+}
+
+func printFDs() {
+	if openFiles() < 0 {
+		return
+	}
+	sampleFDs()
+	peak := atomic.LoadInt64(&fdPeak)
+	if fdLimit == 0 {
+		fmt.Printf("   Open files: peak %d\n", peak)
+		return
+	}
+	fmt.Printf("   Open files: peak %d of %d (%.1f%%)\n", peak, fdLimit, pct(uint64(peak), fdLimit))
+}
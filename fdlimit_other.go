@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package main
+
+import "errors"
+
+var errNoFileLimit = errors.New("open-file limit not supported on this platform")
+
+func fileLimit() (soft, hard uint64, err error) { return 0, 0, errNoFileLimit }
+
+func setFileLimit(n uint64) error { return errNoFileLimit }
@@ -0,0 +1,20 @@
+//go:build linux || darwin
+
+package main
+
+import "syscall"
+
+func fileLimit() (soft, hard uint64, err error) {
+	var r syscall.Rlimit
+	err = syscall.Getrlimit(syscall.RLIMIT_NOFILE, &r)
+	return r.Cur, r.Max, err
+}
+
+func setFileLimit(n uint64) error {
+	var r syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &r); err != nil {
+		return err
+	}
+	r.Cur = n
+	return syscall.Setrlimit(syscall.RLIMIT_NOFILE, &r)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// fraction of payloads that drop some optional fields (-fields-subset)
+var fieldsSubset float64
+
+// optionalFields lists, per format, the JSON paths a real device may leave
+// out depending on firmware. Identity fields are never dropped.
+var optionalFields = [][]string{
+	{"signal_strength", "data.f", "data.today_e", "data.inv_temp", "data.fault_code"},
+	{"data.freq_hz", "data.energy_today_wh", "data.temp_celsius", "data.error_code"},
+	{"Hz", "E_today", "temp", "status"},
+	{"readings.frequency_hz", "readings.today_kwh", "readings.temp_f", "readings.fault"},
+}
+
+var (
+	omittedMu     sync.Mutex
+	omittedCounts = map[string]uint64{}
+)
+
+// omitOptionalFields re-encodes body with 1-3 of the format's optional fields
+// removed. Struct marshaling always emits every field, so this goes through
+// a generic map.
+func omitOptionalFields(body []byte, formatType int) ([]byte, error) {
+	fields := optionalFields[formatType]
+	if len(fields) == 0 {
+		return body, nil
+	}
+	return reencode(body, func(m map[string]any) {
+		n := 1 + rng.Intn(min(3, len(fields)))
+		for _, i := range rng.Perm(len(fields))[:n] {
+			if deletePath(m, fields[i]) {
+				omittedMu.Lock()
+				omittedCounts[fmt.Sprintf("format %d %s", formatType+1, fields[i])]++
+				omittedMu.Unlock()
+			}
+		}
+	})
+}
+
+// reencode decodes a JSON object into a generic map, lets edit change it,
+// and marshals it again.
+func reencode(body []byte, edit func(m map[string]any)) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber() // keep ints as ints on the way back out
+	var m map[string]any
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+	edit(m)
+	return json.Marshal(m)
+}
+
+// deletePath removes a dotted path like "data.inv_temp" from m.
+func deletePath(m map[string]any, path string) bool {
+	parts := strings.Split(path, ".")
+	for _, p := range parts[:len(parts)-1] {
+		next, ok := m[p].(map[string]any)
+		if !ok {
+			return false
+		}
+		m = next
+	}
+	last := parts[len(parts)-1]
+	if _, ok := m[last]; !ok {
+		return false
+	}
+	delete(m, last)
+	return true
+}
+
+// setPath sets a dotted path like "data.power_factor" in m, creating
+// intermediate objects as needed.
+func setPath(m map[string]any, path string, v any) {
+	parts := strings.Split(path, ".")
+	for _, p := range parts[:len(parts)-1] {
+		next, ok := m[p].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			m[p] = next
+		}
+		m = next
+	}
+	m[parts[len(parts)-1]] = v
+}
+
+// getPath returns the value at a dotted path in m.
+func getPath(m map[string]any, path string) (any, bool) {
+	parts := strings.Split(path, ".")
+	for _, p := range parts[:len(parts)-1] {
+		next, ok := m[p].(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		m = next
+	}
+	v, ok := m[parts[len(parts)-1]]
+	return v, ok
+}
+
+func printOmittedFields() {
+	omittedMu.Lock()
+	defer omittedMu.Unlock()
+	if len(omittedCounts) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(omittedCounts))
+	for k := range omittedCounts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fmt.Println("   Omitted fields:")
+	for _, k := range keys {
+		fmt.Printf("     %s: %d\n", k, omittedCounts[k])
+	}
+}
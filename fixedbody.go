@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// fixedBody replaces every generated payload with one exact body
+// (-body-file / -body-from-stdin), nil when the generators run.
+var fixedBody []byte
+
+// readBody reads the fixed body from path, or from stdin for "-".
+func readBody(path string) ([]byte, error) {
+	var b []byte
+	var err error
+	if path == "-" {
+		b, err = io.ReadAll(os.Stdin)
+	} else {
+		b, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, fmt.Errorf("body is empty")
+	}
+	return b, nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// deviceFleet is the set of devices currently online when -devices-churn
+// lets devices join and leave mid-run. Joining devices always get a number
+// never used before, and leaving devices never come back, so the server
+// sees real registrations and devices that go stale.
+type deviceFleet struct {
+	mu     sync.Mutex
+	active []int
+	nextID int
+	seen   map[int]struct{} // devices that actually sent something
+	joins  int
+	leaves int
+}
+
+// fleet is nil unless -devices-churn is set; devices are then drawn from
+// the fixed range 1..numDevices.
+var fleet *deviceFleet
+
+func newDeviceFleet() *deviceFleet {
+	f := &deviceFleet{nextID: numDevices + 1, seen: map[int]struct{}{}}
+	for d := 1; d <= numDevices; d++ {
+		f.active = append(f.active, d)
+	}
+	return f
+}
+
+// pickTries is how many devices pickDevice draws at random before it
+// looks through all of them for one that still reports.
+const pickTries = 8
+
+// pickDevice chooses the device for the next record, skipping devices
+// that have gone silent. It reports false when every device is silent,
+// which churn can bring about by retiring all the others.
+func pickDevice() (int, bool) {
+	for range pickTries {
+		var d int
+		switch {
+		case fleet != nil:
+			d = fleet.pick()
+		default:
+			d = rng.Intn(numDevices) + 1
+		}
+		if !isSilent(d) {
+			return d, true
+		}
+	}
+	if fleet != nil {
+		return fleet.pickAwake()
+	}
+	start := rng.Intn(numDevices)
+	for i := range numDevices {
+		if d := (start+i)%numDevices + 1; !isSilent(d) {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+func (f *deviceFleet) pick() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	d := f.active[rng.Intn(len(f.active))]
+	if !isSilent(d) {
+		f.seen[d] = struct{}{}
+	}
+	return d
+}
+
+// pickAwake looks through the active devices, from a random one on, for
+// one that isn't silent.
+func (f *deviceFleet) pickAwake() (int, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	start := rng.Intn(len(f.active))
+	for i := range f.active {
+		if d := f.active[(start+i)%len(f.active)]; !isSilent(d) {
+			f.seen[d] = struct{}{}
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// at returns the i-th active device (wrapping), for round-robin callers
+// like heartbeats.
+func (f *deviceFleet) at(i int) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.active[i%len(f.active)]
+}
+
+// churn runs one round of joins/leaves. perMinute is the fraction of the
+// active fleet that churns per minute; the fleet random-walks between half
+// and double its starting size.
+func (f *deviceFleet) churn(perMinute float64, elapsed time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	expected := perMinute * float64(len(f.active)) * elapsed.Minutes()
+	events := int(expected)
+	if rng.Float64() < expected-float64(events) {
+		events++
+	}
+	for ; events > 0; events-- {
+		join := rng.Intn(2) == 0
+		if len(f.active) <= numDevices/2 {
+			join = true
+		} else if len(f.active) >= numDevices*2 {
+			join = false
+		}
+		if join {
+			f.active = append(f.active, f.nextID)
+			f.nextID++
+			f.joins++
+		} else {
+			i := rng.Intn(len(f.active))
+			f.active[i] = f.active[len(f.active)-1]
+			f.active = f.active[:len(f.active)-1]
+			f.leaves++
+		}
+	}
+}
+
+// runChurn applies churn once a second until done is closed.
+func runChurn(perMinute float64, done <-chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			fleet.churn(perMinute, time.Second)
+		}
+	}
+}
+
+func (f *deviceFleet) printSummary() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fmt.Printf("   Device churn: %d joined | %d left | %d active at end | %d distinct devices sent\n",
+		f.joins, f.leaves, len(f.active), len(f.seen))
+}
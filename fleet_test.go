@@ -0,0 +1,74 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// withFleet runs the test with devices 1..n, churning, and the given ones
+// already silent.
+func withFleet(t *testing.T, n int, silent []int) {
+	devices, runRng, silenced, list, at := numDevices, rng, silentDevices, silentList, silenceAt
+	t.Cleanup(func() {
+		numDevices, rng, fleet = devices, runRng, nil
+		silentDevices, silentList, silenceAt = silenced, list, at
+	})
+	numDevices = n
+	rng = rand.New(&lockedSource{src: rand.NewSource(1)})
+	fleet = newDeviceFleet()
+	setupSilence(silent, time.Now().Add(-time.Second))
+}
+
+func TestPickDeviceSkipsSilent(t *testing.T) {
+	withFleet(t, 10, []int{1, 2, 3, 4, 5, 6, 7, 8, 9})
+	for range 100 {
+		if d, ok := pickDevice(); !ok || d != 10 {
+			t.Fatalf("picked %d, %v; want 10, true", d, ok)
+		}
+	}
+}
+
+// Churn never retires silent devices on purpose, so it can leave only
+// silent ones active; pickDevice must then give up rather than spin.
+func TestPickDeviceChurnedToSilence(t *testing.T) {
+	withFleet(t, 10, []int{1, 2, 3, 4, 5})
+	fleet.active = []int{1, 2, 3, 4, 5}
+
+	got := make(chan bool)
+	go func() {
+		_, ok := pickDevice()
+		got <- ok
+	}()
+	select {
+	case ok := <-got:
+		if ok {
+			t.Error("picked a device though every active one is silent")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("pickDevice didn't return with every active device silent")
+	}
+}
+
+func TestPickDeviceUnderChurn(t *testing.T) {
+	withFleet(t, 20, []int{2, 4, 6, 8, 10, 12, 14, 16, 18, 20})
+	for range 300 {
+		fleet.churn(60, time.Second) // the whole fleet, every second
+		d, ok := pickDevice()
+		if !ok {
+			continue
+		}
+		if isSilent(d) {
+			t.Fatalf("picked silent device %d", d)
+		}
+		fleet.mu.Lock()
+		active := false
+		for _, a := range fleet.active {
+			active = active || a == d
+		}
+		fleet.mu.Unlock()
+		if !active {
+			t.Fatalf("picked device %d, which isn't active", d)
+		}
+	}
+}
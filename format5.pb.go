@@ -0,0 +1,340 @@
+// Format 5: Format 1's fields as protobuf, for gateways that speak protobuf
+// over HTTP (Content-Type: application/x-protobuf). format5.pb.go is
+// generated from this file; see the go:generate line in protobuf.go.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: format5.proto
+
+package main
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Format5Payload struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	DeviceType     string                 `protobuf:"bytes,1,opt,name=device_type,json=deviceType,proto3" json:"device_type,omitempty"`
+	DeviceName     string                 `protobuf:"bytes,2,opt,name=device_name,json=deviceName,proto3" json:"device_name,omitempty"`
+	DeviceId       string                 `protobuf:"bytes,3,opt,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"`
+	Date           string                 `protobuf:"bytes,4,opt,name=date,proto3" json:"date,omitempty"`
+	Time           string                 `protobuf:"bytes,5,opt,name=time,proto3" json:"time,omitempty"`
+	SignalStrength string                 `protobuf:"bytes,6,opt,name=signal_strength,json=signalStrength,proto3" json:"signal_strength,omitempty"`
+	Data           *Format5Payload_Data   `protobuf:"bytes,7,opt,name=data,proto3" json:"data,omitempty"`
+	RunId          string                 `protobuf:"bytes,8,opt,name=run_id,json=runId,proto3" json:"run_id,omitempty"`
+	Seq            uint64                 `protobuf:"varint,9,opt,name=seq,proto3" json:"seq,omitempty"`
+	SiteId         string                 `protobuf:"bytes,10,opt,name=site_id,json=siteId,proto3" json:"site_id,omitempty"`
+	Latitude       float64                `protobuf:"fixed64,11,opt,name=latitude,proto3" json:"latitude,omitempty"`
+	Longitude      float64                `protobuf:"fixed64,12,opt,name=longitude,proto3" json:"longitude,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *Format5Payload) Reset() {
+	*x = Format5Payload{}
+	mi := &file_format5_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Format5Payload) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Format5Payload) ProtoMessage() {}
+
+func (x *Format5Payload) ProtoReflect() protoreflect.Message {
+	mi := &file_format5_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Format5Payload.ProtoReflect.Descriptor instead.
+func (*Format5Payload) Descriptor() ([]byte, []int) {
+	return file_format5_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Format5Payload) GetDeviceType() string {
+	if x != nil {
+		return x.DeviceType
+	}
+	return ""
+}
+
+func (x *Format5Payload) GetDeviceName() string {
+	if x != nil {
+		return x.DeviceName
+	}
+	return ""
+}
+
+func (x *Format5Payload) GetDeviceId() string {
+	if x != nil {
+		return x.DeviceId
+	}
+	return ""
+}
+
+func (x *Format5Payload) GetDate() string {
+	if x != nil {
+		return x.Date
+	}
+	return ""
+}
+
+func (x *Format5Payload) GetTime() string {
+	if x != nil {
+		return x.Time
+	}
+	return ""
+}
+
+func (x *Format5Payload) GetSignalStrength() string {
+	if x != nil {
+		return x.SignalStrength
+	}
+	return ""
+}
+
+func (x *Format5Payload) GetData() *Format5Payload_Data {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *Format5Payload) GetRunId() string {
+	if x != nil {
+		return x.RunId
+	}
+	return ""
+}
+
+func (x *Format5Payload) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *Format5Payload) GetSiteId() string {
+	if x != nil {
+		return x.SiteId
+	}
+	return ""
+}
+
+func (x *Format5Payload) GetLatitude() float64 {
+	if x != nil {
+		return x.Latitude
+	}
+	return 0
+}
+
+func (x *Format5Payload) GetLongitude() float64 {
+	if x != nil {
+		return x.Longitude
+	}
+	return 0
+}
+
+type Format5Payload_Data struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	SerialNo         string                 `protobuf:"bytes,1,opt,name=serial_no,json=serialNo,proto3" json:"serial_no,omitempty"`
+	S1V              int64                  `protobuf:"varint,2,opt,name=s1v,proto3" json:"s1v,omitempty"`
+	TotalOutputPower int64                  `protobuf:"varint,3,opt,name=total_output_power,json=totalOutputPower,proto3" json:"total_output_power,omitempty"`
+	F                int64                  `protobuf:"varint,4,opt,name=f,proto3" json:"f,omitempty"`
+	TodayE           int64                  `protobuf:"varint,5,opt,name=today_e,json=todayE,proto3" json:"today_e,omitempty"`
+	TotalE           int64                  `protobuf:"varint,6,opt,name=total_e,json=totalE,proto3" json:"total_e,omitempty"`
+	InvTemp          int64                  `protobuf:"varint,7,opt,name=inv_temp,json=invTemp,proto3" json:"inv_temp,omitempty"`
+	FaultCode        int64                  `protobuf:"varint,8,opt,name=fault_code,json=faultCode,proto3" json:"fault_code,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *Format5Payload_Data) Reset() {
+	*x = Format5Payload_Data{}
+	mi := &file_format5_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Format5Payload_Data) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Format5Payload_Data) ProtoMessage() {}
+
+func (x *Format5Payload_Data) ProtoReflect() protoreflect.Message {
+	mi := &file_format5_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Format5Payload_Data.ProtoReflect.Descriptor instead.
+func (*Format5Payload_Data) Descriptor() ([]byte, []int) {
+	return file_format5_proto_rawDescGZIP(), []int{0, 0}
+}
+
+func (x *Format5Payload_Data) GetSerialNo() string {
+	if x != nil {
+		return x.SerialNo
+	}
+	return ""
+}
+
+func (x *Format5Payload_Data) GetS1V() int64 {
+	if x != nil {
+		return x.S1V
+	}
+	return 0
+}
+
+func (x *Format5Payload_Data) GetTotalOutputPower() int64 {
+	if x != nil {
+		return x.TotalOutputPower
+	}
+	return 0
+}
+
+func (x *Format5Payload_Data) GetF() int64 {
+	if x != nil {
+		return x.F
+	}
+	return 0
+}
+
+func (x *Format5Payload_Data) GetTodayE() int64 {
+	if x != nil {
+		return x.TodayE
+	}
+	return 0
+}
+
+func (x *Format5Payload_Data) GetTotalE() int64 {
+	if x != nil {
+		return x.TotalE
+	}
+	return 0
+}
+
+func (x *Format5Payload_Data) GetInvTemp() int64 {
+	if x != nil {
+		return x.InvTemp
+	}
+	return 0
+}
+
+func (x *Format5Payload_Data) GetFaultCode() int64 {
+	if x != nil {
+		return x.FaultCode
+	}
+	return 0
+}
+
+var File_format5_proto protoreflect.FileDescriptor
+
+const file_format5_proto_rawDesc = "" +
+	"\n" +
+	"\rformat5.proto\x12\bsolar.v1\"\xcf\x04\n" +
+	"\x0eFormat5Payload\x12\x1f\n" +
+	"\vdevice_type\x18\x01 \x01(\tR\n" +
+	"deviceType\x12\x1f\n" +
+	"\vdevice_name\x18\x02 \x01(\tR\n" +
+	"deviceName\x12\x1b\n" +
+	"\tdevice_id\x18\x03 \x01(\tR\bdeviceId\x12\x12\n" +
+	"\x04date\x18\x04 \x01(\tR\x04date\x12\x12\n" +
+	"\x04time\x18\x05 \x01(\tR\x04time\x12'\n" +
+	"\x0fsignal_strength\x18\x06 \x01(\tR\x0esignalStrength\x121\n" +
+	"\x04data\x18\a \x01(\v2\x1d.solar.v1.Format5Payload.DataR\x04data\x12\x15\n" +
+	"\x06run_id\x18\b \x01(\tR\x05runId\x12\x10\n" +
+	"\x03seq\x18\t \x01(\x04R\x03seq\x12\x17\n" +
+	"\asite_id\x18\n" +
+	" \x01(\tR\x06siteId\x12\x1a\n" +
+	"\blatitude\x18\v \x01(\x01R\blatitude\x12\x1c\n" +
+	"\tlongitude\x18\f \x01(\x01R\tlongitude\x1a\xdd\x01\n" +
+	"\x04Data\x12\x1b\n" +
+	"\tserial_no\x18\x01 \x01(\tR\bserialNo\x12\x10\n" +
+	"\x03s1v\x18\x02 \x01(\x03R\x03s1v\x12,\n" +
+	"\x12total_output_power\x18\x03 \x01(\x03R\x10totalOutputPower\x12\f\n" +
+	"\x01f\x18\x04 \x01(\x03R\x01f\x12\x17\n" +
+	"\atoday_e\x18\x05 \x01(\x03R\x06todayE\x12\x17\n" +
+	"\atotal_e\x18\x06 \x01(\x03R\x06totalE\x12\x19\n" +
+	"\binv_temp\x18\a \x01(\x03R\ainvTemp\x12\x1d\n" +
+	"\n" +
+	"fault_code\x18\b \x01(\x03R\tfaultCodeB\tZ\a./;mainb\x06proto3"
+
+var (
+	file_format5_proto_rawDescOnce sync.Once
+	file_format5_proto_rawDescData []byte
+)
+
+func file_format5_proto_rawDescGZIP() []byte {
+	file_format5_proto_rawDescOnce.Do(func() {
+		file_format5_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_format5_proto_rawDesc), len(file_format5_proto_rawDesc)))
+	})
+	return file_format5_proto_rawDescData
+}
+
+var file_format5_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_format5_proto_goTypes = []any{
+	(*Format5Payload)(nil),      // 0: solar.v1.Format5Payload
+	(*Format5Payload_Data)(nil), // 1: solar.v1.Format5Payload.Data
+}
+var file_format5_proto_depIdxs = []int32{
+	1, // 0: solar.v1.Format5Payload.data:type_name -> solar.v1.Format5Payload.Data
+	1, // [1:1] is the sub-list for method output_type
+	1, // [1:1] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_format5_proto_init() }
+func file_format5_proto_init() {
+	if File_format5_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_format5_proto_rawDesc), len(file_format5_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_format5_proto_goTypes,
+		DependencyIndexes: file_format5_proto_depIdxs,
+		MessageInfos:      file_format5_proto_msgTypes,
+	}.Build()
+	File_format5_proto = out.File
+	file_format5_proto_goTypes = nil
+	file_format5_proto_depIdxs = nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// numFormats is how many payload formats there are. Per-format state is
+// sized by it, so adding a format means bumping it and its generator. The
+// first numBaseFormats are on by default; the rest are opt-in.
+const (
+	numFormats     = 5
+	numBaseFormats = 4
+)
+
+// formatSet is a set of formats, as the repeatable -disable-format and
+// -enable-format flags: formats switched off for this run, e.g. while the
+// server has a known bug with one of them, and opt-in formats switched on.
+type formatSet [numFormats]bool
+
+var disabledFormats, enabledOptIn formatSet
+
+// optInFormats are off unless named by -enable-format.
+var optInFormats = formatSet{protobufFormat: true}
+
+func (s *formatSet) Set(v string) error {
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || n < 1 || n > len(s) {
+		return fmt.Errorf("want a format number 1-%d, got %q", len(s), v)
+	}
+	s[n-1] = true
+	return nil
+}
+
+func (s *formatSet) String() string {
+	var off []string
+	for i, d := range s {
+		if d {
+			off = append(off, strconv.Itoa(i+1))
+		}
+	}
+	return strings.Join(off, ",")
+}
+
+// enabledFormats are the formats in use, in order. It is fixed once flags
+// are parsed, so the send loop can index it without locking.
+var enabledFormats = []int{0, 1, 2, 3}
+
+// offFormats are the formats not in use: disabled, or opt-in and not
+// enabled.
+func offFormats() formatSet {
+	var off formatSet
+	for f := range off {
+		off[f] = disabledFormats[f] || (optInFormats[f] && !enabledOptIn[f])
+	}
+	return off
+}
+
+// formatOn reports whether format f is in use.
+func formatOn(f int) bool { return !offFormats()[f] }
+
+// formatListed reports whether summaries list format f: every base format,
+// even when disabled, and opt-in formats once enabled. With -formats it is
+// every custom format.
+func formatListed(f int) bool {
+	if customFormats != nil {
+		return f < len(customFormats)
+	}
+	return !optInFormats[f] || enabledOptIn[f]
+}
+
+// setupFormats applies -disable-format and -enable-format. It fails when
+// nothing is left.
+func setupFormats() error {
+	enabledFormats = enabledFormats[:0]
+	for f, off := range offFormats() {
+		if !off {
+			enabledFormats = append(enabledFormats, f)
+		}
+	}
+	if len(enabledFormats) == 0 {
+		return fmt.Errorf("every format is disabled")
+	}
+	return nil
+}
+
+// rotateFormat is the nth format of an even rotation over the enabled ones.
+func rotateFormat(n int) int {
+	return enabledFormats[n%len(enabledFormats)]
+}
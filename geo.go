@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Site is a physical installation that groups devices.
+type Site struct {
+	ID  string  `json:"id"`
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// DeviceGeo is where a device sits. It is embedded in PayloadMeta as a
+// pointer so payloads only carry it with -geo.
+type DeviceGeo struct {
+	SiteID    string  `json:"site_id"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// defaultSites is used with -geo when the config file doesn't list any.
+var defaultSites = []Site{
+	{ID: "SITE-BLR-01", Lat: 12.9716, Lon: 77.5946},
+	{ID: "SITE-KOC-01", Lat: 9.9312, Lon: 76.2673},
+	{ID: "SITE-JOD-01", Lat: 26.2389, Lon: 73.0243},
+	{ID: "SITE-MUC-01", Lat: 48.1351, Lon: 11.5820},
+	{ID: "SITE-PHX-01", Lat: 33.4484, Lon: -112.0740},
+}
+
+// siteSpreadDeg is how far (in degrees, ~1km) devices scatter around their
+// site's coordinates.
+const siteSpreadDeg = 0.01
+
+var (
+	sites      []Site   // active sites, nil without -geo
+	siteCounts []uint64 // sends per site
+)
+
+func setupGeo(s []Site) {
+	sites = s
+	siteCounts = make([]uint64, len(s))
+}
+
+// siteOf groups devices under sites in contiguous blocks of device number.
+// Devices added mid-run (beyond the base fleet) wrap around the same blocks.
+func siteOf(deviceNum int) int {
+	return (deviceNum - 1) % numDevices * len(sites) / numDevices
+}
+
+// deviceGeo returns the device's location. A device's offset from its
+// site is derived from its number, so it stays put for the whole run and
+// across runs.
+func deviceGeo(deviceNum int) *DeviceGeo {
+	i := siteOf(deviceNum)
+	h := splitmix64(uint64(deviceNum))
+	dLat := float64(h&0xffffffff)/(1<<32)*2 - 1
+	dLon := float64(h>>32)/(1<<32)*2 - 1
+	return &DeviceGeo{
+		SiteID:    sites[i].ID,
+		Latitude:  sites[i].Lat + dLat*siteSpreadDeg,
+		Longitude: sites[i].Lon + dLon*siteSpreadDeg,
+	}
+}
+
+// noteSite counts one record sent from its device's site.
+func noteSite(deviceNum int) {
+	if sites != nil {
+		atomic.AddUint64(&siteCounts[siteOf(deviceNum)], 1)
+	}
+}
+
+// splitmix64 is a cheap, well-mixed hash for deriving per-device constants.
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+func validateSites(s []Site) error {
+	seen := map[string]bool{}
+	for _, site := range s {
+		if site.ID == "" {
+			return fmt.Errorf("site with empty id")
+		}
+		if seen[site.ID] {
+			return fmt.Errorf("duplicate site id %q", site.ID)
+		}
+		seen[site.ID] = true
+		if site.Lat < -90 || site.Lat > 90 || site.Lon < -180 || site.Lon > 180 {
+			return fmt.Errorf("site %s: coordinates out of range", site.ID)
+		}
+	}
+	if len(s) > numDevices {
+		return fmt.Errorf("%d sites but only %d devices", len(s), numDevices)
+	}
+	return nil
+}
+
+func printSites() {
+	fmt.Println("   Sites:")
+	for i, site := range sites {
+		devices := 0
+		for d := 1; d <= numDevices; d++ {
+			if siteOf(d) == i {
+				devices++
+			}
+		}
+		fmt.Printf("     %s (%.4f, %.4f): %d base devices, %d records\n",
+			site.ID, site.Lat, site.Lon, devices, atomic.LoadUint64(&siteCounts[i]))
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// totalAttempts counts every request put on the wire: retries, duplicate
+// attempts, failures and heartbeats included. It is reset when the run
+// starts so the preflight doesn't count.
+var totalAttempts uint64
+
+// goodput is the number of records the server accepted exactly once.
+// Without -require-ack every record is attempted once, so that is the
+// records sent. With it, a message acked twice was ingested twice and
+// doesn't count. A message acked only after Send had given up does count,
+// because the server holds exactly one copy.
+func goodput(ack *AckSender) uint64 {
+	if ack == nil {
+		return atomic.LoadUint64(&totalSent)
+	}
+	unique := atomic.LoadUint64(&ack.unique)
+	return unique - min(unique, atomic.LoadUint64(&ack.duplicated))
+}
+
+func printGoodput(good uint64, elapsed time.Duration) {
+	attempts := atomic.LoadUint64(&totalAttempts)
+	fmt.Printf("   Goodput: %d records accepted exactly once (%.2f/sec) | raw: %d requests (%.2f/sec) | %.1f%% of requests were goodput\n",
+		good, float64(good)/elapsed.Seconds(), attempts, float64(attempts)/elapsed.Seconds(), pct(good, attempts))
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// gzipBodies sends every record gzip-compressed with Content-Encoding: gzip
+// (-gzip).
+var gzipBodies bool
+
+// Per-format body sizes before and after compression.
+var (
+	gzipRawBytes  [numFormats]uint64
+	gzipWireBytes [numFormats]uint64
+)
+
+var gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+
+// gzipBody compresses body. Writes to a bytes.Buffer can't fail, so
+// neither can this.
+func gzipBody(body []byte) []byte {
+	var buf bytes.Buffer
+	w := gzipWriters.Get().(*gzip.Writer)
+	w.Reset(&buf)
+	w.Write(body)
+	w.Close()
+	gzipWriters.Put(w)
+	return buf.Bytes()
+}
+
+// compressMessage gzips msg in place, so every transport and preflight
+// sends the same encoding.
+func compressMessage(msg *Message) {
+	msg.Body = gzipBody(msg.Body)
+	msg.Encoding = "gzip"
+}
+
+func recordGzip(formatType, raw, wire int) {
+	atomic.AddUint64(&gzipRawBytes[formatType], uint64(raw))
+	atomic.AddUint64(&gzipWireBytes[formatType], uint64(wire))
+}
+
+func printGzip() {
+	var raw, wire uint64
+	for i := range gzipRawBytes {
+		raw += atomic.LoadUint64(&gzipRawBytes[i])
+		wire += atomic.LoadUint64(&gzipWireBytes[i])
+	}
+	if wire == 0 {
+		return
+	}
+	fmt.Printf("   Gzip: %s of bodies sent as %s (%.2fx, %.1f%% saved)\n",
+		formatBytes(int64(raw)), formatBytes(int64(wire)), float64(raw)/float64(wire), 100-pct(wire, raw))
+	for i := range gzipRawBytes {
+		r, w := atomic.LoadUint64(&gzipRawBytes[i]), atomic.LoadUint64(&gzipWireBytes[i])
+		if w > 0 {
+			fmt.Printf("     Format %d: %.2fx (%s → %s)\n", i+1, float64(r)/float64(w), formatBytes(int64(r)), formatBytes(int64(w)))
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// headerChaos is the fraction of requests sent with deliberately odd
+// headers (-header-chaos), to see what the WAF and server put up with.
+// The body is left alone.
+var headerChaos float64
+
+// oversizedHeader is the value length for the oversized-header case; well
+// past the 8KB many proxies allow per header line, under Go's 1MB server
+// default for the whole header block.
+const oversizedHeader = 16 << 10
+
+type headerChaosKind int
+
+const (
+	chaosWrongType headerChaosKind = iota
+	chaosDuplicate
+	chaosOversized
+	chaosNoType
+	numChaosKinds
+)
+
+var chaosNames = [numChaosKinds]string{"wrong content-type", "duplicated headers", "oversized value", "missing content-type"}
+
+// per kind: answered 200, answered with another status, no answer
+var chaosAccepted, chaosRejected, chaosErrors [numChaosKinds]uint64
+
+// applyHeaderChaos picks whether this request gets odd headers and, if so,
+// which kind, and rewrites h. It returns -1 for a well-formed request.
+func applyHeaderChaos(h http.Header) headerChaosKind {
+	if headerChaos == 0 || rng.Float64() >= headerChaos {
+		return -1
+	}
+	kind := headerChaosKind(rng.Intn(int(numChaosKinds)))
+	switch kind {
+	case chaosWrongType:
+		h.Set("Content-Type", "text/plain; charset=utf-16")
+	case chaosDuplicate:
+		h.Add("Content-Type", "application/xml")
+		for _, k := range []string{"X-Run-Id", "User-Agent"} {
+			if v := h.Get(k); v != "" {
+				h[k] = []string{v, v} // fresh slice: h's values may be shared
+			}
+		}
+	case chaosOversized:
+		h.Set("X-Chaos-Padding", strings.Repeat("a", oversizedHeader))
+	case chaosNoType:
+		h.Del("Content-Type")
+	}
+	return kind
+}
+
+func recordHeaderChaos(kind headerChaosKind, err error) {
+	switch code := statusOf(err); {
+	case code == http.StatusOK:
+		atomic.AddUint64(&chaosAccepted[kind], 1)
+	case code == 0:
+		atomic.AddUint64(&chaosErrors[kind], 1)
+	default:
+		atomic.AddUint64(&chaosRejected[kind], 1)
+	}
+}
+
+func printHeaderChaos() {
+	fmt.Printf("   Header chaos (%.1f%% of requests):\n", headerChaos*100)
+	for k := range numChaosKinds {
+		fmt.Printf("     %s: %d accepted | %d rejected | %d no answer\n", chaosNames[k],
+			atomic.LoadUint64(&chaosAccepted[k]), atomic.LoadUint64(&chaosRejected[k]), atomic.LoadUint64(&chaosErrors[k]))
+	}
+}
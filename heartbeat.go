@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HeartbeatPayload is the minimal keepalive a device sends between readings.
+type HeartbeatPayload struct {
+	DeviceType string `json:"device_type"`
+	DeviceName string `json:"device_name"`
+	Timestamp  int64  `json:"timestamp"`
+	PayloadMeta
+}
+
+var heartbeatSent uint64
+var heartbeatFailed uint64
+var heartbeatPending int64 // heartbeats started but not finished
+
+// runHeartbeats sends one heartbeat per device every interval, spread evenly
+// across the interval so they don't all land in the same instant. It returns
+// when done is closed. At most limit heartbeats are in flight; beyond that
+// the loop waits, so a slow server delays heartbeats rather than piling up
+// goroutines. The caller must wg.Add(1) for the loop itself so the per-send
+// Adds below never race the final wg.Wait.
+func runHeartbeats(sender Sender, interval time.Duration, limit int, done <-chan struct{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+	slots := make(chan struct{}, limit)
+	ticker := time.NewTicker(max(interval/time.Duration(numDevices), time.Millisecond))
+	defer ticker.Stop()
+
+	i := 0
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		device := i%numDevices + 1
+		if fleet != nil {
+			device = fleet.at(i)
+		}
+		i++
+		if isSilent(device) {
+			continue
+		}
+		select {
+		case <-done:
+			return
+		case slots <- struct{}{}:
+		}
+		wg.Add(1)
+		atomic.AddInt64(&heartbeatPending, 1)
+		go func(n int) {
+			defer wg.Done()
+			defer atomic.AddInt64(&heartbeatPending, -1)
+			defer func() { <-slots }()
+			if sendHeartbeat(sender, n) {
+				atomic.AddUint64(&heartbeatSent, 1)
+			} else {
+				atomic.AddUint64(&heartbeatFailed, 1)
+			}
+		}(device)
+	}
+}
+
+func sendHeartbeat(sender Sender, deviceNum int) bool {
+	name := deviceName("ESIN", deviceNum) // as Format 1 names it
+	body, err := json.Marshal(HeartbeatPayload{
+		DeviceType:  "heartbeat",
+		DeviceName:  name,
+		Timestamp:   deviceClock(deviceNum).Unix(),
+		PayloadMeta: PayloadMeta{RunID: runID},
+	})
+	if err != nil {
+		logError("heartbeat marshal failed", "device", deviceNum, "err", err)
+		return false
+	}
+	body = wireJSON(body)
+	msg := Message{Body: body, ContentType: contentTypeFor(heartbeatFormat), Device: name}
+	atomic.AddUint64(&totalBytes, uint64(len(body)))
+	if err := sender.Send(requestCtx, msg); err != nil {
+		logDebug("heartbeat failed", "device", deviceNum, "err", err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"testing"
+)
+
+// lastSender keeps the last message it's sent.
+type lastSender struct{ msg Message }
+
+func (s *lastSender) Send(_ context.Context, msg Message) error { s.msg = msg; return nil }
+func (s *lastSender) Close() error                              { return nil }
+
+// A heartbeat names its device as the device's telemetry does, locale and
+// all, so the backend can put the two together.
+func TestHeartbeatNamesDeviceAsTelemetry(t *testing.T) {
+	setupLocales([]string{"ascii", "cjk", "cyrillic"})
+	defer func() { payloadLocales, localeCounts = nil, nil }()
+	for d := 1; d <= 6; d++ {
+		var s lastSender
+		if !sendHeartbeat(&s, d) {
+			t.Fatalf("device %d: heartbeat failed", d)
+		}
+		var hb HeartbeatPayload
+		if err := json.Unmarshal(s.msg.Body, &hb); err != nil {
+			t.Fatal(err)
+		}
+		want := GenerateFormat(0, rand.New(rand.NewSource(1)), testNow, d).(*Format1Payload).DeviceName
+		if hb.DeviceName != want || s.msg.Device != want {
+			t.Errorf("device %d: heartbeat names it %q (message %q), telemetry %q", d, hb.DeviceName, s.msg.Device, want)
+		}
+	}
+}
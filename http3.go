@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// quicHandshakeTimeout bounds how long we wait on a server that may not
+// speak QUIC at all, so the failure says so instead of looking like a
+// generic request timeout. It is under the client timeout so it fires
+// first.
+const quicHandshakeTimeout = 2 * time.Second
+
+// QUIC connections opened with -http3, kept so their transport stats can
+// be read at the end of the run.
+var (
+	quicMu    sync.Mutex
+	quicConns []*quic.Conn
+)
+
+// checkHTTP3URLs rejects anything but https URLs; HTTP/3 has no cleartext
+// form.
+func checkHTTP3URLs(urls []string) error {
+	for _, u := range urls {
+		if !strings.HasPrefix(u, "https://") {
+			return fmt.Errorf("needs https:// endpoints, got %s", u)
+		}
+	}
+	return nil
+}
+
+// newHTTP3Transport returns an HTTP/3 round tripper that dials with early
+// data, so a resumed connection can use 0-RTT, and records every
+// connection it opens.
+func newHTTP3Transport(tlsConfig *tls.Config, sessions int) *http3.Transport {
+	cfg := &tls.Config{}
+	if tlsConfig != nil {
+		cfg = tlsConfig.Clone()
+	}
+	cfg.ClientSessionCache = tls.NewLRUClientSessionCache(sessions)
+	return &http3.Transport{
+		TLSClientConfig: cfg,
+		QUICConfig:      &quic.Config{HandshakeIdleTimeout: quicHandshakeTimeout},
+		Dial: func(ctx context.Context, addr string, tlsCfg *tls.Config, qcfg *quic.Config) (*quic.Conn, error) {
+			conn, err := quic.DialAddrEarly(ctx, addr, tlsCfg, qcfg)
+			if err != nil {
+				return nil, fmt.Errorf("%s doesn't answer HTTP/3 over UDP: %w", addr, err)
+			}
+			quicMu.Lock()
+			quicConns = append(quicConns, conn)
+			quicMu.Unlock()
+			go func() {
+				select {
+				case <-conn.HandshakeComplete():
+					recordTLS(conn.ConnectionState().TLS, nil)
+				case <-conn.Context().Done():
+				}
+			}()
+			return conn, nil
+		},
+	}
+}
+
+// printQUIC reports the QUIC connections behind an -http3 run. quic-go
+// migrates client connections only when asked to (Conn.AddPath), which we
+// never do, so there are no migrations to report.
+func printQUIC() {
+	quicMu.Lock()
+	defer quicMu.Unlock()
+	var zeroRTT int
+	var sent, lost uint64
+	var rtt time.Duration
+	versions := map[string]int{}
+	for _, c := range quicConns {
+		st := c.ConnectionState()
+		if st.Used0RTT {
+			zeroRTT++
+		}
+		versions[fmt.Sprint(st.Version)]++
+		cs := c.ConnectionStats()
+		sent += cs.PacketsSent
+		lost += cs.PacketsLost
+		rtt += cs.SmoothedRTT
+	}
+	fmt.Printf("   QUIC connections: %d | 0-RTT: %d", len(quicConns), zeroRTT)
+	if len(quicConns) > 0 {
+		fmt.Printf(" | mean smoothed RTT %v", (rtt / time.Duration(len(quicConns))).Round(time.Microsecond))
+	}
+	fmt.Println()
+	fmt.Printf("   QUIC packets: %d sent | %d lost (%.2f%%)\n", sent, lost, pct(lost, sent))
+	names := make([]string, 0, len(versions))
+	for v := range versions {
+		names = append(names, v)
+	}
+	sort.Strings(names)
+	for _, v := range names {
+		fmt.Printf("     %s: %d connections\n", v, versions[v])
+	}
+}
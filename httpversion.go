@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// httpVersionReport tallies the protocol each response came back on
+// (-http-version-report); proxies and load balancers can downgrade what
+// the client asked for without anything else noticing.
+var httpVersionReport bool
+
+var (
+	protoMu     sync.Mutex
+	protoCounts = map[string]uint64{} // resp.Proto -> responses
+)
+
+func recordProto(proto string) {
+	protoMu.Lock()
+	protoCounts[proto]++
+	protoMu.Unlock()
+}
+
+// requestedProto is the protocol rt will ask for. An http.Transport asks
+// for HTTP/2 only with -http2, which forces it on.
+func requestedProto(rt http.RoundTripper) string {
+	switch t := rt.(type) {
+	case *http3.Transport:
+		return "HTTP/3.0"
+	case *http.Transport:
+		if t.ForceAttemptHTTP2 {
+			return "HTTP/2.0"
+		}
+	}
+	return "HTTP/1.1"
+}
+
+// clientProtocols is what the http.Transport may speak for urls. Without
+// -http2 it is HTTP/1.1 alone, even on https:// where Go would otherwise
+// negotiate HTTP/2. With it, TLS endpoints offer HTTP/2 by ALPN and can
+// still fall back to HTTP/1.1, which the report then shows; cleartext has
+// nothing to negotiate with, so any http:// URL means HTTP/2 from the first
+// byte (h2c with prior knowledge).
+func clientProtocols(http2 bool, urls []string) *http.Protocols {
+	p := new(http.Protocols)
+	if !http2 {
+		p.SetHTTP1(true)
+		return p
+	}
+	p.SetHTTP2(true)
+	if slices.ContainsFunc(urls, func(u string) bool { return strings.HasPrefix(u, "http://") }) {
+		p.SetUnencryptedHTTP2(true)
+	} else {
+		p.SetHTTP1(true)
+	}
+	return p
+}
+
+func printHTTPVersions(requested string) {
+	protoMu.Lock()
+	defer protoMu.Unlock()
+	protos := make([]string, 0, len(protoCounts))
+	var total uint64
+	for p, n := range protoCounts {
+		protos = append(protos, p)
+		total += n
+	}
+	sort.Strings(protos)
+	fmt.Printf("   HTTP versions (requested %s):", requested)
+	if total == 0 {
+		fmt.Print(" no responses")
+	}
+	for _, p := range protos {
+		fmt.Printf(" %s %d (%.1f%%)", p, protoCounts[p], pct(protoCounts[p], total))
+	}
+	fmt.Println()
+	for _, p := range protos {
+		if p != requested {
+			fmt.Printf("   ⚠️  %d responses negotiated %s instead of %s\n", protoCounts[p], p, requested)
+		}
+	}
+}
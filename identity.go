@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"hash/maphash"
+	"math"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+)
+
+// hllPrecision gives 2^14 registers: 16KiB per counter and about 0.8%
+// standard error, however many distinct values go in.
+const hllPrecision = 14
+
+// hyperLogLog estimates the number of distinct strings added to it in
+// constant memory. Add is safe for concurrent use.
+type hyperLogLog struct {
+	seed maphash.Seed
+	regs [1 << hllPrecision]uint32
+}
+
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{seed: maphash.MakeSeed()}
+}
+
+func (h *hyperLogLog) Add(s string) {
+	x := maphash.String(h.seed, s)
+	i := x >> (64 - hllPrecision)
+	rank := uint32(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	for {
+		cur := atomic.LoadUint32(&h.regs[i])
+		if rank <= cur || atomic.CompareAndSwapUint32(&h.regs[i], cur, rank) {
+			return
+		}
+	}
+}
+
+// Estimate returns the approximate distinct count, using linear counting
+// while many registers are still empty, where it is far more accurate.
+func (h *hyperLogLog) Estimate() uint64 {
+	const m = float64(len(h.regs))
+	sum, zeros := 0.0, 0
+	for i := range h.regs {
+		r := atomic.LoadUint32(&h.regs[i])
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	est := alpha * m * m / sum
+	if est <= 2.5*m && zeros > 0 {
+		est = m * math.Log(m/float64(zeros))
+	}
+	return uint64(est + 0.5)
+}
+
+// maxCollisionTracking bounds the exact ID -> device map used to spot
+// collisions; past it new IDs are only counted, not checked.
+const maxCollisionTracking = 1 << 20
+
+// identityStats counts the distinct device names, device IDs and serial
+// numbers a run actually emitted, and IDs that showed up under more than
+// one device.
+type identityStats struct {
+	names, ids, serials *hyperLogLog
+
+	mu         sync.Mutex
+	idOwner    map[string]string // device ID -> first device seen with it
+	collided   map[string]bool
+	overflowed bool
+}
+
+var identities = &identityStats{
+	names:    newHyperLogLog(),
+	ids:      newHyperLogLog(),
+	serials:  newHyperLogLog(),
+	idOwner:  map[string]string{},
+	collided: map[string]bool{},
+}
+
+// note records one payload's identity; id and serial are empty for
+// formats that don't carry them.
+func (s *identityStats) note(name, id, serial string) {
+	s.names.Add(name)
+	if serial != "" {
+		s.serials.Add(serial)
+	}
+	if id == "" {
+		return
+	}
+	s.ids.Add(id)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	owner, ok := s.idOwner[id]
+	switch {
+	case !ok && len(s.idOwner) < maxCollisionTracking:
+		s.idOwner[id] = name
+	case !ok:
+		s.overflowed = true
+	case owner != name:
+		s.collided[id] = true
+	}
+}
+
+func (s *identityStats) printSummary() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Printf("   Identities (≈): %d device names | %d device IDs | %d serials\n",
+		s.names.Estimate(), s.ids.Estimate(), s.serials.Estimate())
+	note := ""
+	if s.overflowed {
+		note = fmt.Sprintf(" (only the first %d IDs checked)", maxCollisionTracking)
+	}
+	fmt.Printf("   ID collisions: %d device IDs shared by more than one device%s\n", len(s.collided), note)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+)
+
+// The base formats are marshaled by hand rather than through
+// encoding/json: at hundreds of records a second, reflecting over the same
+// structs was most of the time spent marshaling (BenchmarkMarshalFormat
+// sets each marshaler against json.Marshal). Every constant stretch of a payload (keys, braces,
+// device_type) is a literal below, so only the varying fields are
+// formatted per record. The output is byte for byte what json.Marshal
+// gives for the payload structs, which stay the reference for the field
+// names and order.
+
+// jsonBufSize fits a base-format record with every PayloadMeta field set.
+const jsonBufSize = 384
+
+func marshalFormat1(p *Format1Payload) []byte {
+	b := make([]byte, 0, jsonBufSize)
+	b = append(b, `{"device_type":`...)
+	b = appendJSONString(b, p.DeviceType)
+	b = append(b, `,"device_name":`...)
+	b = appendJSONString(b, p.DeviceName)
+	b = append(b, `,"device_id":`...)
+	b = appendJSONString(b, p.DeviceID)
+	b = append(b, `,"date":`...)
+	b = appendJSONString(b, p.Date)
+	b = append(b, `,"time":`...)
+	b = appendJSONString(b, p.Time)
+	b = append(b, `,"signal_strength":`...)
+	b = appendJSONString(b, p.SignalStrength)
+	b = append(b, `,"data":{"serial_no":`...)
+	b = appendJSONString(b, p.Data.SerialNo)
+	b = append(b, `,"s1v":`...)
+	b = strconv.AppendInt(b, int64(p.Data.S1V), 10)
+	b = append(b, `,"total_output_power":`...)
+	b = strconv.AppendInt(b, int64(p.Data.TotalOutputPower), 10)
+	b = append(b, `,"f":`...)
+	b = strconv.AppendInt(b, int64(p.Data.F), 10)
+	b = append(b, `,"today_e":`...)
+	b = strconv.AppendInt(b, int64(p.Data.TodayE), 10)
+	b = append(b, `,"total_e":`...)
+	b = strconv.AppendInt(b, int64(p.Data.TotalE), 10)
+	b = append(b, `,"inv_temp":`...)
+	b = strconv.AppendInt(b, int64(p.Data.InvTemp), 10)
+	b = append(b, `,"fault_code":`...)
+	b = strconv.AppendInt(b, int64(p.Data.FaultCode), 10)
+	b = append(b, '}')
+	return appendMeta(b, &p.PayloadMeta)
+}
+
+func marshalFormat2(p *Format2Payload) []byte {
+	b := make([]byte, 0, jsonBufSize)
+	b = append(b, `{"device_type":`...)
+	b = appendJSONString(b, p.DeviceType)
+	b = append(b, `,"device_name":`...)
+	b = appendJSONString(b, p.DeviceName)
+	b = append(b, `,"device_id":`...)
+	b = appendJSONString(b, p.DeviceID)
+	b = append(b, `,"data":{"serial_no":`...)
+	b = appendJSONString(b, p.Data.SerialNo)
+	b = append(b, `,"voltage_input":`...)
+	b = strconv.AppendInt(b, int64(p.Data.Voltage), 10)
+	b = append(b, `,"power_watts":`...)
+	b = strconv.AppendInt(b, int64(p.Data.PowerOutput), 10)
+	b = append(b, `,"freq_hz":`...)
+	b = strconv.AppendInt(b, int64(p.Data.Frequency), 10)
+	b = append(b, `,"energy_today_wh":`...)
+	b = strconv.AppendInt(b, int64(p.Data.DailyEnergy), 10)
+	b = append(b, `,"energy_total_kwh":`...)
+	b = strconv.AppendInt(b, int64(p.Data.TotalEnergy), 10)
+	b = append(b, `,"temp_celsius":`...)
+	b = strconv.AppendInt(b, int64(p.Data.Temperature), 10)
+	b = append(b, `,"error_code":`...)
+	b = strconv.AppendInt(b, int64(p.Data.ErrorCode), 10)
+	b = append(b, '}')
+	return appendMeta(b, &p.PayloadMeta)
+}
+
+func marshalFormat3(p *Format3Payload) []byte {
+	b := make([]byte, 0, jsonBufSize)
+	b = append(b, `{"device_type":`...)
+	b = appendJSONString(b, p.DeviceType)
+	b = append(b, `,"device_name":`...)
+	b = appendJSONString(b, p.DeviceName)
+	b = append(b, `,"device_id":`...)
+	b = appendJSONString(b, p.DeviceID)
+	b = append(b, `,"serial_no":`...)
+	b = appendJSONString(b, p.SerialNo)
+	b = append(b, `,"V":`...)
+	b = strconv.AppendInt(b, int64(p.V), 10)
+	b = append(b, `,"P":`...)
+	b = strconv.AppendInt(b, int64(p.P), 10)
+	b = append(b, `,"Hz":`...)
+	b = strconv.AppendInt(b, int64(p.Hz), 10)
+	b = append(b, `,"E_today":`...)
+	b = strconv.AppendInt(b, int64(p.EnergyDaily), 10)
+	b = append(b, `,"E_total":`...)
+	b = strconv.AppendInt(b, int64(p.EnergyTotal), 10)
+	b = append(b, `,"temp":`...)
+	b = strconv.AppendInt(b, int64(p.Temp), 10)
+	b = append(b, `,"status":`...)
+	b = strconv.AppendInt(b, int64(p.Status), 10)
+	return appendMeta(b, &p.PayloadMeta)
+}
+
+func marshalFormat4(p *Format4Payload) []byte {
+	b := make([]byte, 0, jsonBufSize)
+	b = append(b, `{"device_type":`...)
+	b = appendJSONString(b, p.DeviceType)
+	b = append(b, `,"device_name":`...)
+	b = appendJSONString(b, p.DeviceName)
+	b = append(b, `,"readings":{"voltage_mv":`...)
+	b = strconv.AppendInt(b, int64(p.Data.VoltageMillivolts), 10)
+	b = append(b, `,"power_kw":`...)
+	b = appendJSONFloat(b, p.Data.PowerKilowatts)
+	b = append(b, `,"frequency_hz":`...)
+	b = strconv.AppendInt(b, int64(p.Data.FreqHz), 10)
+	b = append(b, `,"today_kwh":`...)
+	b = appendJSONFloat(b, p.Data.TodayKwh)
+	b = append(b, `,"total_kwh":`...)
+	b = appendJSONFloat(b, p.Data.TotalKwh)
+	b = append(b, `,"temp_f":`...)
+	b = strconv.AppendInt(b, int64(p.Data.TempFahrenheit), 10)
+	b = append(b, `,"fault":`...)
+	b = strconv.AppendInt(b, int64(p.Data.FaultStatus), 10)
+	b = append(b, '}')
+	return appendMeta(b, &p.PayloadMeta)
+}
+
+// appendMeta appends m's fields the way embedding it does, omitempty
+// included, and closes the object.
+func appendMeta(b []byte, m *PayloadMeta) []byte {
+	if m.RunID != "" {
+		b = append(b, `,"run_id":`...)
+		b = appendJSONString(b, m.RunID)
+	}
+	if m.SchemaVersion != "" {
+		b = append(b, `,"schema_version":`...)
+		b = appendJSONString(b, m.SchemaVersion)
+	}
+	if m.Seq != 0 {
+		b = append(b, `,"seq":`...)
+		b = strconv.AppendUint(b, m.Seq, 10)
+	}
+	if g := m.DeviceGeo; g != nil {
+		b = append(b, `,"site_id":`...)
+		b = appendJSONString(b, g.SiteID)
+		b = append(b, `,"latitude":`...)
+		b = appendJSONFloat(b, g.Latitude)
+		b = append(b, `,"longitude":`...)
+		b = appendJSONFloat(b, g.Longitude)
+	}
+	return append(b, '}')
+}
+
+// appendJSONString quotes s. Plain ASCII, which is nearly every value, is
+// copied as is; anything encoding/json would escape (quotes, control and
+// HTML characters, non-ASCII from -payload-locale) goes through it.
+func appendJSONString(b []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c >= 0x7f || c == '"' || c == '\\' || c == '<' || c == '>' || c == '&' {
+			q, _ := json.Marshal(s) // a string always marshals
+			return append(b, q...)
+		}
+	}
+	b = append(b, '"')
+	b = append(b, s...)
+	return append(b, '"')
+}
+
+// appendJSONFloat formats f as encoding/json does: shortest form, in
+// exponent notation only for very small or large magnitudes. f must be
+// finite.
+func appendJSONFloat(b []byte, f float64) []byte {
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	b = strconv.AppendFloat(b, f, format, -1, 64)
+	if format == 'e' {
+		// e-09 to e-9, as encoding/json writes it
+		if n := len(b); n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	return b
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+)
+
+// prettyJSON sends indented bodies instead of compact ones (-pretty-json)
+var prettyJSON bool
+
+var compactBytes uint64 // what the bodies would have been without -pretty-json
+var prettyBytes uint64
+
+// wireJSON turns a compact marshaled body into what goes on the wire,
+// which is itself unless -pretty-json is set.
+func wireJSON(body []byte) []byte {
+	if !prettyJSON {
+		return body
+	}
+	var buf bytes.Buffer
+	buf.Grow(len(body) * 2)
+	if err := json.Indent(&buf, body, "", "  "); err != nil {
+		return body // not JSON we produced; leave it alone
+	}
+	atomic.AddUint64(&compactBytes, uint64(len(body)))
+	atomic.AddUint64(&prettyBytes, uint64(buf.Len()))
+	return buf.Bytes()
+}
+
+func printPrettySavings() {
+	c, p := atomic.LoadUint64(&compactBytes), atomic.LoadUint64(&prettyBytes)
+	if c == 0 {
+		return
+	}
+	fmt.Printf("   Pretty JSON: %s sent vs %s compact (+%.1f%%)\n",
+		formatBytes(int64(p)), formatBytes(int64(c)), (float64(p)/float64(c)-1)*100)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+)
+
+// fraction of payloads sent with object keys in random order
+// (-json-field-order-randomize)
+var shuffleKeys float64
+
+var (
+	shuffledSent     uint64
+	shuffledRejected uint64 // shuffled payloads the server answered non-200
+	orderedSent      uint64
+	orderedRejected  uint64
+)
+
+// shuffleKeyOrder re-encodes body with the keys of every object, nested
+// ones included, in a fresh random order. encoding/json always writes
+// struct fields in declaration order and map keys sorted, so this writes
+// the objects itself.
+func shuffleKeyOrder(body []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.Grow(len(body))
+	if err := writeShuffled(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeShuffled(buf *bytes.Buffer, v any) error {
+	switch v := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		rng.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			kb, _ := json.Marshal(k)
+			buf.Write(kb)
+			buf.WriteByte(':')
+			if err := writeShuffled(buf, v[k]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case []any:
+		buf.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeShuffled(buf, e); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+	}
+	return nil
+}
+
+// noteKeyOrder records whether the server rejected a shuffled or an
+// in-order payload, so the two rejection rates can be compared.
+func noteKeyOrder(shuffled, rejected bool) {
+	sent, rej := &orderedSent, &orderedRejected
+	if shuffled {
+		sent, rej = &shuffledSent, &shuffledRejected
+	}
+	atomic.AddUint64(sent, 1)
+	if rejected {
+		atomic.AddUint64(rej, 1)
+	}
+}
+
+func printKeyOrder() {
+	ss, sr := atomic.LoadUint64(&shuffledSent), atomic.LoadUint64(&shuffledRejected)
+	osent, orej := atomic.LoadUint64(&orderedSent), atomic.LoadUint64(&orderedRejected)
+	fmt.Printf("   Shuffled key order: %d sent | %d rejected (%.2f%%) vs %.2f%% of in-order payloads\n",
+		ss, sr, pct(sr, ss), pct(orej, osent))
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// Running latency totals for live displays. windowMax is reset by whoever
+// samples it, so it means "worst since the last look".
+var (
+	latencySumNs       int64
+	latencyCount       int64
+	latencyWindowMaxNs int64
+)
+
+func recordLatency(d time.Duration) {
+	latencyHist.Record(d)
+	if sla != nil {
+		sla.record(d)
+	}
+	atomic.AddInt64(&latencySumNs, int64(d))
+	atomic.AddInt64(&latencyCount, 1)
+	for {
+		cur := atomic.LoadInt64(&latencyWindowMaxNs)
+		if int64(d) <= cur || atomic.CompareAndSwapInt64(&latencyWindowMaxNs, cur, int64(d)) {
+			return
+		}
+	}
+}
+
+// Histogram is a lock-free latency histogram with log-spaced buckets:
+// histSubBuckets per power of two of microseconds, i.e. about 4.4%
+// resolution, covering 1µs to ~18 minutes.
+type Histogram struct {
+	counts [histBuckets]uint64
+	maxNs  int64
+}
+
+const (
+	histSubBuckets = 16
+	histBuckets    = 30 * histSubBuckets
+)
+
+// latencyHist collects every request's latency for percentile reporting;
+// failedLatencyHist also gets those that failed, so a failure spike can be
+// told apart as fast rejections or timeouts.
+var (
+	latencyHist       = &Histogram{}
+	failedLatencyHist = &Histogram{}
+)
+
+func (h *Histogram) Record(d time.Duration) {
+	atomic.AddUint64(&h.counts[histBucket(d)], 1)
+	for {
+		cur := atomic.LoadInt64(&h.maxNs)
+		if int64(d) <= cur || atomic.CompareAndSwapInt64(&h.maxNs, cur, int64(d)) {
+			return
+		}
+	}
+}
+
+func histBucket(d time.Duration) int {
+	us := float64(d) / float64(time.Microsecond)
+	if us <= 1 {
+		return 0
+	}
+	return min(int(math.Log2(us)*histSubBuckets), histBuckets-1)
+}
+
+// bucketUpper is the largest latency that lands in bucket i.
+func bucketUpper(i int) time.Duration {
+	return time.Duration(math.Exp2(float64(i+1)/histSubBuckets) * float64(time.Microsecond))
+}
+
+func (h *Histogram) Count() uint64 {
+	var n uint64
+	for i := range h.counts {
+		n += atomic.LoadUint64(&h.counts[i])
+	}
+	return n
+}
+
+// Quantile returns the latency below which q (0-1) of the samples fall,
+// accurate to one bucket. The top of the range is reported as the exact max.
+func (h *Histogram) Quantile(q float64) time.Duration {
+	n := h.Count()
+	if n == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(n)))
+	var seen uint64
+	for i := range h.counts {
+		seen += atomic.LoadUint64(&h.counts[i])
+		if seen >= rank {
+			return min(bucketUpper(i), h.Max())
+		}
+	}
+	return h.Max()
+}
+
+// CountBelow returns how many samples were at most d, accurate to one
+// bucket.
+func (h *Histogram) CountBelow(d time.Duration) uint64 {
+	var n uint64
+	for i := range h.counts {
+		if bucketUpper(i) > d {
+			break
+		}
+		n += atomic.LoadUint64(&h.counts[i])
+	}
+	return n
+}
+
+func (h *Histogram) Max() time.Duration {
+	return time.Duration(atomic.LoadInt64(&h.maxNs))
+}
+
+// Reset clears the histogram. Only meaningful while nothing is recording.
+func (h *Histogram) Reset() {
+	for i := range h.counts {
+		atomic.StoreUint64(&h.counts[i], 0)
+	}
+	atomic.StoreInt64(&h.maxNs, 0)
+}
+
+// AddTo adds h's samples into dst.
+func (h *Histogram) AddTo(dst *Histogram) {
+	for i := range h.counts {
+		if n := atomic.LoadUint64(&h.counts[i]); n > 0 {
+			atomic.AddUint64(&dst.counts[i], n)
+		}
+	}
+	if m := atomic.LoadInt64(&h.maxNs); m > atomic.LoadInt64(&dst.maxNs) {
+		atomic.StoreInt64(&dst.maxNs, m)
+	}
+}
+
+func printLatency() {
+	fmt.Printf("   Latency: p50 %v | p90 %v | p99 %v | max %v | %d requests\n",
+		latencyHist.Quantile(0.50).Round(time.Microsecond), latencyHist.Quantile(0.90).Round(time.Microsecond),
+		latencyHist.Quantile(0.99).Round(time.Microsecond), latencyHist.Max().Round(time.Microsecond),
+		latencyHist.Count())
+	if n := failedLatencyHist.Count(); n > 0 {
+		fmt.Printf("     failed only: p50 %v | p90 %v | p99 %v | max %v | %d requests\n",
+			failedLatencyHist.Quantile(0.50).Round(time.Microsecond), failedLatencyHist.Quantile(0.90).Round(time.Microsecond),
+			failedLatencyHist.Quantile(0.99).Round(time.Microsecond), failedLatencyHist.Max().Round(time.Microsecond), n)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// localeWords is the word each -payload-locale puts into device names.
+// They cover the ways a UTF-8 path usually breaks: multi-byte CJK,
+// two-byte Cyrillic, right-to-left Arabic, four-byte emoji with variation
+// selectors, and a combining accent that a normalizing server turns into
+// a different byte sequence.
+var localeWords = map[string]string{
+	"ascii":     "",
+	"cjk":       "逆变器",
+	"cyrillic":  "Инвертор",
+	"arabic":    "عاكس",
+	"emoji":     "☀️⚡",
+	"combining": "Inve\u0301rter", // e + U+0301, not precomposed é
+}
+
+// payloadLocales are the locales device names are drawn from, nil for
+// plain ASCII names.
+var (
+	payloadLocales []string
+	localeCounts   []uint64 // sends per locale
+)
+
+func parseLocales(s string) ([]string, error) {
+	var locales []string
+	for _, l := range strings.Split(s, ",") {
+		l = strings.ToLower(strings.TrimSpace(l))
+		if _, ok := localeWords[l]; !ok {
+			return nil, fmt.Errorf("unknown locale %q (want %s)", l, strings.Join(knownLocales(), ", "))
+		}
+		locales = append(locales, l)
+	}
+	return locales, nil
+}
+
+func knownLocales() []string {
+	names := make([]string, 0, len(localeWords))
+	for l := range localeWords {
+		names = append(names, l)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func setupLocales(locales []string) {
+	payloadLocales = locales
+	localeCounts = make([]uint64, len(locales))
+}
+
+// deviceName builds a device's name from its format's prefix. With
+// -payload-locale each device keeps one locale for the whole run, picked
+// by a hash of its number, so identity counts stay meaningful.
+func deviceName(prefix string, deviceNum int) string {
+	if payloadLocales == nil {
+		return fmt.Sprintf("%s%d", prefix, deviceNum)
+	}
+	return fmt.Sprintf("%s%s%d", prefix, localeWords[payloadLocales[localeOf(deviceNum)]], deviceNum)
+}
+
+func localeOf(deviceNum int) int {
+	return int(splitmix64(uint64(deviceNum)) % uint64(len(payloadLocales)))
+}
+
+// noteLocale counts one record sent under its device's locale.
+func noteLocale(deviceNum int) {
+	if payloadLocales != nil {
+		atomic.AddUint64(&localeCounts[localeOf(deviceNum)], 1)
+	}
+}
+
+func printLocales() {
+	fmt.Print("   Locales:")
+	for i, l := range payloadLocales {
+		fmt.Printf(" %s %d", l, atomic.LoadUint64(&localeCounts[i]))
+	}
+	fmt.Println()
+}
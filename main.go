@@ -1,16 +1,34 @@
 package main
 
 import (
-	"bytes"
+	"cmp"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"math/rand"
 	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// PayloadMeta carries simulator-level tags shared by every format. It is
+// embedded last in each payload so the device's own fields keep their order.
+type PayloadMeta struct {
+	RunID         string `json:"run_id,omitempty"`
+	SchemaVersion string `json:"schema_version,omitempty"`
+	Seq           uint64 `json:"seq,omitempty"` // per-device, with -device-seq
+	*DeviceGeo
+}
+
 // ✅ Format 1: Your current format (nested data)
 type Format1Payload struct {
 	DeviceType     string `json:"device_type"`
@@ -29,6 +47,7 @@ type Format1Payload struct {
 		InvTemp          int    `json:"inv_temp"`
 		FaultCode        int    `json:"fault_code"`
 	} `json:"data"`
+	PayloadMeta
 }
 
 // ✅ Format 2: Different field names (nested)
@@ -46,6 +65,7 @@ type Format2Payload struct {
 		Temperature int    `json:"temp_celsius"`
 		ErrorCode   int    `json:"error_code"`
 	} `json:"data"`
+	PayloadMeta
 }
 
 // ✅ Format 3: Flat structure (no nested data)
@@ -61,6 +81,7 @@ type Format3Payload struct {
 	EnergyTotal int    `json:"E_total"` // ✅ DIFFERENT
 	Temp        int    `json:"temp"`
 	Status      int    `json:"status"`
+	PayloadMeta
 }
 
 // ✅ Format 4: Mixed with units in field names
@@ -76,74 +97,1495 @@ type Format4Payload struct {
 		TempFahrenheit    int     `json:"temp_f"`    // ✅ FAHRENHEIT!
 		FaultStatus       int     `json:"fault"`
 	} `json:"readings"`
+	PayloadMeta
 }
 
+// numDevices is the size of the simulated fleet (-devices)
+var numDevices = 50
+
 var totalSent uint64
-var formatCounts [4]uint64 // Track sends per format
+var totalFailed uint64
+var formatCounts [numFormats]uint64 // Track sends per format
+var formatFailed [numFormats]uint64 // failed sends per format
+var totalBytes uint64               // marshaled bytes handed to the transport
+var maxBytes byteSize               // -max-bytes, 0 = no cap
+var maxRecords uint64               // -max-records, 0 = no cap
+var recordsStarted uint64           // records a worker has begun sending, counted against maxRecords
+var results *ResultsWriter          // per-request CSV, nil unless -results-csv
+var runID string                    // tags every payload and request of this run
+var clockSkew time.Duration         // fleet-wide offset applied to every device timestamp
+var cfg = defaultConfig()           // value ranges, from -config
+
+// stopReached reports whether a stop condition other than the duration has
+// been hit (a signal, -max-bytes or -max-records), so the send loops can end
+// the run early.
+func stopReached() bool {
+	return interrupted.Load() || maxBytes > 0 && atomic.LoadUint64(&totalBytes) >= uint64(maxBytes) ||
+		maxRecords > 0 && atomic.LoadUint64(&recordsStarted) >= maxRecords
+}
+
+// deviceNow is the time as the simulated devices believe it to be.
+func deviceNow() time.Time {
+	return simNow().Add(clockSkew)
+}
+
 func main() {
-	endpoint := "http://localhost:8080/api/data"
-	rate := 600
-	runDuration := 15 * time.Minute
+	var (
+		endpoint    string
+		rate        int
+		runDuration time.Duration
+	)
+	flag.StringVar(&endpoint, "endpoint", "http://localhost:8080/api/data", "URL to POST records to")
+	endpointsSpec := flag.String("endpoints", "", "comma-separated replica URLs to spread requests over instead of -endpoint, e.g. http://ingest-1/api/data,http://ingest-2/api/data")
+	endpointPick := flag.String("endpoint-pick", "round-robin", "how -endpoints picks each request's replica: round-robin or random")
+	flag.IntVar(&rate, "rate", 600, "records per second")
+	flag.DurationVar(&runDuration, "duration", 15*time.Minute, "how long to run, e.g. 30m")
+	transportName := flag.String("transport", "http", "how records leave: http (POST to -endpoint), mqtt (publish to -mqtt-topic on -mqtt-broker), udp (one datagram each to -udp-addr) or ws (one message each over a WebSocket to -ws-url)")
+	wsURL := flag.String("ws-url", "ws://localhost:8080/stream", "WebSocket URL for -transport ws")
+	udpAddr := flag.String("udp-addr", "localhost:8125", "host:port for -transport udp")
+	mqttBroker := flag.String("mqtt-broker", "tcp://localhost:1883", "broker URL for -transport mqtt")
+	mqttTopic := flag.String("mqtt-topic", "solar/telemetry", "topic -transport mqtt publishes to")
+	mqttQoS := flag.Int("mqtt-qos", 1, "MQTT QoS (0-2); at 1 and 2 a record only counts as sent once the broker acknowledges it")
+	mqttClientID := flag.String("mqtt-client-id", "", "MQTT client ID (default: solar-sim- plus the start of the run ID)")
+	mqttWillPrefix := flag.String("mqtt-will-prefix", "", "give every device its own MQTT session with a Last-Will on PREFIX/<device name>, e.g. solar/status (\"\" = one shared session, no will)")
+	mqttDropFraction := flag.Float64("mqtt-drop-fraction", 0, "fraction (0-1) of connected device sessions to drop abruptly, without a DISCONNECT, every -mqtt-drop-interval so the broker publishes their wills; needs -mqtt-will-prefix")
+	mqttDropInterval := flag.Duration("mqtt-drop-interval", 10*time.Second, "how often -mqtt-drop-fraction drops sessions")
+	flag.Float64Var(&fieldsSubset, "fields-subset", 0, "fraction (0-1) of payloads that omit some optional fields")
+	statsCSV := flag.String("stats-csv", "", "append one CSV row per second to this file: sent and failed that second, running totals and records in flight")
+	resultsCSV := flag.String("results-csv", "", "write one CSV row per request to this file (heavy at high rates)")
+	perDeviceInterval := flag.Duration("per-device-interval", 0, "schedule each device to report every interval (with jitter) instead of a global rate")
+	heartbeatInterval := flag.Duration("heartbeat-interval", 0, "send a heartbeat per device at this interval, alongside telemetry (0 = off)")
+	workers := flag.Int("workers", 0, "number of concurrent senders (0 = size automatically from the rate)")
+	timeout := flag.Duration("timeout", 3*time.Second, "how long one request may take, connecting and reading the response included")
+	shutdownGrace := flag.Duration("shutdown-grace", 2*time.Second, "on the first Ctrl-C, how long in-flight requests get to finish before they are aborted")
+	maxIdleConns := flag.Int("max-idle-conns", 0, "idle keep-alive connections kept across all hosts (0 = one per worker)")
+	maxIdlePerHost := flag.Int("max-idle-per-host", 0, "idle keep-alive connections kept per host (0 = one per worker)")
+	tui := flag.Bool("tui", false, "show a live terminal dashboard (falls back to periodic stats lines when stdout isn't a TTY)")
+	flag.BoolVar(&verifyEcho, "verify-echo", false, "expect the server to echo each record and count mangled fields as corrupted")
+	flag.StringVar(&serverTimeField, "server-time-field", "", "response field holding the server's receive time, e.g. received_at_ns; reports ingestion lag")
+	flag.BoolVar(&strictSchema, "strict-schema", false, "fail responses whose fields drift from what was sent plus the config's response_fields")
+	configPath := flag.String("config", "", "JSON file with per-field value ranges (see Config)")
+	var ranges rangeFlag
+	flag.Var(&ranges, "range", "override one value range, in -config units: NAME=MIN:MAX or NAME=MIN:MAX:NOMINAL for a normal draw peaking at NOMINAL, e.g. power=4000:5000:4800 (repeatable; names: "+strings.Join(rangeNames, ", ")+")")
+	flag.Var(&maxBytes, "max-bytes", "stop once this much payload data has been sent, e.g. 500MB or 10GiB (0 = no cap)")
+	flag.Uint64Var(&maxRecords, "max-records", 0, "stop once this many records have been sent or failed, or at -duration if that comes first (0 = no cap)")
+	flag.StringVar(&contentTypeOverride, "content-type", "", "send every request with this Content-Type instead of each format's own")
+	flag.DurationVar(&clockSkew, "clock-skew", 0, "shift every device timestamp by this offset, e.g. -90s or 2h")
+	flag.DurationVar(&deviceSkewMax, "device-clock-skew", 0, "give each device its own fixed clock offset of up to this much, behind unless -device-clock-future, e.g. 2h (on top of -clock-skew)")
+	flag.Float64Var(&deviceSkewFuture, "device-clock-future", 0, "fraction (0-1) of -device-clock-skew devices whose clocks run ahead, sending timestamps in the future")
+	flag.StringVar(&runID, "run-id", "", "tag every payload (run_id) and request (X-Run-ID) with this ID (default: random UUID)")
+	mix := flag.String("schema-mix", "", "percent of devices on schema v1,v2[,v3], e.g. 70,20,10 (adds schema_version to payloads)")
+	flag.BoolVar(&prettyJSON, "pretty-json", false, "send indented JSON bodies (for inspecting traffic in a proxy)")
+	noKeepAlive := flag.Bool("no-keepalive", false, "open a fresh connection for every request (stresses the server's accept path)")
+	geo := flag.Bool("geo", false, "group devices under sites and add site_id/latitude/longitude to payloads (sites from -config or built in)")
+	requireAck := flag.Bool("require-ack", false, "at-least-once delivery: retry sends not acked within -ack-timeout and count duplicates")
+	ackTimeout := flag.Duration("ack-timeout", time.Second, "how long to wait for an ack before resending (with -require-ack)")
+	ackRetries := flag.Int("ack-retries", 3, "resends per message before giving up (with -require-ack)")
+	retries := flag.Int("retries", 0, "resend a record that failed transiently (no answer, 429 or 5xx) up to this many times; it only counts as failed once they run out")
+	retryBackoff := flag.Duration("retry-backoff", 100*time.Millisecond, "wait before the first -retries resend; it doubles per retry, with jitter, up to 5s")
+	sweep := flag.String("sweep", "", "run these rates back-to-back, e.g. 100,200,400,800 (replaces the single-rate run)")
+	sweepStep := flag.Duration("sweep-step", time.Minute, "how long each -sweep rate runs")
+	sweepCooldown := flag.Duration("sweep-cooldown", 5*time.Second, "pause between -sweep steps and -protocol-compare transports")
+	bench := flag.Bool("bench", false, "find the server's sustainable capacity: binary-search the highest rate meeting -bench-max-error and -bench-p99, -bench-reps times")
+	benchMin := flag.Int("bench-min", 50, "lowest rate -bench searches")
+	benchMax := flag.Int("bench-max", 5000, "highest rate -bench searches")
+	benchStep := flag.Duration("bench-step", 10*time.Second, "how long each -bench probe runs")
+	benchMaxError := flag.Float64("bench-max-error", 0.01, "highest error rate (0-1) a -bench probe may have and still pass")
+	benchP99 := flag.Duration("bench-p99", 0, "highest p99 a -bench probe may have and still pass (default: -sla-p99, else 500ms)")
+	benchReps := flag.Int("bench-reps", 3, "independent -bench searches, for a confidence interval")
+	benchJSON := flag.String("bench-json", "", "also write the -bench probes and result as JSON to this file")
+	sweepJSON := flag.String("sweep-json", "", "also write the -sweep results table as JSON to this file")
+	compare := flag.String("protocol-compare", "", "run the same workload against each transport in turn, e.g. a=http://host1/api/data,b=mqtt://broker:1883/solar/telemetry,c=udp://host:8125,d=ws://host/stream")
+	compareStep := flag.Duration("compare-step", time.Minute, "how long each -protocol-compare transport runs")
+	seed := flag.Int64("seed", 0, "seed for every random choice, so a run's payloads can be reproduced (default: from the clock; the exact order only repeats with -workers 1)")
+	compareSeed := flag.Int64("compare-seed", 1, "seed for the workload every -protocol-compare transport is sent")
+	compareJSON := flag.String("compare-json", "", "also write the -protocol-compare table as JSON to this file")
+	flag.Float64Var(&shuffleKeys, "json-field-order-randomize", 0, "fraction (0-1) of payloads sent with JSON keys in random order (flushes out order-sensitive parsers)")
+	flag.BoolVar(&httpVersionReport, "http-version-report", false, "tally the HTTP version of every response and warn when it isn't the one requested")
+	useHTTP2 := flag.Bool("http2", false, "send over HTTP/2: negotiated on https:// endpoints, spoken directly (h2c) on http:// ones; reports the versions negotiated (default: HTTP/1.1)")
+	useHTTP3 := flag.Bool("http3", false, "send over HTTP/3 (QUIC) instead of HTTP/1.1; needs https:// endpoints")
+	var extraHeaders headerFlag
+	flag.Var(&extraHeaders, "header", "add this \"Key: Value\" header to every request; repeatable")
+	bearerToken := flag.String("bearer-token", "", "send Authorization: Bearer TOKEN on every request (default: $"+bearerTokenEnv+", which keeps it out of shell history)")
+	clientCert := flag.String("client-cert", "", "PEM client certificate to present for mutual TLS (needs -client-key)")
+	clientKey := flag.String("client-key", "", "PEM private key for -client-cert")
+	caCert := flag.String("ca-cert", "", "PEM CA bundle to verify the server against instead of the system roots")
+	minTLS := flag.String("min-tls", "", "refuse TLS below this version (1.0-1.3) on https endpoints; negotiated versions and ciphers are reported either way")
+	drainTimeout := flag.Duration("drain-timeout", 0, "after the run, wait at most this long for in-flight requests, then report them as abandoned and exit 1 (0 = wait forever)")
+	silent := flag.String("silent-devices", "", "devices that stop sending entirely after -silent-after, e.g. 3,7,12 (for missing-data alerts)")
+	silentAfter := flag.Duration("silent-after", 5*time.Minute, "offset into the run at which -silent-devices go quiet")
+	flag.Var(&disabledFormats, "disable-format", "don't send this format (1-5); repeatable, the others share its traffic")
+	flag.Var(&enabledOptIn, "enable-format", "also send this opt-in format; repeatable. 5 is Format 1 as protobuf (application/x-protobuf, see format5.proto)")
+	weightsSpec := flag.String("weights", "", "pick each record's format by weighted random draw from these per-format percentages, e.g. 70,15,10,5 (default: even rotation)")
+	rampSpec := flag.String("format-ramp", "", "shift the format mix linearly over the run from one set of percentages to another, e.g. 100,0,0,0:50,50,0,0")
+	bodyFile := flag.String("body-file", "", "send this file's exact contents as every request body instead of generated payloads")
+	bodyStdin := flag.Bool("body-from-stdin", false, "like -body-file, reading the body from stdin")
+	userAgent := flag.String("user-agent", "", "send this User-Agent instead of Go's default")
+	userAgentFile := flag.String("user-agent-file", "", "draw each request's User-Agent from this file, one per line")
+	twoPhaseBatch := flag.Int("two-phase-batch", 0, "deliver records in batches of this size through a prepare/commit protocol (0 = single POSTs)")
+	twoPhasePrepare := flag.String("two-phase-prepare-url", "", "prepare URL for -two-phase-batch (default: -endpoint + /prepare)")
+	twoPhaseCommit := flag.String("two-phase-commit-url", "", "commit URL for -two-phase-batch (default: -endpoint + /commit)")
+	twoPhaseToken := flag.String("two-phase-token-field", "token", "dotted path of the commit token in the prepare answer; the commit sends it back under the same name")
+	twoPhaseLinger := flag.Duration("two-phase-linger", 100*time.Millisecond, "how long a partial -two-phase-batch waits for more records before it is sent anyway")
+	batchSize := flag.Int("batch", 0, "send records N at a time, across formats, as one JSON array POSTed to -batch-url (0 = one record per POST); Sent and Failed still count records")
+	batchURL := flag.String("batch-url", "", "URL for -batch (default: -endpoint + /batch)")
+	batchLinger := flag.Duration("batch-linger", 100*time.Millisecond, "how long a partial -batch waits for more records before it is sent anyway")
+	stream := flag.Bool("stream", false, "stream every record as a newline-delimited JSON line through one long chunked POST to -stream-url, restarting it if the server ends it early")
+	streamURL := flag.String("stream-url", "", "URL for -stream (default: -endpoint + /stream)")
+	streamFlush := flag.Duration("stream-flush", 500*time.Millisecond, "how often -stream flushes buffered records into the request body")
+	twoPhaseAbort := flag.Float64("two-phase-abort", 0, "fraction (0-1) of -two-phase-batch batches prepared but never committed, like a producer crashing between the phases")
+	var serialTpl serialTemplateFlag
+	formatsPath := flag.String("formats", "", "JSON file defining up to 5 custom payload formats to send instead of the built-in ones (see CustomFormat)")
+	flag.Var(&serialTpl, "serial-template", "serial pattern, e.g. {type}-{year}-{seq:06d}; N=PATTERN sets format N only (repeatable). Fields: type, year, seq, format, hex")
+	rampUp := flag.Duration("ramp", 0, "raise the rate linearly from 0 to -rate over this long at the start, e.g. 30s; the summary splits records sent while ramping from those at the steady rate")
+	throttleRamp := flag.Bool("graceful-ramp-on-throttle", false, "lower the rate when the server answers 429 and probe back up once it stops, settling just under its limit")
+	locales := flag.String("payload-locale", "", "draw device names from these scripts to stress Unicode handling, e.g. cjk,cyrillic,arabic,emoji,combining,ascii")
+	flag.Float64Var(&headerChaos, "header-chaos", 0, "fraction (0-1) of requests sent with malformed headers: wrong or missing content-type, duplicates, oversized values")
+	maxOpenFiles := flag.Uint64("max-open-files", 0, "raise the open-file soft limit to this at startup (0 = raise it only as far as the worker pool needs, when allowed)")
+	summaryJSON := flag.String("summary-json", "", "also write the end-of-run summary as JSON to this file, for CI gates")
+	logLevelName := flag.String("log-level", "info", "least severe run-time event logged to stderr: debug (adds every failed request), info, warn or error")
+	logFormat := flag.String("log-format", "text", "run-time log lines as "+strings.Join(logFormats, " or ")+" (json for log pipelines)")
+	summaryFormat := flag.String("summary-format", "rich", "end-of-run summary as "+strings.Join(summaryFormats, ", ")+" (oneline and json print a single line)")
+	statePath := flag.String("state-file", "", "keep per-device state (lifetime energy, serials, sequence numbers) in this file and resume from it on the next run")
+	stateInterval := flag.Duration("state-interval", 30*time.Second, "how often -state-file is snapshotted")
+	flag.BoolVar(&diurnal, "diurnal", false, "make power follow a daily sine curve on the simulated clock (zero at night, peak at noon), with daily and total energy integrated from it")
+	simStartFlag := flag.String("sim-start", "", "start the simulated clock devices report at this time, e.g. 2025-06-21T05:00 or 05:00 (default: now)")
+	flag.Float64Var(&timeScale, "time-scale", 1, "run the simulated clock this many times faster than real time, e.g. 96 for a day in 15 minutes")
+	flag.IntVar(&energyResetHour, "energy-reset-hour", energyResetHour, "local hour (0-23) at which each device's daily energy counter resets (-1 = draw daily energy at random per record)")
+	pushgateway := flag.String("pushgateway-url", "", "push the final metrics to this Prometheus Pushgateway, e.g. http://pushgateway:9091")
+	pushJob := flag.String("pushgateway-job", "solar_client", "job label for -pushgateway-url")
+	metricsAddr := flag.String("metrics-addr", "", "serve live Prometheus metrics on this address during the run, e.g. :9100 (scrape /metrics)")
+	scenarioPath := flag.String("fault-scenario", "", "YAML file of scripted faults (device, code, start, duration) that override the random fault model")
+	doPreflight := flag.Bool("preflight", true, "send one record of each active format before the run and abort if the server rejects any")
+	noPreflight := flag.Bool("no-preflight", false, "skip the preflight (same as -preflight=false)")
+	smoke := flag.Bool("smoke", false, "send one record of each active format, print each answer's status and body, and exit: 0 if all were accepted, 1 if not")
+	flag.Var(&attachmentSize, "attachment-size", "post each payload as multipart/form-data with a random attachment of this size, e.g. 64KB (0 = plain JSON)")
+	replayPath := flag.String("replay", "", "replay the timing, formats and devices of a -results-csv recording, or the exact payloads of a -record-failures capture (replaces the single-rate run); a .ndjson file of captured payloads, one per line, is sent in order at -rate instead of generating")
+	replayLoop := flag.Bool("replay-loop", false, "start a .ndjson -replay over when it runs out, until -duration (default: stop at its end)")
+	flag.Float64Var(&faultRate, "fault-rate", faultRate, "fraction (0-1) of records that carry a random fault code; with -fault-mean-duration, the chance per record that a healthy device goes into fault")
+	flag.DurationVar(&faultMeanDuration, "fault-mean-duration", 0, "make random faults bursts: a faulted device keeps its code for a random stretch with this mean, e.g. 2m (0 = independent per record)")
+	flag.Float64Var(&signalDropoutRate, "signal-dropout-rate", signalDropoutRate, "fraction (0-1) of Format 1 reports sent during a signal dropout, with signal_strength -1 or very weak")
+	faultCodeList := flag.String("fault-codes", "1,2,3,4,5", "fault codes random faults are drawn from, evenly, e.g. 3 to pin one")
+	dryRunFlag := flag.Bool("dry-run", false, "write each payload, pretty-printed, to -dry-run-out instead of sending it; every send counts as a success")
+	dryRunOut := flag.String("dry-run-out", "-", "file for -dry-run payloads (- = stdout)")
+	failuresPath := flag.String("record-failures", "", "write each failed or rejected send, with its status, error and exact payload, to this JSONL file")
+	replaySpeed := flag.Float64("replay-speed", 1, "time compression for -replay: 10 replays ten times faster, 0.5 at half speed")
+	replayWindow := flag.String("replay-window", "", "replay only this slice of the recording, as start:end offsets, e.g. 2h:3h")
+	flag.BoolVar(&assertDistribution, "assert-distribution", false, "check after the run that each generated field's mean and spread match its configured range; exit 1 on drift")
+	flag.BoolVar(&deviceSeq, "device-seq", false, "tag records with a per-device seq and count deliveries that complete out of order")
+	flag.BoolVar(&partitionByDevice, "partition-by-device", false, "pin each device to one worker so its records are delivered in order (implies -device-seq)")
+	slaP99 := flag.Duration("sla-p99", 0, "warn live when the p99 latency over -sla-window exceeds this, e.g. 250ms (0 = off)")
+	slaWindow := flag.Duration("sla-window", 10*time.Second, "sliding window for -sla-p99")
+	slaWebhook := flag.String("sla-webhook", "", "also POST a JSON event here on every -sla-p99 breach and recovery")
+	flag.BoolVar(&gzipBodies, "gzip", false, "gzip each record's body and send it with Content-Encoding: gzip; the summary reports the compression ratio per format")
+	flag.BoolVar(&payloadChecksum, "payload-checksum", false, "add a CRC32 checksum field over each payload's canonical form (checked on echoes with -verify-echo)")
+	flag.IntVar(&numDevices, "devices", numDevices, "number of simulated devices; each keeps one name, ID and serial for the whole run")
+	flag.IntVar(&deviceIDRange, "device-id-range", deviceIDRange, "device IDs and serials are drawn from 1..N; below -devices, devices share IDs")
+	churn := flag.Float64("devices-churn", 0, "fraction of the fleet that leaves or joins (with new device IDs) per minute, e.g. 0.1 (0 = fixed fleet)")
+	flag.Parse()
+
+	if err := setupLogging(*logLevelName, *logFormat); err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		os.Exit(2)
+	}
+	if runID == "" {
+		runID = newUUID()
+	}
+	seeded := false
+	flag.Visit(func(f *flag.Flag) { seeded = seeded || f.Name == "seed" })
+	if !seeded {
+		*seed = time.Now().UnixNano()
+	}
+	seedRandom(*seed)
+	var err error
+	if cfg, err = loadConfig(*configPath); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ config:", err)
+		os.Exit(2)
+	}
+	if err := ranges.apply(&cfg); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ -range:", err)
+		os.Exit(2)
+	}
+
+	var endpointURLs []string
+	switch *transportName {
+	case "http":
+		if *endpointsSpec != "" {
+			endpointSet := false
+			flag.Visit(func(f *flag.Flag) { endpointSet = endpointSet || f.Name == "endpoint" })
+			if endpointSet {
+				fmt.Fprintln(os.Stderr, "❌ -endpoint and -endpoints can't be combined; list every replica in -endpoints")
+				os.Exit(2)
+			}
+			if endpointURLs, err = parseEndpoints(*endpointsSpec); err != nil {
+				fmt.Fprintln(os.Stderr, "❌ -endpoints:", err)
+				os.Exit(2)
+			}
+			if !slices.Contains(endpointPicks, *endpointPick) {
+				fmt.Fprintf(os.Stderr, "❌ -endpoint-pick must be one of %s\n", strings.Join(endpointPicks, ", "))
+				os.Exit(2)
+			}
+			if *batchSize > 0 || *twoPhaseBatch > 0 || *compare != "" {
+				fmt.Fprintln(os.Stderr, "❌ -endpoints can't be combined with -batch, -two-phase-batch or -protocol-compare, which derive their URLs from -endpoint")
+				os.Exit(2)
+			}
+			endpoint = endpointURLs[0]
+		}
+		if u, err := url.Parse(endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fmt.Fprintf(os.Stderr, "❌ -endpoint %q is not an http:// or https:// URL\n", endpoint)
+			os.Exit(2)
+		}
+	case "mqtt":
+		if err := checkBrokerURL(*mqttBroker); err != nil {
+			fmt.Fprintln(os.Stderr, "❌ -mqtt-broker:", err)
+			os.Exit(2)
+		}
+		if *mqttTopic == "" || *mqttQoS < 0 || *mqttQoS > 2 {
+			fmt.Fprintln(os.Stderr, "❌ -transport mqtt needs a -mqtt-topic and a -mqtt-qos of 0, 1 or 2")
+			os.Exit(2)
+		}
+		if *useHTTP2 || *useHTTP3 || httpVersionReport || headerChaos > 0 || *twoPhaseBatch > 0 || gzipBodies || extraHeaders.h != nil || *bearerToken != "" || *endpointsSpec != "" {
+			fmt.Fprintln(os.Stderr, "❌ -transport mqtt can't be combined with -http2, -http3, -http-version-report, -header-chaos, -two-phase-batch, -gzip, -header, -bearer-token or -endpoints")
+			os.Exit(2)
+		}
+		if *mqttDropFraction < 0 || *mqttDropFraction > 1 || *mqttDropInterval <= 0 {
+			fmt.Fprintln(os.Stderr, "❌ -mqtt-drop-fraction must be between 0 and 1 and -mqtt-drop-interval positive")
+			os.Exit(2)
+		}
+		if *mqttDropFraction > 0 && *mqttWillPrefix == "" {
+			fmt.Fprintln(os.Stderr, "❌ -mqtt-drop-fraction needs -mqtt-will-prefix: a dropped session only shows up as its will")
+			os.Exit(2)
+		}
+		if u, _ := url.Parse(*mqttBroker); *mqttDropFraction > 0 && (u.Scheme == "ws" || u.Scheme == "wss") {
+			fmt.Fprintln(os.Stderr, "❌ -mqtt-drop-fraction needs a tcp:// or TLS broker; it can't drop WebSocket sessions")
+			os.Exit(2)
+		}
+		if strings.ContainsAny(*mqttWillPrefix, "+#") {
+			fmt.Fprintln(os.Stderr, "❌ -mqtt-will-prefix is a topic, not a filter: no + or #")
+			os.Exit(2)
+		}
+	case "udp":
+		if err := checkUDPAddr(*udpAddr); err != nil {
+			fmt.Fprintln(os.Stderr, "❌ -udp-addr:", err)
+			os.Exit(2)
+		}
+		if *useHTTP2 || *useHTTP3 || httpVersionReport || headerChaos > 0 || *twoPhaseBatch > 0 || gzipBodies || extraHeaders.h != nil || *bearerToken != "" || *endpointsSpec != "" || *requireAck {
+			fmt.Fprintln(os.Stderr, "❌ -transport udp can't be combined with -http2, -http3, -http-version-report, -header-chaos, -two-phase-batch, -gzip, -header, -bearer-token, -endpoints or -require-ack")
+			os.Exit(2)
+		}
+	case "ws":
+		if err := checkWSURL(*wsURL); err != nil {
+			fmt.Fprintln(os.Stderr, "❌ -ws-url:", err)
+			os.Exit(2)
+		}
+		if *useHTTP2 || *useHTTP3 || httpVersionReport || headerChaos > 0 || *twoPhaseBatch > 0 || gzipBodies || *endpointsSpec != "" || *requireAck || *noKeepAlive {
+			fmt.Fprintln(os.Stderr, "❌ -transport ws can't be combined with -http2, -http3, -http-version-report, -header-chaos, -two-phase-batch, -gzip, -endpoints, -require-ack or -no-keepalive")
+			os.Exit(2)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "❌ -transport %q: want http, mqtt, udp or ws\n", *transportName)
+		os.Exit(2)
+	}
+	if *mqttWillPrefix != "" && *transportName != "mqtt" {
+		fmt.Fprintln(os.Stderr, "❌ -mqtt-will-prefix needs -transport mqtt")
+		os.Exit(2)
+	}
+	if *mqttClientID == "" {
+		*mqttClientID = "solar-sim-" + runID[:min(8, len(runID))]
+	}
+	if rate <= 0 {
+		fmt.Fprintln(os.Stderr, "❌ -rate must be positive")
+		os.Exit(2)
+	}
+	if runDuration <= 0 {
+		fmt.Fprintln(os.Stderr, "❌ -duration must be positive")
+		os.Exit(2)
+	}
+	if numDevices <= 0 || deviceIDRange <= 0 {
+		fmt.Fprintln(os.Stderr, "❌ -devices and -device-id-range must be positive")
+		os.Exit(2)
+	}
+	setupIdentities()
+	if fieldsSubset < 0 || fieldsSubset > 1 {
+		fmt.Fprintln(os.Stderr, "❌ -fields-subset must be between 0 and 1")
+		os.Exit(2)
+	}
+	if *locales != "" {
+		l, err := parseLocales(*locales)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "❌ -payload-locale:", err)
+			os.Exit(2)
+		}
+		setupLocales(l)
+	}
+	if headerChaos < 0 || headerChaos > 1 {
+		fmt.Fprintln(os.Stderr, "❌ -header-chaos must be between 0 and 1")
+		os.Exit(2)
+	}
+	if shuffleKeys < 0 || shuffleKeys > 1 {
+		fmt.Fprintln(os.Stderr, "❌ -json-field-order-randomize must be between 0 and 1")
+		os.Exit(2)
+	}
+	if *perDeviceInterval < 0 {
+		fmt.Fprintln(os.Stderr, "❌ -per-device-interval must not be negative")
+		os.Exit(2)
+	}
+	if *heartbeatInterval < 0 {
+		fmt.Fprintln(os.Stderr, "❌ -heartbeat-interval must not be negative")
+		os.Exit(2)
+	}
+	if *workers < 0 {
+		fmt.Fprintln(os.Stderr, "❌ -workers must not be negative")
+		os.Exit(2)
+	}
+	if *mix != "" {
+		if schemaMix, err = parseSchemaMix(*mix); err != nil {
+			fmt.Fprintln(os.Stderr, "❌ -schema-mix:", err)
+			os.Exit(2)
+		}
+	}
+	if *geo {
+		if len(cfg.Sites) > 0 {
+			setupGeo(cfg.Sites)
+		} else {
+			setupGeo(defaultSites)
+		}
+	}
+	if *retries < 0 || *retryBackoff <= 0 {
+		fmt.Fprintln(os.Stderr, "❌ -retries must not be negative and -retry-backoff must be positive")
+		os.Exit(2)
+	}
+	if *requireAck && (*ackTimeout <= 0 || *ackRetries < 0) {
+		fmt.Fprintln(os.Stderr, "❌ -ack-timeout must be positive and -ack-retries not negative")
+		os.Exit(2)
+	}
+	var silentDevs []int
+	if *silent != "" {
+		if silentDevs, err = parseDeviceList(*silent); err != nil {
+			fmt.Fprintln(os.Stderr, "❌ -silent-devices:", err)
+			os.Exit(2)
+		}
+		if *silentAfter < 0 {
+			fmt.Fprintln(os.Stderr, "❌ -silent-after must not be negative")
+			os.Exit(2)
+		}
+		if len(silentDevs) == numDevices {
+			fmt.Fprintln(os.Stderr, "❌ -silent-devices can't silence the whole fleet")
+			os.Exit(2)
+		}
+	}
+	if *drainTimeout < 0 {
+		fmt.Fprintln(os.Stderr, "❌ -drain-timeout must not be negative")
+		os.Exit(2)
+	}
+	if *churn < 0 {
+		fmt.Fprintln(os.Stderr, "❌ -devices-churn must not be negative")
+		os.Exit(2)
+	}
+	if *churn > 0 {
+		if *perDeviceInterval > 0 {
+			fmt.Fprintln(os.Stderr, "❌ -devices-churn and -per-device-interval can't be combined")
+			os.Exit(2)
+		}
+		fleet = newDeviceFleet()
+	}
+	var tlsConfig *tls.Config
+	if *minTLS != "" {
+		v, err := parseTLSVersion(*minTLS)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "❌ -min-tls:", err)
+			os.Exit(2)
+		}
+		tlsConfig = &tls.Config{MinVersion: v}
+	}
+	if *clientCert != "" || *clientKey != "" || *caCert != "" {
+		target, secure := endpoint, strings.HasPrefix(endpoint, "https://")
+		for _, u := range endpointURLs {
+			if !strings.HasPrefix(u, "https://") {
+				target, secure = u, false
+			}
+		}
+		if *transportName == "mqtt" {
+			u, _ := url.Parse(*mqttBroker)
+			target, secure = *mqttBroker, slices.Contains([]string{"ssl", "tls", "mqtts", "wss"}, u.Scheme)
+		}
+		if *transportName == "udp" {
+			target, secure = "udp://"+*udpAddr, false
+		}
+		if *transportName == "ws" {
+			target, secure = *wsURL, strings.HasPrefix(*wsURL, "wss://")
+		}
+		if !secure {
+			fmt.Fprintf(os.Stderr, "❌ -client-cert, -client-key and -ca-cert need a TLS endpoint; %s is not\n", target)
+			os.Exit(2)
+		}
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+		if err := loadClientTLS(tlsConfig, *clientCert, *clientKey, *caCert); err != nil {
+			fmt.Fprintln(os.Stderr, "❌ TLS:", err)
+			os.Exit(1)
+		}
+	}
+	var benchCfg *BenchConfig
+	if *bench {
+		if *benchMin < 1 || *benchMax <= *benchMin || *benchStep <= 0 || *benchReps < 1 || *benchMaxError < 0 || *benchMaxError > 1 || *benchP99 < 0 {
+			fmt.Fprintln(os.Stderr, "❌ -bench needs 1 ≤ -bench-min < -bench-max, a positive -bench-step, -bench-reps ≥ 1 and -bench-max-error between 0 and 1")
+			os.Exit(2)
+		}
+		if *sweep != "" || *perDeviceInterval > 0 || *replayPath != "" || *compare != "" || *rampSpec != "" || *throttleRamp {
+			fmt.Fprintln(os.Stderr, "❌ -bench can't be combined with -sweep, -per-device-interval, -replay, -protocol-compare, -format-ramp or -graceful-ramp-on-throttle")
+			os.Exit(2)
+		}
+		p99 := *benchP99
+		if p99 == 0 {
+			p99 = cmp.Or(*slaP99, 500*time.Millisecond)
+		}
+		benchCfg = &BenchConfig{
+			Min: *benchMin, Max: *benchMax, Step: *benchStep, Cooldown: *sweepCooldown,
+			MaxError: *benchMaxError, P99: p99, Reps: *benchReps, Tolerance: 0.05,
+		}
+	}
+	var sweepRates []int
+	if *sweep != "" {
+		if sweepRates, err = parseRates(*sweep); err != nil {
+			fmt.Fprintln(os.Stderr, "❌ -sweep:", err)
+			os.Exit(2)
+		}
+		if *sweepStep <= 0 || *sweepCooldown < 0 {
+			fmt.Fprintln(os.Stderr, "❌ -sweep-step must be positive and -sweep-cooldown not negative")
+			os.Exit(2)
+		}
+		if *perDeviceInterval > 0 {
+			fmt.Fprintln(os.Stderr, "❌ -sweep and -per-device-interval can't be combined")
+			os.Exit(2)
+		}
+	}
+	if *bodyStdin {
+		if *bodyFile != "" {
+			fmt.Fprintln(os.Stderr, "❌ -body-file and -body-from-stdin can't be combined")
+			os.Exit(2)
+		}
+		*bodyFile = "-"
+	}
+	if *bodyFile != "" {
+		if fixedBody, err = readBody(*bodyFile); err != nil {
+			fmt.Fprintln(os.Stderr, "❌ body:", err)
+			os.Exit(1)
+		}
+	}
+	var agents *userAgentPool
+	switch {
+	case *userAgent != "" && *userAgentFile != "":
+		fmt.Fprintln(os.Stderr, "❌ -user-agent and -user-agent-file can't be combined")
+		os.Exit(2)
+	case *userAgent != "":
+		agents = newUserAgentPool([]string{*userAgent})
+	case *userAgentFile != "":
+		list, err := loadUserAgents(*userAgentFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "❌ user agents:", err)
+			os.Exit(1)
+		}
+		agents = newUserAgentPool(list)
+	}
+	if !slices.Contains(summaryFormats, *summaryFormat) {
+		fmt.Fprintf(os.Stderr, "❌ -summary-format must be one of %s\n", strings.Join(summaryFormats, ", "))
+		os.Exit(2)
+	}
+	if *statePath != "" {
+		if *stateInterval <= 0 {
+			fmt.Fprintln(os.Stderr, "❌ -state-interval must be positive")
+			os.Exit(2)
+		}
+		n, err := setupState(*statePath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "❌ -state-file:", err)
+			os.Exit(1)
+		}
+		if n > 0 {
+			fmt.Printf("💾 Resuming %d devices from %s\n", n, *statePath)
+		}
+	}
+	if energyResetHour < -1 || energyResetHour > 23 {
+		fmt.Fprintln(os.Stderr, "❌ -energy-reset-hour must be 0-23 (or -1 for off)")
+		os.Exit(2)
+	}
+	resetHourSet := false
+	flag.Visit(func(f *flag.Flag) { resetHourSet = resetHourSet || f.Name == "energy-reset-hour" })
+	if timeScale <= 0 {
+		fmt.Fprintln(os.Stderr, "❌ -time-scale must be positive")
+		os.Exit(2)
+	}
+	var simStartAt time.Time
+	if *simStartFlag != "" {
+		if simStartAt, err = parseSimStart(*simStartFlag); err != nil {
+			fmt.Fprintln(os.Stderr, "❌ -sim-start:", err)
+			os.Exit(2)
+		}
+	}
+	if deviceSkewMax < 0 || deviceSkewFuture < 0 || deviceSkewFuture > 1 {
+		fmt.Fprintln(os.Stderr, "❌ -device-clock-skew must not be negative and -device-clock-future must be between 0 and 1")
+		os.Exit(2)
+	}
+	if deviceSkewFuture > 0 && deviceSkewMax == 0 {
+		fmt.Fprintln(os.Stderr, "❌ -device-clock-future needs -device-clock-skew")
+		os.Exit(2)
+	}
+	if faultRate < 0 || faultRate > 1 {
+		fmt.Fprintln(os.Stderr, "❌ -fault-rate must be between 0 and 1")
+		os.Exit(2)
+	}
+	if faultMeanDuration < 0 {
+		fmt.Fprintln(os.Stderr, "❌ -fault-mean-duration must not be negative")
+		os.Exit(2)
+	}
+	if signalDropoutRate < 0 || signalDropoutRate > 1 {
+		fmt.Fprintln(os.Stderr, "❌ -signal-dropout-rate must be between 0 and 1")
+		os.Exit(2)
+	}
+	if faultCodes, err = parseFaultCodes(*faultCodeList); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ -fault-codes:", err)
+		os.Exit(2)
+	}
+	if *scenarioPath != "" {
+		if scenario, err = loadFaultScenario(*scenarioPath); err != nil {
+			fmt.Fprintln(os.Stderr, "❌ fault scenario:", err)
+			os.Exit(2)
+		}
+	}
+	if *twoPhaseBatch < 0 || *twoPhaseLinger <= 0 || *twoPhaseAbort < 0 || *twoPhaseAbort > 1 {
+		fmt.Fprintln(os.Stderr, "❌ -two-phase-batch must not be negative, -two-phase-linger must be positive and -two-phase-abort between 0 and 1")
+		os.Exit(2)
+	}
+	if *batchSize < 0 || *batchLinger <= 0 {
+		fmt.Fprintln(os.Stderr, "❌ -batch must not be negative and -batch-linger must be positive")
+		os.Exit(2)
+	}
+	if *batchSize > 0 && (attachmentSize > 0 || fixedBody != nil || gzipBodies || *twoPhaseBatch > 0 || *compare != "") {
+		fmt.Fprintln(os.Stderr, "❌ -batch joins generated JSON into arrays; it can't be combined with -attachment-size, -body-file, -body-from-stdin, -gzip, -two-phase-batch or -protocol-compare")
+		os.Exit(2)
+	}
+	if *streamFlush <= 0 {
+		fmt.Fprintln(os.Stderr, "❌ -stream-flush must be positive")
+		os.Exit(2)
+	}
+	if *stream && (attachmentSize > 0 || fixedBody != nil || gzipBodies || headerChaos > 0 || *batchSize > 0 || *twoPhaseBatch > 0 || *compare != "" || *dryRunFlag) {
+		fmt.Fprintln(os.Stderr, "❌ -stream writes generated JSON as lines of one request; it can't be combined with -attachment-size, -body-file, -body-from-stdin, -gzip, -header-chaos, -batch, -two-phase-batch, -protocol-compare or -dry-run")
+		os.Exit(2)
+	}
+	if *stream && (*transportName != "http" || endpointURLs != nil || *requireAck) {
+		fmt.Fprintln(os.Stderr, "❌ -stream needs -transport http with a single -endpoint, and can't be combined with -require-ack")
+		os.Exit(2)
+	}
+	if *twoPhaseBatch > 0 && (attachmentSize > 0 || fixedBody != nil || gzipBodies) {
+		fmt.Fprintln(os.Stderr, "❌ -two-phase-batch batches generated JSON; it can't be combined with -attachment-size, -body-file, -body-from-stdin or -gzip")
+		os.Exit(2)
+	}
+	if attachmentSize > 0 {
+		if verifyEcho || strictSchema {
+			fmt.Fprintln(os.Stderr, "❌ -attachment-size can't be combined with -verify-echo or -strict-schema")
+			os.Exit(2)
+		}
+		setupAttachment()
+	}
+	if partitionByDevice {
+		deviceSeq = true
+	}
+	if *slaP99 < 0 || *slaWindow < time.Second {
+		fmt.Fprintln(os.Stderr, "❌ -sla-p99 must not be negative and -sla-window must be at least 1s")
+		os.Exit(2)
+	}
+	if *slaP99 > 0 {
+		sla = newSLAMonitor(*slaP99, *slaWindow, *slaWebhook)
+	}
+	if *formatsPath != "" {
+		if enabledOptIn != (formatSet{}) || schemaMix != nil || fieldsSubset > 0 || serialTpl.set != nil {
+			fmt.Fprintln(os.Stderr, "❌ -formats replaces the built-in formats; it can't be combined with -enable-format, -schema-mix, -fields-subset or -serial-template")
+			os.Exit(2)
+		}
+		formats, err := loadCustomFormats(*formatsPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "❌ -formats:", err)
+			os.Exit(1)
+		}
+		setupCustomFormats(formats)
+	}
+	if err := setupFormats(); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ -disable-format/-enable-format:", err)
+		os.Exit(2)
+	}
+	if customFormats == nil && formatOn(protobufFormat) && (verifyEcho || strictSchema || *batchSize > 0 || *twoPhaseBatch > 0 || *stream) {
+		fmt.Fprintln(os.Stderr, "❌ format 5 is protobuf; it can't be combined with -verify-echo, -strict-schema, -batch, -two-phase-batch or -stream, which need JSON records")
+		os.Exit(2)
+	}
+	if *weightsSpec != "" {
+		if *rampSpec != "" {
+			fmt.Fprintln(os.Stderr, "❌ -weights and -format-ramp can't be combined; use -format-ramp W:W for a fixed mix")
+			os.Exit(2)
+		}
+		w, err := parseFormatWeights(*weightsSpec)
+		if err == nil {
+			ramp = &formatRamp{From: w, To: w}
+			err = ramp.exclude(offFormats())
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "❌ -weights:", err)
+			os.Exit(2)
+		}
+	}
+	if *rampSpec != "" {
+		if ramp, err = parseFormatRamp(*rampSpec); err == nil {
+			err = ramp.exclude(offFormats())
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "❌ -format-ramp:", err)
+			os.Exit(2)
+		}
+		if *perDeviceInterval > 0 || sweepRates != nil {
+			fmt.Fprintln(os.Stderr, "❌ -format-ramp can't be combined with -per-device-interval or -sweep (-weights can)")
+			os.Exit(2)
+		}
+	}
+	var replayEvents []replayEvent
+	var payloads *payloadReplay
+	if strings.HasSuffix(*replayPath, ".ndjson") {
+		if *replayWindow != "" || *replaySpeed != 1 {
+			fmt.Fprintln(os.Stderr, "❌ a .ndjson -replay is sent at -rate; -replay-window and -replay-speed apply to recordings")
+			os.Exit(2)
+		}
+		if sweepRates != nil || *perDeviceInterval > 0 || ramp != nil || fixedBody != nil {
+			fmt.Fprintln(os.Stderr, "❌ a .ndjson -replay can't be combined with -sweep, -per-device-interval, -format-ramp, -weights, -body-file or -body-from-stdin")
+			os.Exit(2)
+		}
+		if payloads, err = loadPayloadReplay(*replayPath, *replayLoop); err != nil {
+			fmt.Fprintln(os.Stderr, "❌ replay:", err)
+			os.Exit(1)
+		}
+	} else if *replayLoop {
+		fmt.Fprintln(os.Stderr, "❌ -replay-loop needs a .ndjson -replay")
+		os.Exit(2)
+	} else if *replayPath != "" {
+		var from, to time.Duration
+		if *replayWindow != "" {
+			if from, to, err = parseReplayWindow(*replayWindow); err != nil {
+				fmt.Fprintln(os.Stderr, "❌ -replay-window:", err)
+				os.Exit(2)
+			}
+		}
+		if *replaySpeed <= 0 {
+			fmt.Fprintln(os.Stderr, "❌ -replay-speed must be positive")
+			os.Exit(2)
+		}
+		if sweepRates != nil || *perDeviceInterval > 0 || ramp != nil || *churn > 0 {
+			fmt.Fprintln(os.Stderr, "❌ -replay can't be combined with -sweep, -per-device-interval, -format-ramp, -weights or -devices-churn")
+			os.Exit(2)
+		}
+		if replayEvents, err = loadReplay(*replayPath, from, to); err != nil {
+			fmt.Fprintln(os.Stderr, "❌ replay:", err)
+			os.Exit(1)
+		}
+	}
+	var transports []compareTransport
+	if *compare != "" {
+		if transports, err = parseTransports(*compare); err != nil {
+			fmt.Fprintln(os.Stderr, "❌ -protocol-compare:", err)
+			os.Exit(2)
+		}
+		if *compareStep <= 0 || *sweepCooldown < 0 {
+			fmt.Fprintln(os.Stderr, "❌ -compare-step must be positive and -sweep-cooldown not negative")
+			os.Exit(2)
+		}
+		if sweepRates != nil || *perDeviceInterval > 0 || *churn > 0 || ramp != nil || replayEvents != nil || payloads != nil || *heartbeatInterval > 0 || *requireAck || *twoPhaseBatch > 0 {
+			fmt.Fprintln(os.Stderr, "❌ -protocol-compare can't be combined with -sweep, -per-device-interval, -devices-churn, -format-ramp, -weights, -replay, -heartbeat-interval, -require-ack or -two-phase-batch")
+			os.Exit(2)
+		}
+	}
+
+	if *smoke && *dryRunFlag {
+		fmt.Fprintln(os.Stderr, "❌ -smoke sends to the server; it can't be combined with -dry-run")
+		os.Exit(2)
+	}
+	var dryRun *DryRunSender
+	if *dryRunFlag {
+		if *transportName != "http" || *useHTTP3 || *twoPhaseBatch > 0 || *compare != "" || *requireAck {
+			fmt.Fprintln(os.Stderr, "❌ -dry-run replaces the HTTP transport; it can't be combined with -transport mqtt, udp or ws, -http3, -two-phase-batch, -protocol-compare or -require-ack")
+			os.Exit(2)
+		}
+		if dryRun, err = NewDryRunSender(*dryRunOut); err != nil {
+			fmt.Fprintln(os.Stderr, "❌ -dry-run-out:", err)
+			os.Exit(1)
+		}
+	}
+	if *failuresPath != "" {
+		fw, err := NewFailureWriter(*failuresPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "❌ failure capture:", err)
+			os.Exit(1)
+		}
+		failures = fw
+	}
+	if *resultsCSV != "" {
+		rw, err := NewResultsWriter(*resultsCSV)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "❌ results CSV:", err)
+			os.Exit(1)
+		}
+		results = rw
+	}
+
 	totalRecords := rate * int(runDuration.Seconds())
+	if *rampUp > 0 {
+		totalRecords = rampTarget(rate, *rampUp, runDuration)
+	}
+
+	targetRate := float64(rate)
+	if *rampUp < 0 || *rampUp > 0 && (sweepRates != nil || benchCfg != nil || *perDeviceInterval > 0 || replayEvents != nil || transports != nil) {
+		fmt.Fprintln(os.Stderr, "❌ -ramp must not be negative, and ramps the global rate; it can't be combined with -sweep, -bench, -per-device-interval, -replay or -protocol-compare")
+		os.Exit(2)
+	}
+	if *throttleRamp {
+		if sweepRates != nil || *perDeviceInterval > 0 || replayEvents != nil || transports != nil {
+			fmt.Fprintln(os.Stderr, "❌ -graceful-ramp-on-throttle drives the global rate; it can't be combined with -sweep, -per-device-interval, -replay or -protocol-compare")
+			os.Exit(2)
+		}
+		throttle = newThrottleController(rate)
+	}
+
+	httpURLs := append([]string{endpoint}, endpointURLs...)
+	for _, t := range transports {
+		if t.Kind == "http" {
+			httpURLs = append(httpURLs, t.URL)
+		}
+	}
+	if *useHTTP3 {
+		if err := checkHTTP3URLs(httpURLs); err != nil {
+			fmt.Fprintln(os.Stderr, "❌ -http3:", err)
+			os.Exit(2)
+		}
+		if *noKeepAlive || *maxIdleConns > 0 || *maxIdlePerHost > 0 {
+			fmt.Fprintln(os.Stderr, "❌ -http3 can't be combined with -no-keepalive, -max-idle-conns or -max-idle-per-host")
+			os.Exit(2)
+		}
+	}
+	if *useHTTP2 {
+		if *useHTTP3 {
+			fmt.Fprintln(os.Stderr, "❌ -http2 and -http3 can't be combined")
+			os.Exit(2)
+		}
+		httpVersionReport = true
+	}
+	if *timeout <= 0 || *maxIdleConns < 0 || *maxIdlePerHost < 0 {
+		fmt.Fprintln(os.Stderr, "❌ -timeout must be positive and -max-idle-conns and -max-idle-per-host must not be negative")
+		os.Exit(2)
+	}
+	if *shutdownGrace < 0 {
+		fmt.Fprintln(os.Stderr, "❌ -shutdown-grace must not be negative")
+		os.Exit(2)
+	}
 
 	fmt.Printf("🚀 Starting multi-format inverter simulator\n")
-	fmt.Printf("   Sending %d records/sec across 4 formats\n", rate)
-	fmt.Printf("   Target: %d total records in %v\n\n", totalRecords, runDuration)
+	fmt.Printf("   Run ID: %s\n", runID)
+	fmt.Printf("   Seed: %d (repeat with -seed %d)\n", runSeed, runSeed)
+	if clockSkew != 0 {
+		fmt.Printf("   Device clocks skewed by %v\n", clockSkew)
+	}
+	if ranges != nil {
+		fmt.Printf("   Value ranges overridden: %s\n", ranges.String())
+	}
+	if deviceSkewMax > 0 {
+		fmt.Printf("   Each device's clock off by up to %v (%g%% of devices ahead, the rest behind)\n", deviceSkewMax, deviceSkewFuture*100)
+	}
+	if *simStartFlag != "" || timeScale != 1 {
+		start := "now"
+		if !simStartAt.IsZero() {
+			start = simStartAt.Format("2006-01-02 15:04 MST")
+		}
+		fmt.Printf("   Simulated clock: starts %s, runs at %gx (%v simulated)\n", start, timeScale, time.Duration(float64(runDuration)*timeScale).Round(time.Minute))
+	}
+	if diurnal {
+		fmt.Printf("   Diurnal power: sunrise %02.0f:00, peak at noon, sunset %02.0f:00 on the simulated clock\n", sunrise, sunset)
+	}
+	if sweepRates != nil {
+		targetRate = float64(slices.Max(sweepRates))
+		fmt.Printf("   Sweeping %s records/sec, %v per step with %v cool-down\n", *sweep, *sweepStep, *sweepCooldown)
+	} else if benchCfg != nil {
+		targetRate = float64(benchCfg.Max)
+		fmt.Printf("   Benchmarking capacity between %d and %d records/sec, %v per probe, %d repetitions\n", benchCfg.Min, benchCfg.Max, benchCfg.Step, benchCfg.Reps)
+	} else if replayEvents != nil {
+		span := replaySpan(replayEvents)
+		if span > 0 {
+			targetRate = float64(len(replayEvents)) / (span.Seconds() / *replaySpeed)
+		}
+		fmt.Printf("   Replaying %d requests from %s (%v recorded) at %gx\n", len(replayEvents), *replayPath, span.Round(time.Millisecond), *replaySpeed)
+	} else if transports != nil {
+		fmt.Printf("   Comparing %d transports at %d records/sec, %v each (seed %d)\n", len(transports), rate, *compareStep, *compareSeed)
+	} else if *perDeviceInterval > 0 {
+		targetRate = float64(numDevices) / perDeviceInterval.Seconds()
+		fmt.Printf("   %d devices each reporting every %v (≈%.2f records/sec aggregate)\n", numDevices, *perDeviceInterval, targetRate)
+		fmt.Printf("   Target: ≈%.0f total records in %v\n", targetRate*runDuration.Seconds(), runDuration)
+	} else {
+		fmt.Printf("   Sending %d records/sec across %d formats\n", rate, len(enabledFormats))
+		fmt.Printf("   Target: %d total records in %v\n", totalRecords, runDuration)
+		if *rampUp > 0 {
+			fmt.Printf("   Ramping up from 0 to %d records/sec over %v\n", rate, *rampUp)
+		}
+		if payloads != nil {
+			loop := "stopping at its end"
+			if *replayLoop {
+				loop = "looping"
+			}
+			fmt.Printf("   Replaying %d payloads from %s in order, %s\n", len(payloads.events), *replayPath, loop)
+		}
+	}
+	fmt.Printf("   Fleet: %d devices, IDs and serials from 1-%d\n", numDevices, deviceIDRange)
+	if fleet != nil {
+		fmt.Printf("   Device churn: %.0f%% of the fleet per minute\n", *churn*100)
+	}
+	if tlsConfig != nil && tlsConfig.MinVersion != 0 {
+		fmt.Printf("   Requiring %s or newer\n", tls.VersionName(tlsConfig.MinVersion))
+	}
+	if tlsConfig != nil && tlsConfig.Certificates != nil {
+		fmt.Printf("   Mutual TLS: presenting %s\n", *clientCert)
+	}
+	if silentDevs != nil {
+		fmt.Printf("   Devices %s go silent after %v\n", *silent, *silentAfter)
+	}
+	if faultMeanDuration > 0 {
+		fmt.Printf("   Fault bursts: %g%% chance per record to start one, lasting %v on average, codes %s\n", faultRate*100, faultMeanDuration, *faultCodeList)
+	} else if faultRate != 0.1 || *faultCodeList != "1,2,3,4,5" {
+		fmt.Printf("   Random faults: %g%% of records, codes %s\n", faultRate*100, *faultCodeList)
+	}
+	if signalDropoutRate != 0.02 {
+		fmt.Printf("   Signal dropouts: %g%% of Format 1 reports\n", signalDropoutRate*100)
+	}
+	if scenario != nil {
+		fmt.Printf("   %d scripted faults from %s\n", len(scenario.Faults), *scenarioPath)
+	}
+	if fixedBody != nil {
+		fmt.Printf("   Sending one fixed %s body; generators and their options are bypassed\n", formatBytes(int64(len(fixedBody))))
+	}
+	if customFormats != nil {
+		for i, f := range customFormats {
+			state := ""
+			if disabledFormats[i] {
+				state = " (disabled)"
+			}
+			fmt.Printf("   Format %d: %s, %d fields from %s%s\n", i+1, f.Name, len(f.Fields), *formatsPath, state)
+		}
+	} else if off := disabledFormats.String(); off != "" {
+		fmt.Printf("   Disabled formats: %s\n", off)
+	}
+	if on := enabledOptIn.String(); on != "" {
+		fmt.Printf("   Opt-in formats: %s\n", on)
+	}
+	if *weightsSpec != "" {
+		fmt.Printf("   Format mix weighted %s\n", *weightsSpec)
+	} else if ramp != nil {
+		fmt.Printf("   Format mix ramps %s over the run\n", *rampSpec)
+	}
+	if maxBytes > 0 {
+		fmt.Printf("   Stopping early after %s of payload data\n", maxBytes.String())
+	}
+	if maxRecords > 0 {
+		fmt.Printf("   Stopping early after %d records\n", maxRecords)
+	}
+
+	cpus, cpuLimited := availableCPUs()
+	if cpuLimited {
+		fmt.Printf("   CPU: %.2f (cgroup limit) | GOMAXPROCS %d\n", cpus, runtime.GOMAXPROCS(0))
+	} else {
+		fmt.Printf("   CPU: %.0f | GOMAXPROCS %d\n", cpus, runtime.GOMAXPROCS(0))
+	}
+	poolSize := *workers
+	if poolSize == 0 {
+		poolSize = autoWorkers(targetRate, cpus)
+		if *batchSize > 0 {
+			// every record waits for its batch, so fill one while another is in flight
+			poolSize = max(poolSize, 2**batchSize)
+		}
+	}
+	fmt.Printf("   Workers: %d (sustains ≈%.0f/sec at %.0fms latency)\n", poolSize, sustainableRate(poolSize), assumedLatencySec*1000)
+	if sustainableRate(poolSize) < targetRate {
+		fmt.Printf("⚠️  %d workers likely can't reach %.0f/sec; raise -workers or lower the rate\n", poolSize, targetRate)
+	}
+	checkFileLimit(filesNeeded(poolSize, len(transports)), *maxOpenFiles)
+	fmt.Println()
 
+	// Each worker holds at most one connection, so by default the idle pool
+	// only needs to be as big as the worker pool.
+	idleConns, idlePerHost := cmp.Or(*maxIdleConns, poolSize), cmp.Or(*maxIdlePerHost, poolSize)
+	var transport http.RoundTripper = &http.Transport{
+		MaxIdleConns:        idleConns,
+		MaxIdleConnsPerHost: idlePerHost,
+		IdleConnTimeout:     90 * time.Second,
+		DisableKeepAlives:   *noKeepAlive,
+		TLSClientConfig:     tlsConfig,
+		ForceAttemptHTTP2:   *useHTTP2,
+		Protocols:           clientProtocols(*useHTTP2, httpURLs),
+	}
+	if *useHTTP2 {
+		fmt.Println("   Transport: HTTP/2")
+	}
+	if *useHTTP3 {
+		transport = newHTTP3Transport(tlsConfig, poolSize)
+		fmt.Println("   Transport: HTTP/3 over QUIC")
+	}
 	client := &http.Client{
-		Timeout: 3 * time.Second,
-		Transport: &http.Transport{
-			MaxIdleConns:        2000,
-			MaxIdleConnsPerHost: 2000,
-			IdleConnTimeout:     90 * time.Second,
-		},
+		Timeout:   *timeout,
+		Transport: transport,
+	}
+	if *timeout != 3*time.Second || *maxIdleConns > 0 || *maxIdlePerHost > 0 {
+		fmt.Printf("   HTTP client: %v timeout | %d idle connections, %d per host\n", *timeout, idleConns, idlePerHost)
+	}
+
+	header := http.Header{"X-Run-Id": {runID}}
+	applyAuth(header, extraHeaders, *bearerToken)
+	if extraHeaders.h != nil {
+		fmt.Printf("   Extra headers: %s\n", extraHeaders.String())
+	}
+	if header.Get("Authorization") != "" && (*transportName == "http" || *transportName == "ws") {
+		fmt.Println("   Authorization: set (value not shown)")
+	}
+	if *noKeepAlive {
+		header.Set("Connection", "close")
+		fmt.Println("   Keep-alive disabled: one connection per request")
+	}
+	dial := func(url string) Sender {
+		if dryRun != nil {
+			return dryRun
+		}
+		return &HTTPSender{Client: client, URL: url, Header: header, UserAgents: agents}
+	}
+	var sender Sender = dial(endpoint)
+	dialTransport := func(t compareTransport) Sender {
+		switch t.Kind {
+		case "mqtt":
+			return NewMQTTSender(t.Addr, cmp.Or(t.Topic, *mqttTopic), *mqttClientID, byte(*mqttQoS), client.Timeout, tlsConfig)
+		case "udp":
+			return NewUDPSender(t.Addr, client.Timeout)
+		case "ws":
+			return NewWSSender(t.URL, header, client.Timeout, tlsConfig)
+		}
+		return dial(t.URL)
+	}
+	var endpoints *EndpointSender
+	if endpointURLs != nil && dryRun == nil {
+		next := make([]Sender, len(endpointURLs))
+		for i, u := range endpointURLs {
+			next[i] = dial(u)
+		}
+		endpoints = NewEndpointSender(next, *endpointPick == "random")
+		sender = endpoints
+		fmt.Printf("   Spreading requests %s over %d endpoints\n", *endpointPick, len(next))
+	}
+	var sessions *MQTTDeviceSender
+	if *transportName == "mqtt" {
+		if *mqttWillPrefix != "" {
+			sessions = NewMQTTDeviceSender(*mqttBroker, *mqttTopic, *mqttWillPrefix, *mqttClientID, byte(*mqttQoS), client.Timeout, tlsConfig, *mqttDropFraction, *mqttDropInterval)
+			sender = sessions
+		} else {
+			sender = NewMQTTSender(*mqttBroker, *mqttTopic, *mqttClientID, byte(*mqttQoS), client.Timeout, tlsConfig)
+		}
+		fmt.Printf("   Publishing to %s on %s (QoS %d)\n", *mqttTopic, *mqttBroker, *mqttQoS)
+		if sessions != nil {
+			fmt.Printf("   One session per device, Last-Will on %s/<device>", *mqttWillPrefix)
+			if *mqttDropFraction > 0 {
+				fmt.Printf("; dropping %.0f%% of them every %v", *mqttDropFraction*100, *mqttDropInterval)
+			}
+			fmt.Println()
+		}
+	}
+	if *transportName == "ws" {
+		sender = NewWSSender(*wsURL, header, client.Timeout, tlsConfig)
+		fmt.Printf("   Streaming over a WebSocket to %s\n", *wsURL)
+	}
+	if *transportName == "udp" {
+		sender = NewUDPSender(*udpAddr, client.Timeout)
+		fmt.Printf("   Datagrams to %s: fire and forget, only write errors fail\n", *udpAddr)
+	}
+	var batched *BatchSender
+	if *batchSize > 0 {
+		next := sender
+		if *transportName == "http" {
+			if *batchURL == "" {
+				*batchURL = endpoint + "/batch"
+			}
+			next = dial(*batchURL)
+		}
+		batched = &BatchSender{Next: next, Size: *batchSize, Linger: *batchLinger}
+		sender = batched
+		fmt.Printf("   Batches of up to %d records to %s\n", *batchSize, targetOf(next))
+	}
+	var streamed *StreamSender
+	if *stream {
+		if *streamURL == "" {
+			*streamURL = endpoint + "/stream"
+		}
+		// no client timeout: the stream is meant to outlast it
+		streamed = NewStreamSender(&http.Client{Transport: transport}, *streamURL, header, *streamFlush)
+		sender = streamed
+		fmt.Printf("   Streaming NDJSON to %s, flushed every %v\n", *streamURL, *streamFlush)
+	}
+	var twoPhase *TwoPhaseSender
+	if *twoPhaseBatch > 0 {
+		if *twoPhasePrepare == "" {
+			*twoPhasePrepare = endpoint + "/prepare"
+		}
+		if *twoPhaseCommit == "" {
+			*twoPhaseCommit = endpoint + "/commit"
+		}
+		twoPhase = &TwoPhaseSender{
+			Prepare:    dial(*twoPhasePrepare),
+			Commit:     dial(*twoPhaseCommit),
+			TokenField: *twoPhaseToken,
+			BatchSize:  *twoPhaseBatch,
+			Linger:     *twoPhaseLinger,
+			AbortRate:  *twoPhaseAbort,
+		}
+		sender = twoPhase
+		fmt.Printf("   Two-phase batches of %d: prepare %s, commit %s\n", *twoPhaseBatch, *twoPhasePrepare, *twoPhaseCommit)
+	}
+	if dryRun != nil {
+		fmt.Printf("   Dry run: payloads go to %s, nothing is sent\n", dryRun.name)
+	} else if *smoke || *doPreflight && !*noPreflight {
+		targets := []Sender{sender}
+		if endpoints != nil {
+			targets = endpoints.Next
+		}
+		if streamed != nil {
+			targets = []Sender{dial(*streamURL)} // a stream only answers once it ends
+		}
+		if transports != nil {
+			targets = targets[:0]
+			for _, t := range transports {
+				targets = append(targets, dialTransport(t))
+			}
+		}
+		smokeFailed := false
+		for _, t := range targets {
+			if err := preflight(t, *smoke); err != nil {
+				if *smoke {
+					smokeFailed = true // check every target before exiting
+					continue
+				}
+				fmt.Fprintln(os.Stderr, "❌ Preflight failed:", err)
+				fmt.Fprintln(os.Stderr, "   Check the endpoint, or skip this check with -no-preflight")
+				os.Exit(1)
+			}
+		}
+		if transports != nil {
+			for _, t := range targets {
+				t.Close() // each transport dials its own for its turn
+			}
+		}
+		fmt.Println()
+		if *smoke {
+			sender.Close()
+			if smokeFailed {
+				fmt.Println("❌ Smoke test failed: the server rejected at least one format")
+				os.Exit(1)
+			}
+			fmt.Println("✅ Smoke test passed: every format was accepted")
+			return
+		}
+	}
+	var ack *AckSender
+	if *requireAck {
+		ack = NewAckSender(sender, *ackTimeout, *ackRetries)
+		sender = ack
+	}
+	defer sender.Close()
+	_, ok := sender.(Exchanger)
+	for _, t := range transports {
+		ok = ok && t.Kind == "http"
+	}
+	if (verifyEcho || serverTimeField != "" || strictSchema) && !ok {
+		fmt.Fprintln(os.Stderr, "❌ -verify-echo, -server-time-field and -strict-schema need a transport that returns responses")
+		os.Exit(2)
 	}
 
 	var wg sync.WaitGroup
+	atomic.StoreUint64(&totalAttempts, 0)
 	startTime := time.Now()
+	if !simStartAt.IsZero() || timeScale != 1 {
+		startSimClock(simStartAt, timeScale)
+	}
+	if silentDevs != nil {
+		setupSilence(silentDevs, startTime.Add(*silentAfter))
+	}
 	endTime := startTime.Add(runDuration)
+	if ramp != nil {
+		ramp.Start, ramp.End = startTime, endTime
+	}
+	scenarioStart = startTime
+	if sweepRates == nil && benchCfg == nil && replayEvents == nil && transports == nil {
+		setRunDeadline(endTime) // only the duration-bound modes have one
+	}
+	if *retries > 0 {
+		sender = NewRetrySender(sender, *retries, *retryBackoff, runDeadline)
+	}
 
-	var failed uint64
-
-	seconds := 0
-	for time.Now().Before(endTime) {
-		secondStart := time.Now()
-
-		// A) Exact data count (strict 600/sec)
-		for i := 0; i < rate; i++ {
-			formatType := (seconds*rate + i) % 4
-			wg.Add(1)
-			go func(format int) {
-				defer wg.Done()
-				ok := sendFormat(client, endpoint, format)
-				if ok {
-					atomic.AddUint64(&totalSent, 1)
-					atomic.AddUint64(&formatCounts[format], 1)
-				} else {
-					atomic.AddUint64(&failed, 1)
-				}
-			}(formatType)
+	retried := func() uint64 {
+		n := atomic.LoadUint64(&totalRetried)
+		if ack != nil {
+			n += atomic.LoadUint64(&ack.retries)
 		}
+		return n
+	}
+	stopMetrics := func() {}
+	if *metricsAddr != "" {
+		if stopMetrics, err = startMetricsServer(*metricsAddr, func() []byte { return scrapeMetrics(retried()) }); err != nil {
+			fmt.Fprintln(os.Stderr, "❌ -metrics-addr:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("   Serving Prometheus metrics on %s at /metrics\n", *metricsAddr)
+	}
 
-		seconds++
+	handleSignals(*shutdownGrace)
+	stopDashboard := func() {}
+	if *tui {
+		stopDashboard = startDashboard(targetRate, client.Timeout)
+	}
 
-		// Sleep the remainder of the second to stay perfectly aligned
-		elapsed := time.Since(secondStart)
-		if elapsed < time.Second {
-			time.Sleep(time.Second - elapsed)
+	done := make(chan struct{})
+	if *heartbeatInterval > 0 {
+		fmt.Printf("   Heartbeats every %v per device\n\n", *heartbeatInterval)
+		wg.Add(1)
+		limit := autoWorkers(float64(numDevices)/heartbeatInterval.Seconds(), cpus)
+		go runHeartbeats(sender, *heartbeatInterval, limit, done, &wg)
+	}
+
+	if fleet != nil {
+		go runChurn(*churn, done)
+	}
+	go runFDSampler(done)
+	if *statePath != "" {
+		go runStateSnapshots(*statePath, *stateInterval, done)
+	}
+	slaDone := make(chan struct{})
+	if sla != nil {
+		go func() {
+			sla.run(done)
+			close(slaDone)
+		}()
+	} else {
+		close(slaDone)
+	}
+
+	pool := startWorkerPool(poolSize, sender)
+	stopStats := func() error { return nil }
+	if *statsCSV != "" {
+		if stopStats, err = startStatsCSV(*statsCSV, func() int64 { return atomic.LoadInt64(&pool.pending) }); err != nil {
+			fmt.Fprintln(os.Stderr, "❌ stats CSV:", err)
+			os.Exit(1)
 		}
 	}
+	var sweepSteps []SweepStep
+	var compared []CompareResult
+	var replayed ReplayStats
+	var benched BenchResult
+	if sweepRates != nil {
+		sweepSteps = runSweep(pool, sweepRates, *sweepStep, *sweepCooldown)
+	} else if benchCfg != nil {
+		benched = runBench(pool, *benchCfg)
+	} else if replayEvents != nil {
+		replayed = runReplay(pool, replayEvents, *replaySpeed)
+	} else if transports != nil {
+		compared = runCompare(transports, dialTransport, poolSize, rate, *compareStep, *sweepCooldown, *compareSeed)
+	} else if *perDeviceInterval > 0 {
+		runPerDevice(pool, *perDeviceInterval, endTime)
+	} else {
+		runGlobalRate(pool, rate, *rampUp, endTime, payloads)
+	}
 
-	wg.Wait()
+	close(done)
+	drained := make(chan struct{})
+	go func() {
+		pool.close()
+		wg.Wait()
+		if ack != nil {
+			ack.Close() // let abandoned attempts land so duplicates are counted
+		}
+		if streamed != nil {
+			streamed.Close() // end the open stream so its answer is in the summary
+		}
+		close(drained)
+	}()
+	abandoned, drainedOK := waitDrained(drained, *drainTimeout, pool)
+	stopDashboard()
+	statsErr := stopStats()
+	<-slaDone
+	if *statePath != "" {
+		snapshotState(*statePath)
+	}
 
 	elapsed := time.Since(startTime)
-	fmt.Printf("\n✅ Finished after %v\n", elapsed.Round(time.Millisecond))
-	fmt.Printf("   Total Sent: %d | Failed: %d\n", totalSent, failed)
-	fmt.Printf("   Actual rate: %.2f/sec\n", float64(totalSent)/elapsed.Seconds())
-	for i := 0; i < 4; i++ {
-		fmt.Printf("   Format %d: %d\n", i+1, atomic.LoadUint64(&formatCounts[i]))
+	distOK := true
+	rich := *summaryFormat == "rich"
+	switch *summaryFormat {
+	case "oneline", "json":
+		distOK = !assertDistribution || checkDistribution(io.Discard)
+		summary := newRunSummary(runID, elapsed, targetRate, abandoned)
+		summary.Goodput = goodput(ack)
+		if *summaryFormat == "oneline" {
+			fmt.Println(summary.oneline())
+		} else if err := json.NewEncoder(os.Stdout).Encode(summary); err != nil {
+			fmt.Println("❌ summary JSON:", err)
+		}
+	default:
+		fmt.Printf("\n✅ Finished after %v\n", elapsed.Round(time.Millisecond))
+		fmt.Printf("   Run ID: %s\n", runID)
+		if interrupted.Load() {
+			fmt.Printf("🛑 Interrupted %v into the run\n", interruptedAt.Sub(startTime).Round(time.Millisecond))
+		}
+		if !drainedOK {
+			fmt.Printf("⛔ Drain aborted after %v: %d requests abandoned (not in Sent/Failed)\n", *drainTimeout, abandoned)
+		}
+		if clockSkew != 0 {
+			fmt.Printf("   Clock skew: %v\n", clockSkew)
+		}
+		fmt.Printf("   Total Sent: %d | Failed: %d\n", totalSent, totalFailed)
+		if maxRecords > 0 {
+			fmt.Printf("   Record cap: %d of %d (%.1f%%)\n", totalSent+totalFailed, maxRecords, float64(totalSent+totalFailed)/float64(maxRecords)*100)
+		}
+		actualRate := float64(totalSent+totalFailed) / elapsed.Seconds()
+		fmt.Printf("   Actual rate: %.2f/sec\n", float64(totalSent)/elapsed.Seconds())
+		printGoodput(goodput(ack), elapsed)
+		if sweepRates == nil && benchCfg == nil && transports == nil {
+			printLatency() // those modes reset the histogram per step and report it in their tables
+		}
+		switch {
+		case sweepRates != nil, benchCfg != nil, transports != nil, replayEvents != nil:
+			// rates for these modes are reported in their own section below
+		case *rampUp > 0:
+			done := float64(totalSent+totalFailed) / float64(totalRecords)
+			fmt.Printf("   Target %d records with ramp-up: %.1f%% sent with %d workers\n", totalRecords, done*100, poolSize)
+		case actualRate >= targetRate*0.99:
+			fmt.Printf("   Target rate %.0f/sec: achieved with %d workers\n", targetRate, poolSize)
+		default:
+			fmt.Printf("   Target rate %.0f/sec: NOT achieved (%.1f%% with %d workers)\n", targetRate, actualRate/targetRate*100, poolSize)
+		}
+		for i := 0; i < numFormats && fixedBody == nil; i++ {
+			if !formatListed(i) {
+				continue
+			}
+			fmt.Printf("   Format %d: %d\n", i+1, atomic.LoadUint64(&formatCounts[i]))
+		}
+		if ramp != nil {
+			ramp.printSummary()
+		}
+		if *rampUp > 0 {
+			printRampUp(*rampUp)
+		}
+		if fixedBody == nil {
+			identities.printSummary()
+		}
+		if *transportName == "http" {
+			newConns, reusedConns := atomic.LoadUint64(&connsNew), atomic.LoadUint64(&connsReused)
+			fmt.Printf("   Connections: %d opened | %d reused (%.1f%% reuse)\n", newConns, reusedConns, pct(reusedConns, newConns+reusedConns))
+		}
+		if endpoints != nil {
+			endpoints.printSummary()
+		}
+		printFDs()
+		printTLS()
+		printFailureKinds()
+		printServerErrors()
+		if *useHTTP3 {
+			printQUIC()
+		}
+		if httpVersionReport {
+			printHTTPVersions(requestedProto(transport))
+		}
+		if agents != nil {
+			agents.printSummary()
+		}
+		sentBytes := int64(atomic.LoadUint64(&totalBytes))
+		if maxBytes > 0 {
+			fmt.Printf("   Bytes: %s of %s cap (%.1f%%)\n", formatBytes(sentBytes), maxBytes.String(), float64(sentBytes)/float64(maxBytes)*100)
+		} else {
+			fmt.Printf("   Bytes: %s\n", formatBytes(sentBytes))
+		}
+		if verifyEcho {
+			fmt.Printf("   Corrupted echoes: %d (included in Failed)\n", atomic.LoadUint64(&totalCorrupted))
+			if payloadChecksum {
+				fmt.Printf("   Checksum mismatches: %d\n", atomic.LoadUint64(&checksumMismatches))
+			}
+		}
+		if serverTimeField != "" {
+			printIngestLag()
+		}
+		if strictSchema {
+			printSchemaDrift()
+		}
+		if ack != nil {
+			ack.printSummary()
+		}
+		if batched != nil {
+			batched.printSummary()
+		}
+		if twoPhase != nil {
+			twoPhase.printSummary()
+		}
+		if streamed != nil {
+			streamed.printSummary()
+		}
+		if sessions != nil {
+			sessions.printSummary()
+		}
+		if throttle != nil {
+			throttle.printSummary()
+		}
+		if *retries > 0 {
+			printRetries(*retries)
+		}
+		if *transportName == "ws" {
+			printWebSocket()
+		} else if n := atomic.LoadUint64(&totalReconnects); n > 0 {
+			fmt.Printf("   Reconnects: %d | Downtime: %v\n", n,
+				time.Duration(atomic.LoadInt64(&totalDowntimeNs)).Round(time.Millisecond))
+		}
+		if fleet != nil {
+			fleet.printSummary()
+		}
+		if silentDevs != nil {
+			printSilence(startTime)
+		}
+		if energyResetHour >= 0 {
+			printEnergyResets(resetHourSet)
+		}
+		if *statePath != "" {
+			printState(*statePath)
+		}
+		if scenario != nil {
+			printScenario()
+		}
+		if faultMeanDuration > 0 {
+			printFaultBursts()
+		}
+		if deviceSeq {
+			printOrdering()
+		}
+		distOK = !assertDistribution || checkDistribution(os.Stdout)
+		if sla != nil {
+			fmt.Printf("   SLA p99 %v: %d breaches | %v in breach\n", sla.SLA, sla.breaches, sla.breachTime.Round(time.Second))
+		}
+		if *heartbeatInterval > 0 {
+			fmt.Printf("   Heartbeats: %d | Failed: %d\n",
+				atomic.LoadUint64(&heartbeatSent), atomic.LoadUint64(&heartbeatFailed))
+		}
+		printOmittedFields()
+		printPrettySavings()
+		printMultipart()
+		if gzipBodies {
+			printGzip()
+		}
+		if headerChaos > 0 {
+			printHeaderChaos()
+		}
+		if shuffleKeys > 0 {
+			printKeyOrder()
+		}
+		if schemaMix != nil {
+			printSchemaMix()
+		}
+		if payloadLocales != nil {
+			printLocales()
+		}
+		if sites != nil {
+			printSites()
+		}
+		if sweepRates != nil {
+			printSweepTable(sweepSteps)
+		}
+		if benchCfg != nil {
+			printBench(benched, *benchCfg)
+		}
+		if payloads != nil {
+			payloads.printSummary(*replayPath)
+		}
+		if replayEvents != nil {
+			printReplay(replayed, *replaySpeed)
+		}
+		if transports != nil {
+			printCompareTable(compared)
+		}
+	}
+	if sweepRates != nil && *sweepJSON != "" {
+		if err := writeSweepJSON(*sweepJSON, sweepSteps); err != nil {
+			fmt.Println("❌ sweep JSON:", err)
+		} else if rich {
+			fmt.Printf("   Sweep results written to %s\n", *sweepJSON)
+		}
+	}
+	if benchCfg != nil && *benchJSON != "" {
+		if err := writeJSONFile(*benchJSON, benched); err != nil {
+			fmt.Println("❌ bench JSON:", err)
+		} else if rich {
+			fmt.Printf("   Bench results written to %s\n", *benchJSON)
+		}
+	}
+	if *summaryJSON != "" {
+		summary := newRunSummary(runID, elapsed, targetRate, abandoned)
+		summary.Goodput = goodput(ack)
+		if err := writeJSONFile(*summaryJSON, summary); err != nil {
+			fmt.Println("❌ summary JSON:", err)
+		} else if rich {
+			fmt.Printf("   Summary written to %s\n", *summaryJSON)
+		}
+	}
+	if *pushgateway != "" {
+		if err := pushToGateway(*pushgateway, *pushJob, pushMetrics(retried())); err != nil {
+			fmt.Println("❌ Pushgateway:", err)
+		} else if rich {
+			fmt.Printf("   Metrics pushed to %s (job %s)\n", *pushgateway, *pushJob)
+		}
+	}
+	if transports != nil && *compareJSON != "" {
+		if err := writeJSONFile(*compareJSON, compared); err != nil {
+			fmt.Println("❌ compare JSON:", err)
+		} else if rich {
+			fmt.Printf("   Comparison written to %s\n", *compareJSON)
+		}
+	}
+	if *statsCSV != "" {
+		if statsErr != nil {
+			fmt.Println("❌ stats CSV:", statsErr)
+		} else if rich {
+			fmt.Printf("   Per-second stats written to %s\n", *statsCSV)
+		}
+	}
+	if results != nil {
+		if err := results.Close(); err != nil {
+			fmt.Println("❌ results CSV:", err)
+		} else if rich {
+			fmt.Printf("   Results written to %s\n", *resultsCSV)
+		}
+	}
+	if dryRun != nil {
+		if err := dryRun.Close(); err != nil {
+			fmt.Println("❌ dry run:", err)
+		} else if rich {
+			fmt.Printf("   %d payloads written to %s\n", dryRun.n, dryRun.name)
+		}
+	}
+	if failures != nil {
+		if err := failures.Close(); err != nil {
+			fmt.Println("❌ failure capture:", err)
+		} else if rich {
+			fmt.Printf("   %d failed sends captured in %s\n", failures.n, *failuresPath)
+		}
 	}
-	//b- stable 
+	stopMetrics()
+	if !drainedOK {
+		os.Exit(1)
+	}
+	if !distOK {
+		fmt.Println("❌ Generated values drifted from their configured distribution")
+		os.Exit(1)
+	}
+	//b- stable
 	// start := time.Now()
 	// endTime := start.Add(runDuration)
 	// ticker := time.NewTicker(time.Second / time.Duration(rate))
@@ -192,103 +1634,413 @@ func main() {
 	// }
 }
 
-func sendFormat(client *http.Client, url string, formatType int) bool {
-	now := time.Now()
-	deviceNum := rand.Intn(50) + 1
+// clock and sleep are how runGlobalRate tells the time and waits for the
+// next second, swapped out by its tests.
+var (
+	clock = time.Now
+	sleep = pause
+)
 
-	var payload any
-	switch formatType {
-	case 0:
-		p := Format1Payload{
-			DeviceType:     "current_format",
-			DeviceName:     fmt.Sprintf("ESIN%d", deviceNum),
-			DeviceID:       fmt.Sprintf("ESDL%d", rand.Intn(600)+1),
-			Date:           now.Format("02/01/2006"),
-			Time:           now.Format("15:04:05"),
-			SignalStrength: "-1",
-		}
-		p.Data.SerialNo = fmt.Sprintf("%d", rand.Intn(600)+1)
-		p.Data.S1V = 6200 + rand.Intn(200) - 100
-		p.Data.TotalOutputPower = 147000 + rand.Intn(500)
-		p.Data.F = 700 + rand.Intn(50)
-		p.Data.TodayE = rand.Intn(1000)
-		p.Data.TotalE = 500000 + rand.Intn(10000)
-		p.Data.InvTemp = 650 + rand.Intn(10) - 5
-		p.Data.FaultCode = randomFault()
-		payload = p
+// runGlobalRate sends exactly rate records every second, rotating formats,
+// until endTime. With rampUp > 0 the rate climbs linearly from 0 over the
+// first rampUp of the run first. With payloads it sends those in order
+// instead of generating, and stops early if they run out.
+//
+// Second n starts at an absolute deadline, start+n·1s, rather than a second
+// after the previous one finished, so the time spent submitting and waking
+// up never adds up into drift: a run of d sends rate·d records.
+func runGlobalRate(pool *workerPool, rate int, rampUp time.Duration, endTime time.Time, payloads *payloadReplay) {
+	start := clock()
+	seconds, n := 0, 0
+	for clock().Before(endTime) && !stopReached() {
+		if throttle != nil {
+			rate = throttle.next()
+		}
+		now, ramping := rampRate(rate, rampUp, time.Duration(seconds)*time.Second)
+		counter := &steadyRecords
+		if ramping {
+			counter = &rampRecords
+		}
+
+		// A) Exact data count (strict 600/sec). A slow server backs
+		// submit up, so the deadline is checked per record as well.
+		for i := 0; i < now && !stopReached() && clock().Before(endTime); i++ {
+			if payloads != nil {
+				ev, ok := payloads.pick()
+				if !ok {
+					return
+				}
+				if !pool.submitBody(ev.Format, ev.Device, ev.Name, ev.Body) {
+					return
+				}
+				atomic.AddUint64(counter, 1)
+				continue
+			}
+			formatType := rotateFormat(n)
+			n++
+			if ramp != nil {
+				formatType = ramp.pick(clock())
+			}
+			device, ok := pickDevice()
+			if !ok {
+				break // every device is silent; try again next second
+			}
+			if !pool.submit(formatType, device) {
+				return
+			}
+			atomic.AddUint64(counter, 1)
+		}
+
+		seconds++
+
+		// Sleep until the next second's deadline; one that's already past
+		// (a slow tick) is caught up at once
+		sleep(start.Add(time.Duration(seconds) * time.Second).Sub(clock()))
+	}
+}
+
+func sendFormat(sender Sender, formatType, deviceNum int) bool {
+	if fixedBody != nil {
+		return deliver(sender, formatType, "", fixedBody, false)
+	}
+	var seq uint64
+	if deviceSeq {
+		seq = nextSeq(deviceNum)
+	}
+	rec, err := generate(formatType, deviceNum, seq)
+	if err != nil {
+		logError("generate failed", "format", formatType+1, "device", deviceNum, "err", err)
+		return false
+	}
+	identities.note(rec.Device, rec.DeviceID, rec.Serial)
+	ok := deliver(sender, formatType, rec.Device, rec.Body, rec.Shuffled)
+	if ok && deviceSeq {
+		noteDelivered(deviceNum, seq)
+	}
+	return ok
+}
+
+// record is one generated payload ready for the wire, with the identity
+// fields it carries.
+type record struct {
+	Body                     []byte
+	Device, DeviceID, Serial string
+	Shuffled                 bool // keys reordered by -json-field-order-randomize
+}
+
+// generate builds one payload of formatType for deviceNum and applies the
+// payload-shaping options. seq is the -device-seq number, 0 for none.
+func generate(formatType, deviceNum int, seq uint64) (record, error) {
+	now := deviceClock(deviceNum)
+	noteSite(deviceNum)
+	noteLocale(deviceNum)
+	return buildRecord(formatType, deviceNum, now, seq, deviceReading(formatType, deviceNum, now), true)
+}
+
+// buildRecord is generate from rd on. Only a live record is counted in
+// the schema and omitted-field stats and goes through the per-record
+// chaos (-fields-subset, -json-field-order-randomize).
+func buildRecord(formatType, deviceNum int, now time.Time, seq uint64, rd reading, live bool) (record, error) {
+	meta := PayloadMeta{RunID: runID, Seq: seq}
+	schema := 0
+	if schemaMix != nil && formatType != protobufFormat {
+		schema = deviceSchema(deviceNum)
+		meta.SchemaVersion = schemaVariants[formatType][schema].Version
+	}
+	if sites != nil {
+		meta.DeviceGeo = deviceGeo(deviceNum)
+	}
+	if customFormats != nil {
+		rec, err := generateCustom(customFormats[formatType], deviceNum, now, meta, rd)
+		if err != nil {
+			return record{}, err
+		}
+		return finishRecord(rec.Body, rec, live)
+	}
+
+	var jsonData []byte
+	var rec record
+	switch p := generateFormat(formatType, deviceNum, now, meta, rd).(type) {
+	case *Format1Payload:
+		rec = record{Device: p.DeviceName, DeviceID: p.DeviceID, Serial: p.Data.SerialNo}
+		if formatType == protobufFormat {
+			// none of the JSON transforms below apply
+			body, err := marshalFormat5(p)
+			if err != nil {
+				return record{}, fmt.Errorf("protobuf encode error: %w", err)
+			}
+			rec.Body = body
+			return rec, nil
+		}
+		jsonData = marshalFormat1(p)
+	case *Format2Payload:
+		rec = record{Device: p.DeviceName, DeviceID: p.DeviceID, Serial: p.Data.SerialNo}
+		jsonData = marshalFormat2(p)
+	case *Format3Payload:
+		rec = record{Device: p.DeviceName, DeviceID: p.DeviceID, Serial: p.SerialNo}
+		jsonData = marshalFormat3(p)
+	case *Format4Payload:
+		rec = record{Device: p.DeviceName}
+		jsonData = marshalFormat4(p)
+	}
 
+	var err error
+	if schemaMix != nil {
+		if jsonData, err = applySchema(jsonData, formatType, schema); err != nil {
+			return record{}, fmt.Errorf("JSON re-encode error: %w", err)
+		}
+		if live {
+			atomic.AddUint64(&schemaCounts[schema], 1)
+		}
+	}
+	if live && fieldsSubset > 0 && rng.Float64() < fieldsSubset {
+		if jsonData, err = omitOptionalFields(jsonData, formatType); err != nil {
+			return record{}, fmt.Errorf("JSON re-encode error: %w", err)
+		}
+	}
+	return finishRecord(jsonData, rec, live)
+}
+
+// GenerateFormat fills in the payload struct built-in format (0-based, as
+// -weights counts them) sends for deviceNum at now: a *Format1Payload for
+// format 0 and protobuf, *Format2Payload to *Format4Payload for formats 1
+// to 3. Every value is drawn from src within the configured ranges (see
+// sampleReading) and nothing else is read or changed: no device state,
+// stats or run tags, so the same src gives the same payload. An unknown
+// format panics.
+func GenerateFormat(format int, src *rand.Rand, now time.Time, deviceNum int) any {
+	return generateFormat(format, deviceNum, now, PayloadMeta{}, sampleReading(src, now, deviceNum))
+}
+
+// generateFormat fills in the payload struct format sends for deviceNum
+// at now, its device clock time, with rd as its values and meta as its
+// tags. It marshals and sends nothing, and changes nothing either: where
+// rd came from decides whether the record advanced the device's state.
+func generateFormat(formatType, deviceNum int, now time.Time, meta PayloadMeta, rd reading) any {
+	switch formatType {
 	case 1:
-		p := Format2Payload{
-			DeviceType: "format_2_inverter",
-			DeviceName: fmt.Sprintf("INV_B_%d", deviceNum),
-			DeviceID:   fmt.Sprintf("TYPE_B_%d", rand.Intn(600)+1),
-		}
-		p.Data.SerialNo = fmt.Sprintf("SN_%d", rand.Intn(600)+1)
-		p.Data.Voltage = 6200 + rand.Intn(200) - 100
-		p.Data.PowerOutput = 147000 + rand.Intn(500)
-		p.Data.Frequency = 700 + rand.Intn(50)
-		p.Data.DailyEnergy = rand.Intn(1000)
-		p.Data.TotalEnergy = 500 + rand.Intn(100)
-		p.Data.Temperature = 65 + rand.Intn(10)
-		p.Data.ErrorCode = randomFault()
-		payload = p
+		p := &Format2Payload{
+			DeviceType:  "format_2_inverter",
+			DeviceName:  deviceName("INV_B_", deviceNum),
+			DeviceID:    fmt.Sprintf("TYPE_B_%d", deviceIDNum(deviceNum)),
+			PayloadMeta: meta,
+		}
+		p.Data.SerialNo = serialNo(1, deviceNum, rd.Serial)
+		p.Data.Voltage = rd.Voltage
+		p.Data.PowerOutput = rd.Power
+		p.Data.Frequency = rd.Frequency
+		p.Data.DailyEnergy = rd.TodayEnergy
+		p.Data.TotalEnergy = rd.TotalEnergy / 1000 // kWh
+		p.Data.Temperature = rd.Temperature / 10   // whole °C
+		p.Data.ErrorCode = rd.Fault
+		return p
 
 	case 2:
-		p := Format3Payload{
+		return &Format3Payload{
 			DeviceType:  "flat_format_device",
-			DeviceName:  fmt.Sprintf("FLAT_%d", deviceNum),
-			DeviceID:    fmt.Sprintf("FL_%d", rand.Intn(600)+1),
-			SerialNo:    fmt.Sprintf("FLAT_SN_%d", rand.Intn(600)+1),
-			V:           6200 + rand.Intn(200) - 100,
-			P:           147000 + rand.Intn(500),
-			Hz:          700 + rand.Intn(50),
-			EnergyDaily: rand.Intn(1000),
-			EnergyTotal: 500000 + rand.Intn(10000),
-			Temp:        650 + rand.Intn(10) - 5,
-			Status:      randomFault(),
-		}
-		payload = p
+			DeviceName:  deviceName("FLAT_", deviceNum),
+			DeviceID:    fmt.Sprintf("FL_%d", deviceIDNum(deviceNum)),
+			SerialNo:    serialNo(2, deviceNum, rd.Serial),
+			V:           rd.Voltage,
+			P:           rd.Power,
+			Hz:          rd.Frequency,
+			EnergyDaily: rd.TodayEnergy,
+			EnergyTotal: rd.TotalEnergy,
+			Temp:        rd.Temperature,
+			Status:      rd.Fault,
+			PayloadMeta: meta,
+		}
 
 	case 3:
-		p := Format4Payload{
-			DeviceType: "unit_conversion_device",
-			DeviceName: fmt.Sprintf("CONV_%d", deviceNum),
-		}
-		voltage := 6200 + rand.Intn(200) - 100
-		power := 147000 + rand.Intn(500)
-		p.Data.VoltageMillivolts = voltage * 10
-		p.Data.PowerKilowatts = float64(power) / 1000
-		p.Data.FreqHz = 700 + rand.Intn(50)
-		p.Data.TodayKwh = float64(rand.Intn(1000)) / 1000
-		p.Data.TotalKwh = float64(500000+rand.Intn(10000)) / 1000
-		p.Data.TempFahrenheit = (650+rand.Intn(10)-5)*9/5 + 32
-		p.Data.FaultStatus = randomFault()
-		payload = p
-	}
-
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		fmt.Println("❌ JSON marshal error:", err)
-		return false
+		p := &Format4Payload{
+			DeviceType:  "unit_conversion_device",
+			DeviceName:  deviceName("CONV_", deviceNum),
+			PayloadMeta: meta,
+		}
+		p.Data.VoltageMillivolts = rd.Voltage * 10
+		p.Data.PowerKilowatts = float64(rd.Power) / 1000
+		p.Data.FreqHz = rd.Frequency
+		p.Data.TodayKwh = float64(rd.TodayEnergy) / 1000
+		p.Data.TotalKwh = float64(rd.TotalEnergy) / 1000
+		p.Data.TempFahrenheit = rd.Temperature*9/50 + 32 // tenths of a °C to whole °F
+		p.Data.FaultStatus = rd.Fault
+		return p
+
+	case 0, protobufFormat:
+		// format 1, and protobuf, which carries the same fields
+		typ, prefix, idPrefix := "current_format", "ESIN", "ESDL"
+		if formatType == protobufFormat {
+			typ, prefix, idPrefix = "protobuf_format", "PB_", "PBDL"
+		}
+		p := &Format1Payload{
+			DeviceType:     typ,
+			DeviceName:     deviceName(prefix, deviceNum),
+			DeviceID:       fmt.Sprintf("%s%d", idPrefix, deviceIDNum(deviceNum)),
+			Date:           now.Format("02/01/2006"),
+			Time:           now.Format("15:04:05"),
+			SignalStrength: rd.Signal,
+			PayloadMeta:    meta,
+		}
+		p.Data.SerialNo = serialNo(formatType, deviceNum, rd.Serial)
+		p.Data.S1V = rd.Voltage
+		p.Data.TotalOutputPower = rd.Power
+		p.Data.F = rd.Frequency
+		p.Data.TodayE, p.Data.TotalE = rd.TodayEnergy, rd.TotalEnergy
+		p.Data.InvTemp = rd.Temperature
+		p.Data.FaultCode = rd.Fault
+		return p
 	}
+	panic(fmt.Sprintf("generateFormat: unknown format %d", formatType))
+}
 
-	resp, err := client.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		fmt.Println("❌ POST error:", err)
-		return false
+// finishRecord applies the wire-level options every JSON format shares:
+// the checksum, key shuffling (live records only) and the JSON encoder's
+// escaping.
+func finishRecord(jsonData []byte, rec record, live bool) (record, error) {
+	var err error
+	if payloadChecksum {
+		if jsonData, err = addChecksum(jsonData); err != nil {
+			return record{}, fmt.Errorf("JSON re-encode error: %w", err)
+		}
 	}
-	defer resp.Body.Close()
+	rec.Shuffled = live && shuffleKeys > 0 && rng.Float64() < shuffleKeys
+	if rec.Shuffled {
+		if jsonData, err = shuffleKeyOrder(jsonData); err != nil {
+			return record{}, fmt.Errorf("JSON re-encode error: %w", err)
+		}
+	}
+	rec.Body = wireJSON(jsonData)
+	return rec, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		fmt.Println("⚠️  Bad response:", resp.Status)
+// deliver sends one finished body and records its latency, result row and
+// outcome. shuffled marks bodies from -json-field-order-randomize.
+func deliver(sender Sender, formatType int, device string, jsonData []byte, shuffled bool) bool {
+	msg := Message{Body: jsonData, ContentType: contentTypeFor(formatType), Device: device}
+	if attachmentSize > 0 {
+		msg.Body, msg.ContentType = multipartBody(jsonData, msg.ContentType)
+		atomic.AddUint64(&multipartBytes, uint64(len(msg.Body)))
+		atomic.AddUint64(&multipartJSONBytes, uint64(len(jsonData)))
+	}
+	if gzipBodies {
+		raw := len(msg.Body)
+		compressMessage(&msg)
+		recordGzip(formatType, raw, len(msg.Body))
+	}
+	atomic.AddUint64(&totalBytes, uint64(len(msg.Body)))
+	sendStart := time.Now()
+	var echoed []byte
+	var err error
+	var retried int
+	var target string // the replica, under -endpoints
+	ctx := withEndpoint(withRetryCount(requestCtx, &retried), &target)
+	if verifyEcho || serverTimeField != "" || strictSchema {
+		echoed, err = sender.(Exchanger).Exchange(ctx, msg)
+	} else {
+		err = sender.Send(ctx, msg)
+	}
+	latency := time.Since(sendStart)
+	if target == "" {
+		target = targetOf(sender)
+	}
+	recordLatency(latency)
+	if err != nil {
+		failedLatencyHist.Record(latency)
+	}
+	if throttle != nil {
+		throttle.note(statusOf(err))
+	}
+	if attachmentSize > 0 {
+		multipartHist.Record(latency)
+	}
+	if shuffleKeys > 0 {
+		var se *StatusError
+		noteKeyOrder(shuffled, errors.As(err, &se))
+	}
+	if results != nil {
+		results.Write(Result{
+			Time:     sendStart,
+			Format:   formatType,
+			Device:   device,
+			Endpoint: target,
+			Status:   statusOf(err),
+			Latency:  latency,
+			Bytes:    len(msg.Body),
+			Retries:  retried,
+		})
+	}
+	var response string // what the server said when it rejected the record
+	failed := func(status int, reason string) bool {
+		if failures != nil {
+			failures.Write(FailureRecord{
+				Time:        sendStart,
+				Format:      formatType + 1,
+				Device:      device,
+				Endpoint:    target,
+				Status:      status,
+				Error:       reason,
+				Response:    response,
+				ContentType: contentTypeFor(formatType),
+			}, jsonData)
+		}
 		return false
 	}
+	if err != nil {
+		noteFailure(err)
+		var se *StatusError
+		if errors.As(err, &se) {
+			response = se.Body
+			noteServerError(se)
+			if se.Body != "" {
+				logDebug("bad response", "format", formatType+1, "device", device, "status", se.Status, "body", strings.Join(strings.Fields(se.Body), " "))
+			} else {
+				logDebug("bad response", "format", formatType+1, "device", device, "status", se.Status)
+			}
+		} else {
+			logDebug("send failed", "format", formatType+1, "device", device, "err", err)
+		}
+		return failed(statusOf(err), err.Error())
+	}
+	if serverTimeField != "" {
+		recordIngestLag(sendStart, echoed)
+	}
+	if verifyEcho && payloadChecksum && fixedBody == nil {
+		if ok, err := verifyChecksum(echoed); err != nil || !ok {
+			atomic.AddUint64(&totalCorrupted, 1)
+			logDebug("echo checksum mismatch", "format", formatType+1, "device", device)
+			return failed(http.StatusOK, "echo checksum mismatch")
+		}
+	}
+	if verifyEcho {
+		path, err := diffEcho(jsonData, echoed)
+		if err != nil || path != "" {
+			atomic.AddUint64(&totalCorrupted, 1)
+			if err != nil {
+				logDebug("echo unreadable", "format", formatType+1, "device", device, "err", err)
+				return failed(http.StatusOK, "echo unreadable: "+err.Error())
+			}
+			logDebug("echo mismatch", "format", formatType+1, "device", device, "path", path)
+			return failed(http.StatusOK, "echo mismatch at "+path)
+		}
+	}
+	if strictSchema {
+		unknown, missing, err := checkSchemaDrift(formatType, jsonData, echoed)
+		if err != nil {
+			logDebug("response unreadable", "format", formatType+1, "device", device, "err", err)
+			return failed(http.StatusOK, "response unreadable: "+err.Error())
+		}
+		if len(unknown)+len(missing) > 0 {
+			recordSchemaDrift(formatType, unknown, missing)
+			logDebug("schema drift", "format", formatType+1, "device", device, "unknown", unknown, "missing", missing)
+			return failed(http.StatusOK, fmt.Sprintf("schema drift: unknown %v, missing %v", unknown, missing))
+		}
+	}
 	return true
 }
 
 func randomFault() int {
-	if rand.Float64() < 0.1 {
-		return rand.Intn(5) + 1
+	if faultRate > 0 && rng.Float64() < faultRate {
+		return faultCodes[rng.Intn(len(faultCodes))]
 	}
 	return 0
 }
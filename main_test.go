@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2026, 6, 21, 12, 0, 0, 0, time.UTC)
+
+func TestGenerateFormatTypes(t *testing.T) {
+	want := []any{&Format1Payload{}, &Format2Payload{}, &Format3Payload{}, &Format4Payload{}, &Format1Payload{}}
+	for f := range numFormats {
+		got := GenerateFormat(f, rand.New(rand.NewSource(1)), testNow, 7)
+		if reflect.TypeOf(got) != reflect.TypeOf(want[f]) {
+			t.Errorf("format %d: got %T, want %T", f, got, want[f])
+		}
+	}
+}
+
+func TestGenerateFormatRepeatsForSameSource(t *testing.T) {
+	for f := range numFormats {
+		a := GenerateFormat(f, rand.New(rand.NewSource(42)), testNow, 3)
+		b := GenerateFormat(f, rand.New(rand.NewSource(42)), testNow, 3)
+		if !reflect.DeepEqual(a, b) {
+			t.Errorf("format %d: same seed gave %+v and %+v", f, a, b)
+		}
+	}
+}
+
+func TestGenerateFormatLeavesStateAlone(t *testing.T) {
+	stateMu.Lock()
+	devices := len(devState)
+	stateMu.Unlock()
+	distMu.Lock()
+	fields := len(distStats)
+	distMu.Unlock()
+	assertDistribution = true
+	defer func() { assertDistribution = false }()
+
+	src := rand.New(rand.NewSource(1))
+	for i := range 100 {
+		GenerateFormat(i%numFormats, src, testNow, 1000+i)
+	}
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	if len(devState) != devices {
+		t.Errorf("device state grew from %d to %d devices", devices, len(devState))
+	}
+	distMu.Lock()
+	defer distMu.Unlock()
+	if len(distStats) != fields {
+		t.Errorf("distribution stats grew from %d to %d fields", fields, len(distStats))
+	}
+}
+
+func TestGenerateFormatValuesInRange(t *testing.T) {
+	in := func(name string, v int, r Range) {
+		t.Helper()
+		if float64(v) < r.Min || float64(v) > r.Max {
+			t.Errorf("%s %d outside %v..%v", name, v, r.Min, r.Max)
+		}
+	}
+	src := rand.New(rand.NewSource(5))
+	for range 200 {
+		p := GenerateFormat(0, src, testNow, 1).(*Format1Payload)
+		in("voltage", p.Data.S1V, cfg.VoltageRange)
+		in("power", p.Data.TotalOutputPower, cfg.PowerRange)
+		in("frequency", p.Data.F, cfg.FrequencyRange)
+		in("today_energy", p.Data.TodayE, cfg.TodayEnergyRange)
+		in("total_energy", p.Data.TotalE, cfg.TotalEnergyRange)
+		in("temperature", p.Data.InvTemp, cfg.TemperatureRange)
+	}
+}
+
+func TestGenerateFormatUnknownPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("format", numFormats, "didn't panic")
+		}
+	}()
+	GenerateFormat(numFormats, rand.New(rand.NewSource(1)), testNow, 1)
+}
+
+// metaVariants covers every PayloadMeta field, set and unset, and floats
+// encoding/json writes in exponent form.
+var metaVariants = []PayloadMeta{
+	{},
+	{RunID: "run-1"},
+	{RunID: "r", SchemaVersion: "v2", Seq: 18446744073709551615},
+	{Seq: 1, DeviceGeo: &DeviceGeo{SiteID: "SITE-BLR-01", Latitude: 12.9716, Longitude: 77.5946}},
+	{DeviceGeo: &DeviceGeo{SiteID: "", Latitude: -1e-7, Longitude: 1e21}},
+	{DeviceGeo: &DeviceGeo{SiteID: "x", Latitude: 0, Longitude: -0.000001}},
+}
+
+// oddNames are strings encoding/json escapes: quotes, control and HTML
+// characters, and the non-ASCII -payload-locale puts in device names.
+var oddNames = []string{"ESIN1", `a"b\c`, "tab\there\n", "<&>", "逆变器7", "☀️⚡", "Inve\u0301rter", "\u2028", "\x7f"}
+
+func TestMarshalersMatchEncodingJSON(t *testing.T) {
+	src := rand.New(rand.NewSource(1))
+	check := func(f int, got []byte, p any) {
+		t.Helper()
+		want, err := json.Marshal(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("format %d:\n got %s\nwant %s", f+1, got, want)
+		}
+	}
+	for i := range 500 {
+		meta := metaVariants[i%len(metaVariants)]
+		name := oddNames[i%len(oddNames)]
+		for f := range numBaseFormats {
+			switch p := GenerateFormat(f, src, testNow, i+1).(type) {
+			case *Format1Payload:
+				p.PayloadMeta, p.DeviceName = meta, name
+				check(f, marshalFormat1(p), p)
+			case *Format2Payload:
+				p.PayloadMeta, p.DeviceName = meta, name
+				check(f, marshalFormat2(p), p)
+			case *Format3Payload:
+				p.PayloadMeta, p.DeviceName = meta, name
+				check(f, marshalFormat3(p), p)
+			case *Format4Payload:
+				p.PayloadMeta, p.DeviceName = meta, name
+				p.Data.PowerKilowatts *= src.Float64() // fractions, not just whole watts
+				check(f, marshalFormat4(p), p)
+			}
+		}
+	}
+}
+
+func TestAppendJSONFloatMatchesEncodingJSON(t *testing.T) {
+	for _, f := range []float64{0, 1, -1, 0.1, 1.5, 123.456, 1e-6, 9.99e-7, 1e-7, 1.234e-9, 1e20, 1e21, 1.5e300, -2.5e-300} {
+		want, _ := json.Marshal(f)
+		if got := appendJSONFloat(nil, f); !bytes.Equal(got, want) {
+			t.Errorf("%v: got %s, want %s", f, got, want)
+		}
+	}
+}
+
+// nopSender accepts every message without sending it anywhere.
+type nopSender struct{}
+
+func (nopSender) Send(context.Context, Message) error { return nil }
+func (nopSender) Close() error                        { return nil }
+
+// BenchmarkSendFormat is one record's trip through the simulator without
+// the network: generation, marshaling and the bookkeeping around a send.
+func BenchmarkSendFormat(b *testing.B) {
+	for f := range numFormats {
+		b.Run(fmt.Sprintf("format%d", f+1), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; b.Loop(); i++ {
+				sendFormat(nopSender{}, f, i%100+1)
+			}
+		})
+	}
+}
+
+// BenchmarkMarshalFormat puts each format's marshaler next to json.Marshal
+// of the same payload, the encoding it replaced, so their time and
+// allocations can be compared directly.
+func BenchmarkMarshalFormat(b *testing.B) {
+	for f := range numFormats {
+		p := GenerateFormat(f, rand.New(rand.NewSource(1)), testNow, 7)
+		var marshal func() []byte
+		switch p := p.(type) {
+		case *Format1Payload:
+			p.PayloadMeta = metaVariants[3]
+			marshal = func() []byte { return marshalFormat1(p) }
+			if f == protobufFormat {
+				marshal = func() []byte { body, _ := marshalFormat5(p); return body }
+			}
+		case *Format2Payload:
+			p.PayloadMeta = metaVariants[3]
+			marshal = func() []byte { return marshalFormat2(p) }
+		case *Format3Payload:
+			p.PayloadMeta = metaVariants[3]
+			marshal = func() []byte { return marshalFormat3(p) }
+		case *Format4Payload:
+			p.PayloadMeta = metaVariants[3]
+			marshal = func() []byte { return marshalFormat4(p) }
+		}
+		b.Run(fmt.Sprintf("format%d/marshal", f+1), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				marshal()
+			}
+		})
+		b.Run(fmt.Sprintf("format%d/json", f+1), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				json.Marshal(p)
+			}
+		})
+	}
+}
+
+// fakeClock stands in for the wall clock in runGlobalRate: every reading
+// costs tick, as submitting a record does, and every sleep oversleeps.
+type fakeClock struct {
+	now             time.Time
+	tick, oversleep time.Duration
+}
+
+func (c *fakeClock) install(t *testing.T) {
+	clock = func() time.Time {
+		c.now = c.now.Add(c.tick)
+		return c.now
+	}
+	sleep = func(d time.Duration) {
+		if d > 0 {
+			c.now = c.now.Add(d + c.oversleep)
+		}
+	}
+	t.Cleanup(func() { clock, sleep = time.Now, pause })
+}
+
+// The global rate schedules second n at start+n·1s, so neither the time
+// spent submitting nor late wake-ups add up: a run of d whole seconds
+// sends rate·d records, give or take the one the deadline cuts.
+func TestRunGlobalRateKeepsToRate(t *testing.T) {
+	for _, c := range []struct {
+		name            string
+		rate            int
+		d               time.Duration
+		tick, oversleep time.Duration
+	}{
+		{"exact", 600, 30 * time.Second, 0, 0},
+		{"late wake-ups", 600, 30 * time.Second, 0, 50 * time.Millisecond},
+		{"slow submits", 4000, 10 * time.Second, 50 * time.Microsecond, 2 * time.Millisecond},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			fc := &fakeClock{now: testNow, tick: c.tick, oversleep: c.oversleep}
+			fc.install(t)
+			pool := startWorkerPool(4, nopSender{})
+			before := atomic.LoadUint64(&steadyRecords)
+			runGlobalRate(pool, c.rate, 0, testNow.Add(c.d), nil)
+			pool.close()
+
+			got := float64(atomic.LoadUint64(&steadyRecords) - before)
+			want := float64(c.rate) * c.d.Seconds()
+			if got < want-1 || got > want+1 {
+				t.Errorf("sent %.0f records, want %.0f ± 1", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets are the le bounds of the exported request latency
+// histogram.
+var latencyBuckets = []time.Duration{
+	5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+// scrapeMetrics is pushMetrics plus what only makes sense live: a latency
+// histogram (sweep, bench and compare steps restart it, which Prometheus
+// sees as a counter reset) and the run ID as an info metric.
+func scrapeMetrics(retried uint64) []byte {
+	var b bytes.Buffer
+	b.Write(pushMetrics(retried))
+	fmt.Fprintln(&b, "# TYPE solar_client_request_duration_seconds histogram")
+	for _, le := range latencyBuckets {
+		fmt.Fprintf(&b, "solar_client_request_duration_seconds_bucket{le=\"%g\"} %d\n", le.Seconds(), latencyHist.CountBelow(le))
+	}
+	n := latencyHist.Count()
+	fmt.Fprintf(&b, "solar_client_request_duration_seconds_bucket{le=\"+Inf\"} %d\n", n)
+	fmt.Fprintf(&b, "solar_client_request_duration_seconds_sum %g\n", time.Duration(atomic.LoadInt64(&latencySumNs)).Seconds())
+	fmt.Fprintf(&b, "solar_client_request_duration_seconds_count %d\n", n)
+	fmt.Fprintln(&b, "# TYPE solar_client_info gauge")
+	fmt.Fprintf(&b, "solar_client_info{run_id=%q} 1\n", runID)
+	return b.Bytes()
+}
+
+// startMetricsServer serves /metrics on addr until the returned stop is
+// called. Binding happens here, so a taken port fails before the run.
+func startMetricsServer(addr string, metrics func() []byte) (stop func(), err error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write(metrics())
+	})
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Println("❌ metrics server:", err)
+		}
+	}()
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}, nil
+}
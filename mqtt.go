@@ -0,0 +1,359 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// mqttSchemes are the broker URL schemes the MQTT client can dial.
+var mqttSchemes = []string{"tcp", "mqtt", "ssl", "tls", "mqtts", "ws", "wss"}
+
+// checkBrokerURL reports whether broker is something -transport mqtt can
+// connect to.
+func checkBrokerURL(broker string) error {
+	u, err := url.Parse(broker)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(mqttSchemes, u.Scheme) || u.Host == "" {
+		return fmt.Errorf("%q is not a broker URL like tcp://host:1883", broker)
+	}
+	return nil
+}
+
+// MQTTSender publishes each payload to one topic, the way real inverters
+// report to a broker. MQTT 3.1.1 has no content type, so Message.ContentType
+// is dropped. The connection is long-lived: when it drops, the embedded
+// ReconnectingSender redials it with backoff.
+type MQTTSender struct {
+	*ReconnectingSender
+	Broker string
+	Topic  string
+}
+
+// NewMQTTSender connects lazily, on the first Send. tlsConfig (nil for
+// defaults) applies to ssl://, tls://, mqtts:// and wss:// brokers.
+func NewMQTTSender(broker, topic, clientID string, qos byte, timeout time.Duration, tlsConfig *tls.Config) *MQTTSender {
+	dial := func(ctx context.Context) (Sender, error) {
+		c := mqtt.NewClient(mqttOptions(broker, clientID, timeout, tlsConfig))
+		if err := awaitToken(c.Connect(), broker, timeout); err != nil {
+			return nil, err
+		}
+		return &mqttConn{client: c, topic: topic, qos: qos, timeout: timeout}, nil
+	}
+	return &MQTTSender{ReconnectingSender: NewReconnectingSender(dial), Broker: broker, Topic: topic}
+}
+
+// mqttOptions are the client options every MQTT client here starts from.
+func mqttOptions(broker, clientID string, timeout time.Duration, tlsConfig *tls.Config) *mqtt.ClientOptions {
+	opts := mqtt.NewClientOptions().
+		AddBroker(broker).
+		SetClientID(clientID).
+		SetConnectTimeout(timeout).
+		SetAutoReconnect(false). // ReconnectingSender does it, and counts it
+		SetConnectRetry(false)
+	if tlsConfig != nil {
+		opts.SetTLSConfig(tlsConfig)
+	}
+	return opts
+}
+
+// awaitToken waits up to timeout for tok and returns its error.
+func awaitToken(tok mqtt.Token, broker string, timeout time.Duration) error {
+	if !tok.WaitTimeout(timeout) {
+		return fmt.Errorf("%s: timed out after %v", broker, timeout)
+	}
+	if err := tok.Error(); err != nil {
+		return fmt.Errorf("%s: %w", broker, err)
+	}
+	return nil
+}
+
+// Target is the broker and topic, used when reporting per-request results.
+func (s *MQTTSender) Target() string { return s.Broker + "/" + s.Topic }
+
+// willPayload is what a device's Last-Will says once the broker publishes it.
+type willPayload struct {
+	DeviceName string `json:"device_name"`
+	Status     string `json:"status"`
+	RunID      string `json:"run_id"`
+}
+
+// MQTTDeviceSender gives every device its own client, as each real inverter
+// has, connected on the device's first record (-mqtt-will-prefix). Each
+// registers a Last-Will on WillPrefix/<device name> that the broker
+// publishes if the session ends without a DISCONNECT. Every DropEvery, a
+// DropFraction of the connected sessions have their socket closed under
+// them, the way a device losing power or signal goes, and redial on their
+// next record. A monitor client subscribed to WillPrefix/+ counts the wills
+// the broker actually publishes for this run.
+type MQTTDeviceSender struct {
+	Broker, Topic, WillPrefix string
+	DropFraction              float64
+	DropEvery                 time.Duration
+
+	clientID  string
+	qos       byte
+	timeout   time.Duration
+	tlsConfig *tls.Config
+
+	mu         sync.Mutex
+	devices    map[string]*deviceSession
+	monitor    mqtt.Client
+	monitorErr error
+	stop       chan struct{} // closed to stop the drops
+	stopOnce   sync.Once
+	closeOnce  sync.Once
+
+	drops, wills uint64
+}
+
+// deviceSession is one device's client, and the socket under it while it's
+// connected.
+type deviceSession struct {
+	*ReconnectingSender
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func NewMQTTDeviceSender(broker, topic, willPrefix, clientID string, qos byte, timeout time.Duration, tlsConfig *tls.Config, dropFraction float64, dropEvery time.Duration) *MQTTDeviceSender {
+	s := &MQTTDeviceSender{
+		Broker: broker, Topic: topic, WillPrefix: willPrefix,
+		DropFraction: dropFraction, DropEvery: dropEvery,
+		clientID: clientID, qos: qos, timeout: timeout, tlsConfig: tlsConfig,
+		devices: make(map[string]*deviceSession),
+		stop:    make(chan struct{}),
+	}
+	s.watchWills()
+	if dropFraction > 0 {
+		go s.dropLoop()
+	}
+	return s
+}
+
+func (s *MQTTDeviceSender) Send(ctx context.Context, msg Message) error {
+	return s.session(cmp.Or(msg.Device, s.clientID)).Send(ctx, msg)
+}
+
+// session returns device's session, creating it on its first record.
+func (s *MQTTDeviceSender) session(device string) *deviceSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d, ok := s.devices[device]; ok {
+		return d
+	}
+	d := &deviceSession{}
+	d.ReconnectingSender = NewReconnectingSender(func(ctx context.Context) (Sender, error) {
+		return s.connect(device, d)
+	})
+	s.devices[device] = d
+	return d
+}
+
+// connect opens device's client with its will set. When sessions are to be
+// dropped, the socket is dialed here rather than by paho so d can close it
+// without paho sending a DISCONNECT first.
+func (s *MQTTDeviceSender) connect(device string, d *deviceSession) (Sender, error) {
+	will, _ := json.Marshal(willPayload{DeviceName: device, Status: "offline", RunID: runID})
+	var mine net.Conn // this client's socket; d.conn may be a later one's
+	opts := mqttOptions(s.Broker, s.clientID+"-"+device, s.timeout, s.tlsConfig).
+		SetWill(s.WillPrefix+"/"+device, string(will), s.qos, false).
+		SetConnectionLostHandler(func(mqtt.Client, error) {
+			d.mu.Lock()
+			if d.conn == mine {
+				d.conn = nil
+			}
+			d.mu.Unlock()
+		})
+	if s.DropFraction > 0 {
+		opts.SetCustomOpenConnectionFn(func(uri *url.URL, o mqtt.ClientOptions) (net.Conn, error) {
+			conn, err := dialBroker(uri, o)
+			if err == nil {
+				d.mu.Lock()
+				mine, d.conn = conn, conn
+				d.mu.Unlock()
+			}
+			return conn, err
+		})
+	}
+	c := mqtt.NewClient(opts)
+	if err := awaitToken(c.Connect(), s.Broker, s.timeout); err != nil {
+		return nil, err
+	}
+	return &mqttConn{client: c, topic: s.Topic, qos: s.qos, timeout: s.timeout}, nil
+}
+
+// dialBroker opens the socket paho would for a tcp:// or TLS broker.
+func dialBroker(uri *url.URL, o mqtt.ClientOptions) (net.Conn, error) {
+	d := &net.Dialer{Timeout: o.ConnectTimeout}
+	switch uri.Scheme {
+	case "tcp", "mqtt":
+		return d.Dial("tcp", uri.Host)
+	case "ssl", "tls", "mqtts":
+		return tls.DialWithDialer(d, "tcp", uri.Host, o.TLSConfig)
+	}
+	return nil, fmt.Errorf("can't drop %s:// sessions", uri.Scheme)
+}
+
+// watchWills connects the monitor and subscribes it to every device's will
+// topic before any device connects. A monitor that can't connect only
+// costs the will count, so it's reported, not fatal.
+func (s *MQTTDeviceSender) watchWills() {
+	c := mqtt.NewClient(mqttOptions(s.Broker, s.clientID+"-wills", s.timeout, s.tlsConfig))
+	if err := awaitToken(c.Connect(), s.Broker, s.timeout); err != nil {
+		s.monitorErr = err
+		return
+	}
+	err := awaitToken(c.Subscribe(s.WillPrefix+"/+", 1, func(_ mqtt.Client, m mqtt.Message) {
+		var w willPayload
+		if json.Unmarshal(m.Payload(), &w) == nil && w.Status == "offline" && w.RunID == runID {
+			atomic.AddUint64(&s.wills, 1)
+		}
+	}), s.Broker, s.timeout)
+	if err != nil {
+		s.monitorErr = err
+		c.Disconnect(250)
+		return
+	}
+	s.monitor = c
+}
+
+func (s *MQTTDeviceSender) dropLoop() {
+	t := time.NewTicker(s.DropEvery)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			s.dropSome()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// dropSome closes the sockets of DropFraction of the connected sessions,
+// rounded up, picked at random.
+func (s *MQTTDeviceSender) dropSome() {
+	s.mu.Lock()
+	var up []*deviceSession
+	for _, d := range s.devices {
+		d.mu.Lock()
+		if d.conn != nil {
+			up = append(up, d)
+		}
+		d.mu.Unlock()
+	}
+	s.mu.Unlock()
+
+	n := int(math.Ceil(s.DropFraction * float64(len(up))))
+	for _, i := range rng.Perm(len(up))[:n] {
+		d := up[i]
+		d.mu.Lock()
+		conn := d.conn
+		d.conn = nil
+		d.mu.Unlock()
+		if conn != nil {
+			conn.Close()
+			atomic.AddUint64(&s.drops, 1)
+		}
+	}
+}
+
+// Target is the broker and topic, used when reporting per-request results.
+func (s *MQTTDeviceSender) Target() string { return s.Broker + "/" + s.Topic }
+
+// settle stops the drops and gives the broker up to the send timeout to
+// publish the wills they're owed, so the count is final.
+func (s *MQTTDeviceSender) settle() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+		if s.monitor == nil {
+			return
+		}
+		for deadline := time.Now().Add(s.timeout); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if atomic.LoadUint64(&s.wills) >= atomic.LoadUint64(&s.drops) {
+				return
+			}
+		}
+	})
+}
+
+// Close disconnects every session cleanly, so no more wills fire, and then
+// the monitor.
+func (s *MQTTDeviceSender) Close() error {
+	s.settle()
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		for _, d := range s.devices {
+			d.Close()
+		}
+		s.mu.Unlock()
+		if s.monitor != nil {
+			s.monitor.Disconnect(250)
+		}
+	})
+	return nil
+}
+
+func (s *MQTTDeviceSender) printSummary() {
+	s.settle()
+	s.mu.Lock()
+	n := len(s.devices)
+	s.mu.Unlock()
+	fmt.Printf("   MQTT sessions: %d devices | %d dropped abruptly | %d Last-Will messages received on %s/+\n",
+		n, atomic.LoadUint64(&s.drops), atomic.LoadUint64(&s.wills), s.WillPrefix)
+	if s.monitorErr != nil {
+		fmt.Printf("     will monitor not connected: %v\n", s.monitorErr)
+	}
+}
+
+// mqttConn is one connected client.
+type mqttConn struct {
+	client  mqtt.Client
+	topic   string
+	qos     byte
+	timeout time.Duration
+}
+
+// Send publishes msg and, at QoS 1 and 2, waits for the broker to
+// acknowledge it. At QoS 0 it only waits for the write.
+func (c *mqttConn) Send(ctx context.Context, msg Message) error {
+	atomic.AddUint64(&totalAttempts, 1)
+	tok := c.client.Publish(c.topic, c.qos, false, msg.Body)
+	timer := time.NewTimer(c.timeout)
+	defer timer.Stop()
+	select {
+	case <-tok.Done():
+	case <-timer.C:
+		if !c.client.IsConnectionOpen() {
+			return fmt.Errorf("publish: %w before an acknowledgement", ErrConnLost)
+		}
+		return fmt.Errorf("publish: no acknowledgement after %v", c.timeout)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if err := tok.Error(); err != nil {
+		if !c.client.IsConnectionOpen() {
+			return fmt.Errorf("publish: %w: %v", ErrConnLost, err)
+		}
+		return fmt.Errorf("publish: %w", err)
+	}
+	return nil
+}
+
+func (c *mqttConn) Close() error {
+	c.client.Disconnect(250)
+	return nil
+}
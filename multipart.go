@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
+	"sync/atomic"
+	"time"
+)
+
+// attachmentSize is the size of the random diagnostic file posted next to
+// each payload as multipart/form-data (-attachment-size), 0 for plain JSON
+// bodies.
+var attachmentSize byteSize
+
+// attachment is generated once; it is random so it doesn't compress, and
+// reusing it keeps high rates from being CPU-bound on random bytes.
+var attachment []byte
+
+var (
+	multipartHist      = &Histogram{}
+	multipartBytes     uint64 // combined multipart bodies
+	multipartJSONBytes uint64 // the JSON parts alone
+)
+
+func setupAttachment() {
+	attachment = make([]byte, attachmentSize)
+	rng.Read(attachment)
+}
+
+// multipartBody wraps a JSON payload and the attachment into one
+// multipart/form-data body and returns it with its Content-Type.
+func multipartBody(payload []byte, contentType string) ([]byte, string) {
+	var buf bytes.Buffer
+	buf.Grow(len(payload) + len(attachment) + 512)
+	w := multipart.NewWriter(&buf)
+
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Disposition", `form-data; name="payload"`)
+	h.Set("Content-Type", contentType)
+	part, _ := w.CreatePart(h) // writes to a bytes.Buffer can't fail
+	part.Write(payload)
+
+	file, _ := w.CreateFormFile("attachment", "diagnostics.bin")
+	file.Write(attachment)
+	w.Close()
+	return buf.Bytes(), w.FormDataContentType()
+}
+
+func printMultipart() {
+	n := multipartHist.Count()
+	if n == 0 {
+		return
+	}
+	total, js := atomic.LoadUint64(&multipartBytes), atomic.LoadUint64(&multipartJSONBytes)
+	fmt.Printf("   Multipart uploads: %d | avg %s each (%s JSON + %s attachment)\n",
+		n, formatBytes(int64(total/n)), formatBytes(int64(js/n)), formatBytes(int64(attachmentSize)))
+	fmt.Printf("   Upload latency: p50 %v | p90 %v | p99 %v | max %v\n",
+		multipartHist.Quantile(0.50).Round(time.Microsecond), multipartHist.Quantile(0.90).Round(time.Microsecond),
+		multipartHist.Quantile(0.99).Round(time.Microsecond), multipartHist.Max().Round(time.Microsecond))
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"sync"
+)
+
+// deviceSeq tags each record with a per-device sequence number and checks
+// that deliveries complete in that order (-device-seq). partitionByDevice
+// (-partition-by-device) additionally routes every device to one fixed
+// worker, the way a keyed producer pins a device to one partition, so its
+// records can't overtake each other.
+var (
+	deviceSeq         bool
+	partitionByDevice bool
+)
+
+var (
+	seqMu      sync.Mutex
+	seqNext    = map[int]uint64{} // device -> last sequence number handed out
+	seqAcked   = map[int]uint64{} // device -> highest sequence delivered
+	outOfOrder uint64
+	seqDevices = map[int]bool{} // devices with at least one out-of-order delivery
+)
+
+// nextSeq hands out the device's next sequence number, starting at 1.
+func nextSeq(deviceNum int) uint64 {
+	seqMu.Lock()
+	defer seqMu.Unlock()
+	seqNext[deviceNum]++
+	return seqNext[deviceNum]
+}
+
+// noteDelivered records a delivered sequence number; one lower than an
+// already delivered number from the same device arrived out of order.
+func noteDelivered(deviceNum int, seq uint64) {
+	seqMu.Lock()
+	defer seqMu.Unlock()
+	if seq < seqAcked[deviceNum] {
+		outOfOrder++
+		seqDevices[deviceNum] = true
+		return
+	}
+	seqAcked[deviceNum] = seq
+}
+
+// deviceLane picks the worker a device is pinned to under
+// -partition-by-device, by a hash of its device ID like a keyed producer's
+// partitioner.
+func deviceLane(deviceNum, lanes int) int {
+	h := fnv.New32a()
+	h.Write([]byte(strconv.Itoa(deviceNum)))
+	return int(h.Sum32() % uint32(lanes))
+}
+
+func printOrdering() {
+	seqMu.Lock()
+	defer seqMu.Unlock()
+	mode := "shared workers"
+	if partitionByDevice {
+		mode = "partitioned by device"
+	}
+	fmt.Printf("   Per-device ordering (%s): %d out-of-order deliveries across %d devices\n",
+		mode, outOfOrder, len(seqDevices))
+}
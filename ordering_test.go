@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"math/rand/v2"
+	"testing"
+	"time"
+)
+
+// jitterSender takes up to max to deliver each message, so records sent
+// on different workers finish in a different order than they started.
+type jitterSender struct{ max time.Duration }
+
+func (s jitterSender) Send(context.Context, Message) error {
+	time.Sleep(rand.N(s.max))
+	return nil
+}
+
+func (jitterSender) Close() error { return nil }
+
+func TestPartitionByDeviceKeepsOrder(t *testing.T) {
+	deviceSeq, partitionByDevice = true, true
+	defer func() { deviceSeq, partitionByDevice = false, false }()
+	const devices, each = 8, 200
+	seqMu.Lock()
+	before := outOfOrder
+	acked := map[int]uint64{}
+	for d := 9001; d < 9001+devices; d++ {
+		acked[d] = seqAcked[d]
+	}
+	seqMu.Unlock()
+
+	pool := startWorkerPool(8, jitterSender{max: 300 * time.Microsecond})
+	if len(pool.lanes) != 8 {
+		t.Fatalf("%d lanes for 8 workers", len(pool.lanes))
+	}
+	for i := range devices * each {
+		pool.submit(rotateFormat(i), 9001+i%devices)
+	}
+	pool.close()
+
+	seqMu.Lock()
+	defer seqMu.Unlock()
+	for d, was := range acked {
+		if got := seqAcked[d] - was; got != each {
+			t.Errorf("device %d: %d records delivered in order, want %d", d, got, each)
+		}
+	}
+	if n := outOfOrder - before; n != 0 {
+		t.Errorf("%d out-of-order deliveries", n)
+	}
+}
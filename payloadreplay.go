@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// deviceTypes are the device_type values the base formats send, used to
+// tell which format a captured payload is.
+var deviceTypes = [numBaseFormats]string{"current_format", "format_2_inverter", "flat_format_device", "unit_conversion_device"}
+
+// payloadReplay feeds the global rate from captured payloads, one JSON
+// document per line of a .ndjson file (-replay x.ndjson), instead of
+// generating them. Only the rate loop reads it, so it needs no lock.
+type payloadReplay struct {
+	events   []replayEvent
+	loop     bool // start over at the end of the file (-replay-loop)
+	next     int
+	loops    int
+	skipped  int // malformed lines
+	disabled int // payloads of formats not in use
+}
+
+// loadPayloadReplay reads path, skipping lines that aren't JSON. Each
+// payload's format comes from its device_type and its device from its
+// device_name, so stats and -results-csv read as for generated records;
+// anything unrecognised counts as format 1.
+func loadPayloadReplay(path string, loop bool) (*payloadReplay, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := &payloadReplay{loop: loop}
+	br := bufio.NewReader(f)
+	for {
+		line, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			r.add(line)
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if len(r.events) == 0 {
+		return nil, fmt.Errorf("%s: no payloads to replay (%d malformed lines, %d of formats not in use)", path, r.skipped, r.disabled)
+	}
+	return r, nil
+}
+
+func (r *payloadReplay) add(line []byte) {
+	var head struct {
+		DeviceType string `json:"device_type"`
+		DeviceName string `json:"device_name"`
+	}
+	if json.Unmarshal(line, &head) != nil {
+		r.skipped++ // not JSON, or not an object
+		return
+	}
+	format := 0
+	for i, t := range deviceTypes {
+		if head.DeviceType == t {
+			format = i
+		}
+	}
+	if !formatOn(format) {
+		r.disabled++
+		return
+	}
+	r.events = append(r.events, replayEvent{Format: format, Device: deviceNumber(head.DeviceName), Name: head.DeviceName, Body: line})
+}
+
+// pick returns the next payload, or false once the file is used up and
+// not looping.
+func (r *payloadReplay) pick() (replayEvent, bool) {
+	if r.next == len(r.events) {
+		if !r.loop {
+			return replayEvent{}, false
+		}
+		r.next = 0
+		r.loops++
+	}
+	ev := r.events[r.next]
+	r.next++
+	return ev, true
+}
+
+func (r *payloadReplay) printSummary(path string) {
+	sent := r.next + r.loops*len(r.events)
+	fmt.Printf("   Replay: %d payloads submitted from %s (%d in the file", sent, path, len(r.events))
+	if r.loops > 0 {
+		fmt.Printf(", looped %d times", r.loops)
+	}
+	fmt.Println(")")
+	if r.skipped > 0 || r.disabled > 0 {
+		fmt.Printf("   Replay: %d malformed lines skipped | %d payloads of formats not in use skipped\n", r.skipped, r.disabled)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// perDeviceJitter is how far (as a fraction of the interval) each device's
+// report may land from its nominal slot.
+const perDeviceJitter = 0.1
+
+// runPerDevice models a fleet where every device reports on its own cadence
+// rather than sharing a global rate. Each device keeps a fixed format (drawn
+// from the mix with -weights), starts at a random offset within the first
+// interval and then reports every interval ± jitter until endTime. It
+// blocks until scheduling is over.
+func runPerDevice(pool *workerPool, interval time.Duration, endTime time.Time) {
+	var sched sync.WaitGroup
+	for d := 1; d <= numDevices; d++ {
+		sched.Add(1)
+		go func(deviceNum int) {
+			defer sched.Done()
+			format := rotateFormat(deviceNum - 1)
+			if ramp != nil { // a fixed -weights mix
+				format = ramp.pick(time.Now())
+			}
+			next := time.Now().Add(time.Duration(rng.Int63n(int64(interval))))
+			for next.Before(endTime) && !stopReached() {
+				pause(time.Until(next))
+				if stopReached() || isSilent(deviceNum) {
+					return
+				}
+				pool.submit(format, deviceNum)
+
+				jitter := (rng.Float64()*2 - 1) * perDeviceJitter * float64(interval)
+				next = next.Add(interval + time.Duration(jitter))
+			}
+		}(d)
+	}
+	sched.Wait()
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Sizing assumptions for -workers 0 (auto). By Little's law a pool of N
+// workers sustains N / latency requests per second, so we size for the
+// assumed latency with 2x headroom and cap it so a huge -rate can't spawn
+// an unbounded number of goroutines and sockets. The cap also scales with
+// the CPUs available, so a container with a small quota isn't
+// oversubscribed to the point where latency measures the scheduler.
+const (
+	assumedLatencySec = 0.25
+	workerHeadroom    = 2
+	minWorkers        = 4
+	maxAutoWorkers    = 5000
+	maxWorkersPerCPU  = 500
+	laneBuffer        = 4 // queued jobs per worker with -partition-by-device
+)
+
+// autoWorkers picks a pool size able to sustain rate records/sec on cpus
+// CPUs.
+func autoWorkers(rate, cpus float64) int {
+	n := int(math.Ceil(rate * assumedLatencySec * workerHeadroom))
+	limit := min(maxAutoWorkers, max(int(cpus*maxWorkersPerCPU), minWorkers))
+	return min(max(n, minWorkers), limit)
+}
+
+// sustainableRate is the records/sec a pool of n workers can be expected to
+// keep up with at the assumed latency.
+func sustainableRate(n int) float64 {
+	return float64(n) / assumedLatencySec
+}
+
+type job struct {
+	format int
+	device int
+	name   string // with body, the device name it was captured under
+	body   []byte // exact payload to resend instead of generating one
+}
+
+// workerPool sends records on a fixed number of goroutines. submit blocks
+// when every worker is busy, so a slow server slows the send loop down
+// instead of piling up goroutines.
+type workerPool struct {
+	jobs     chan job
+	lanes    []chan job // one per worker with -partition-by-device, else nil
+	wg       sync.WaitGroup
+	inflight sync.WaitGroup // submitted but not yet finished
+	pending  int64          // same count, readable while stuck
+}
+
+func startWorkerPool(n int, sender Sender) *workerPool {
+	p := &workerPool{jobs: make(chan job, n)}
+	for i := 0; i < n; i++ {
+		jobs := p.jobs
+		if partitionByDevice {
+			// A lane only drains as fast as its one worker, like a
+			// partition; a slow device holds up the devices behind it.
+			jobs = make(chan job, laneBuffer)
+			p.lanes = append(p.lanes, jobs)
+		}
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for j := range jobs {
+				p.run(sender, j)
+				atomic.AddInt64(&p.pending, -1)
+				p.inflight.Done()
+			}
+		}()
+	}
+	return p
+}
+
+func (p *workerPool) run(sender Sender, j job) {
+	if stopReached() || pastDeadline() {
+		return // drop whatever was queued before the stop
+	}
+	if maxRecords > 0 && atomic.AddUint64(&recordsStarted, 1) > maxRecords {
+		return // another worker took the last record under -max-records
+	}
+	var ok bool
+	if j.body != nil {
+		ok = deliver(sender, j.format, j.name, j.body, false)
+	} else {
+		ok = sendFormat(sender, j.format, j.device)
+	}
+	if ok {
+		atomic.AddUint64(&totalSent, 1)
+		atomic.AddUint64(&formatCounts[j.format], 1)
+	} else {
+		atomic.AddUint64(&totalFailed, 1)
+		atomic.AddUint64(&formatFailed[j.format], 1)
+	}
+}
+
+// submit queues a record, waiting for a free worker. It reports false,
+// with the record not queued, if the run stops or its deadline passes first.
+func (p *workerPool) submit(format, device int) bool {
+	return p.enqueue(job{format: format, device: device})
+}
+
+// submitBody queues a captured payload to be sent again as is.
+func (p *workerPool) submitBody(format, device int, name string, body []byte) bool {
+	return p.enqueue(job{format: format, device: device, name: name, body: body})
+}
+
+func (p *workerPool) enqueue(j job) bool {
+	jobs := p.jobs
+	if p.lanes != nil {
+		jobs = p.lanes[deviceLane(j.device, len(p.lanes))]
+	}
+	p.inflight.Add(1)
+	atomic.AddInt64(&p.pending, 1)
+	select {
+	case jobs <- j:
+		return true
+	case <-stopping:
+	case <-runOver:
+	}
+	atomic.AddInt64(&p.pending, -1)
+	p.inflight.Done()
+	return false
+}
+
+// drain waits until everything submitted so far has finished, leaving the
+// pool open. It must not race with submit.
+func (p *workerPool) drain() {
+	p.inflight.Wait()
+}
+
+// close stops accepting jobs and waits for the queued ones to finish.
+func (p *workerPool) close() {
+	close(p.jobs)
+	for _, l := range p.lanes {
+		close(l)
+	}
+	p.wg.Wait()
+}
+
+// waitDrained waits for drained to close, giving up after timeout (0 waits
+// forever). When it gives up it reports how many jobs and heartbeats were
+// still queued or in flight; those are abandoned.
+func waitDrained(drained <-chan struct{}, timeout time.Duration, p *workerPool) (abandoned int64, ok bool) {
+	if timeout == 0 {
+		<-drained
+		return 0, true
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-drained:
+		return 0, true
+	case <-timer.C:
+		return atomic.LoadInt64(&p.pending) + atomic.LoadInt64(&heartbeatPending), false
+	}
+}
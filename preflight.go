@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// activeFormats lists the formats this run will actually send.
+func activeFormats() []int {
+	if fixedBody != nil {
+		return []int{0} // one body whatever the format slot
+	}
+	var fs []int
+	for _, f := range enabledFormats {
+		if ramp == nil || ramp.From[f] > 0 || ramp.To[f] > 0 {
+			fs = append(fs, f)
+		}
+	}
+	return fs
+}
+
+// smokeBodyLimit caps how much of each answer -smoke prints.
+const smokeBodyLimit = 200
+
+// preflight sends one record of each active format straight to sender,
+// outside the stats, and reports whether the server accepted them all.
+// With showAnswers (-smoke) it also prints each answer's status and body,
+// when the transport returns them.
+func preflight(sender Sender, showAnswers bool) error {
+	fmt.Printf("🛫 Preflight against %s\n", targetOf(sender))
+	// Preflight checks the server takes well-formed requests; it runs
+	// before any worker, so switching chaos off here doesn't race.
+	chaos := headerChaos
+	headerChaos = 0
+	defer func() { headerChaos = chaos }()
+	var failed error
+	for _, f := range activeFormats() {
+		body, device := fixedBody, ""
+		if body == nil {
+			rec, err := preflightRecord(f)
+			if err != nil {
+				return err
+			}
+			body, device = rec.Body, rec.Device
+		}
+		msg := Message{Body: body, ContentType: contentTypeFor(f), Device: device}
+		if attachmentSize > 0 {
+			msg.Body, msg.ContentType = multipartBody(body, msg.ContentType)
+		}
+		if gzipBodies {
+			compressMessage(&msg)
+		}
+		start := time.Now()
+		var answer []byte
+		var err error
+		if ex, ok := sender.(Exchanger); ok && showAnswers {
+			answer, err = ex.Exchange(context.Background(), msg)
+		} else {
+			err = sender.Send(context.Background(), msg)
+		}
+		if err != nil {
+			fmt.Printf("   Format %d: ❌ %v\n", f+1, err)
+			var se *StatusError
+			if showAnswers && errors.As(err, &se) && se.Body != "" {
+				fmt.Printf("     body: %s\n", oneLine(se.Body, smokeBodyLimit))
+			}
+			if failed == nil {
+				failed = fmt.Errorf("format %d: %w", f+1, err)
+			}
+			continue
+		}
+		fmt.Printf("   Format %d: ✅ %v\n", f+1, time.Since(start).Round(time.Millisecond))
+		if len(answer) > 0 {
+			fmt.Printf("     200 OK: %s\n", oneLine(string(answer), smokeBodyLimit))
+		}
+	}
+	return failed
+}
+
+// preflightRecord builds a record of formatType for device 1 the way the
+// run would, but from sampleReading and outside the stats, so the run's
+// first record of device 1 carries on from its state as if preflight
+// hadn't happened.
+func preflightRecord(formatType int) (record, error) {
+	now := deviceClock(1)
+	return buildRecord(formatType, 1, now, 0, sampleReading(rng, now, 1), false)
+}
+
+// oneLine collapses whitespace in s and cuts it to at most n bytes.
+func oneLine(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) > n {
+		s = s[:n] + "…"
+	}
+	return s
+}
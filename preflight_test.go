@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestPreflightRecordLeavesStateAlone(t *testing.T) {
+	assertDistribution = true
+	defer func() { assertDistribution = false }()
+	stateMu.Lock()
+	_, had := devState[1]
+	stateMu.Unlock()
+	if had {
+		t.Skip("device 1 already has state")
+	}
+
+	for f := range numBaseFormats {
+		rec, err := preflightRecord(f)
+		if err != nil {
+			t.Fatalf("format %d: %v", f+1, err)
+		}
+		if len(rec.Body) == 0 {
+			t.Errorf("format %d: empty body", f+1)
+		}
+	}
+
+	stateMu.Lock()
+	_, has := devState[1]
+	stateMu.Unlock()
+	if has {
+		t.Error("preflight created state for device 1")
+	}
+	distMu.Lock()
+	defer distMu.Unlock()
+	if len(distStats) != 0 {
+		t.Errorf("preflight was counted in the value distribution: %d fields", len(distStats))
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import "google.golang.org/protobuf/proto"
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative format5.proto
+
+// protobufFormat is the index of format 5, Format 1's fields as protobuf
+// (format5.proto). It is off unless enabled with -enable-format 5. The
+// JSON-only transforms (schema mix, omitted fields, checksums, key order,
+// pretty printing) pass it by.
+const protobufFormat = numBaseFormats
+
+// format5Message copies p into the generated solar.v1.Format5Payload.
+func format5Message(p *Format1Payload) *Format5Payload {
+	m := &Format5Payload{
+		DeviceType:     p.DeviceType,
+		DeviceName:     p.DeviceName,
+		DeviceId:       p.DeviceID,
+		Date:           p.Date,
+		Time:           p.Time,
+		SignalStrength: p.SignalStrength,
+		Data: &Format5Payload_Data{
+			SerialNo:         p.Data.SerialNo,
+			S1V:              int64(p.Data.S1V),
+			TotalOutputPower: int64(p.Data.TotalOutputPower),
+			F:                int64(p.Data.F),
+			TodayE:           int64(p.Data.TodayE),
+			TotalE:           int64(p.Data.TotalE),
+			InvTemp:          int64(p.Data.InvTemp),
+			FaultCode:        int64(p.Data.FaultCode),
+		},
+		RunId: p.RunID,
+		Seq:   p.Seq,
+	}
+	if g := p.DeviceGeo; g != nil {
+		m.SiteId, m.Latitude, m.Longitude = g.SiteID, g.Latitude, g.Longitude
+	}
+	return m
+}
+
+// marshalFormat5 encodes p as a solar.v1.Format5Payload. It fails only on
+// strings that aren't valid UTF-8, which proto3 doesn't allow.
+func marshalFormat5(p *Format1Payload) ([]byte, error) {
+	return proto.Marshal(format5Message(p))
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// TestMarshalFormat5RoundTrip decodes marshalFormat5's output into the
+// generated Format5Payload and checks every field comes back where the
+// schema puts it.
+func TestMarshalFormat5RoundTrip(t *testing.T) {
+	src := rand.New(rand.NewSource(1))
+	for i, meta := range metaVariants {
+		p := GenerateFormat(protobufFormat, src, testNow, i+1).(*Format1Payload)
+		p.PayloadMeta = meta
+		p.DeviceName = oddNames[i%len(oddNames)]
+
+		body, err := marshalFormat5(p)
+		if err != nil {
+			t.Fatalf("record %d: %v", i, err)
+		}
+		var got Format5Payload
+		if err := proto.Unmarshal(body, &got); err != nil {
+			t.Fatalf("record %d: %v", i, err)
+		}
+		if unknown := got.ProtoReflect().GetUnknown(); len(unknown) > 0 {
+			t.Errorf("record %d: %d bytes of fields format5.proto doesn't have", i, len(unknown))
+		}
+
+		want := &Format5Payload{
+			DeviceType:     p.DeviceType,
+			DeviceName:     p.DeviceName,
+			DeviceId:       p.DeviceID,
+			Date:           p.Date,
+			Time:           p.Time,
+			SignalStrength: p.SignalStrength,
+			Data: &Format5Payload_Data{
+				SerialNo:         p.Data.SerialNo,
+				S1V:              int64(p.Data.S1V),
+				TotalOutputPower: int64(p.Data.TotalOutputPower),
+				F:                int64(p.Data.F),
+				TodayE:           int64(p.Data.TodayE),
+				TotalE:           int64(p.Data.TotalE),
+				InvTemp:          int64(p.Data.InvTemp),
+				FaultCode:        int64(p.Data.FaultCode),
+			},
+			RunId: p.RunID,
+			Seq:   p.Seq,
+		}
+		if g := p.DeviceGeo; g != nil {
+			want.SiteId, want.Latitude, want.Longitude = g.SiteID, g.Latitude, g.Longitude
+		}
+		if !proto.Equal(&got, want) {
+			t.Errorf("record %d:\n got %v\nwant %v", i, &got, want)
+		}
+	}
+}
+
+func TestMarshalFormat5RejectsInvalidUTF8(t *testing.T) {
+	p := GenerateFormat(protobufFormat, rand.New(rand.NewSource(1)), testNow, 1).(*Format1Payload)
+	p.DeviceName = "ESIN\xff"
+	if _, err := marshalFormat5(p); err == nil {
+		t.Error("a device name that isn't UTF-8 encoded")
+	}
+}
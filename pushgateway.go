@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// pushMetrics builds the run's final counters in the Prometheus text
+// format. run_id is a grouping label in the push URL, so it isn't repeated
+// per sample.
+func pushMetrics(retried uint64) []byte {
+	var b bytes.Buffer
+	fmt.Fprintln(&b, "# TYPE solar_client_sent_total counter")
+	for i := range formatCounts {
+		fmt.Fprintf(&b, "solar_client_sent_total{format=\"%d\"} %d\n", i+1, atomic.LoadUint64(&formatCounts[i]))
+	}
+	fmt.Fprintln(&b, "# TYPE solar_client_failed_total counter")
+	for i := range formatFailed {
+		fmt.Fprintf(&b, "solar_client_failed_total{format=\"%d\"} %d\n", i+1, atomic.LoadUint64(&formatFailed[i]))
+	}
+	fmt.Fprintln(&b, "# TYPE solar_client_retried_total counter")
+	fmt.Fprintf(&b, "solar_client_retried_total %d\n", retried)
+	fmt.Fprintln(&b, "# TYPE solar_client_bytes_total counter")
+	fmt.Fprintf(&b, "solar_client_bytes_total %d\n", atomic.LoadUint64(&totalBytes))
+
+	fmt.Fprintln(&b, "# TYPE solar_client_latency_seconds summary")
+	for _, q := range []float64{0.5, 0.9, 0.99} {
+		fmt.Fprintf(&b, "solar_client_latency_seconds{quantile=\"%g\"} %g\n", q, latencyHist.Quantile(q).Seconds())
+	}
+	fmt.Fprintf(&b, "solar_client_latency_seconds_sum %g\n", time.Duration(atomic.LoadInt64(&latencySumNs)).Seconds())
+	fmt.Fprintf(&b, "solar_client_latency_seconds_count %d\n", atomic.LoadInt64(&latencyCount))
+	return b.Bytes()
+}
+
+// pushToGateway replaces this job/run_id group on the Pushgateway with
+// the final metrics.
+func pushToGateway(gateway, job string, body []byte) error {
+	u := strings.TrimRight(gateway, "/") + "/metrics/job/" + url.PathEscape(job) + "/run_id/" + url.PathEscape(runID)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return &StatusError{Status: resp.Status, Code: resp.StatusCode}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// formatRamp shifts the format mix linearly from one set of weights to
+// another over the run (-format-ramp), like a firmware rollout moving
+// devices onto a new format.
+type formatRamp struct {
+	From, To   [numFormats]float64
+	Start, End time.Time
+}
+
+// ramp is nil unless -format-ramp or -weights is set; formats then rotate
+// evenly. -weights is a ramp whose two ends are the same mix.
+var ramp *formatRamp
+
+// parseFormatRamp parses "100,0,0,0:50,50,0,0", per-format percentages
+// at the start and at the end of the run.
+func parseFormatRamp(s string) (*formatRamp, error) {
+	from, to, ok := strings.Cut(s, ":")
+	if !ok {
+		return nil, fmt.Errorf("want FROM:TO, e.g. 100,0,0,0:50,50,0,0")
+	}
+	r := &formatRamp{}
+	var err error
+	if r.From, err = parseFormatWeights(from); err != nil {
+		return nil, err
+	}
+	if r.To, err = parseFormatWeights(to); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func parseFormatWeights(s string) ([numFormats]float64, error) {
+	var w [numFormats]float64
+	parts := strings.Split(s, ",")
+	if customFormats != nil {
+		if len(parts) != len(customFormats) {
+			return w, fmt.Errorf("want %d weights, one per -formats format, got %d in %q", len(customFormats), len(parts), s)
+		}
+	} else if len(parts) != numBaseFormats && len(parts) != len(w) {
+		return w, fmt.Errorf("want %d or %d weights, got %d in %q", numBaseFormats, len(w), len(parts), s)
+	}
+	sum := 0.0
+	for i, p := range parts {
+		n, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil || n < 0 {
+			return w, fmt.Errorf("invalid weight %q", p)
+		}
+		w[i] = n
+		sum += n
+	}
+	if sum == 0 {
+		return w, fmt.Errorf("weights %q are all zero", s)
+	}
+	for i := range w {
+		w[i] /= sum
+	}
+	return w, nil
+}
+
+// exclude moves the weight of formats not in use onto the remaining ones,
+// keeping their proportions at both ends of the ramp.
+func (r *formatRamp) exclude(off formatSet) error {
+	for _, w := range []*[numFormats]float64{&r.From, &r.To} {
+		sum := 0.0
+		for i := range w {
+			if off[i] {
+				w[i] = 0
+			}
+			sum += w[i]
+		}
+		if sum == 0 {
+			return fmt.Errorf("no weight left on the formats in use")
+		}
+		for i := range w {
+			w[i] /= sum
+		}
+	}
+	return nil
+}
+
+// weights returns the interpolated mix at t.
+func (r *formatRamp) weights(t time.Time) [numFormats]float64 {
+	progress := float64(t.Sub(r.Start)) / float64(r.End.Sub(r.Start))
+	progress = min(max(progress, 0), 1)
+	var w [numFormats]float64
+	for i := range w {
+		w[i] = r.From[i] + (r.To[i]-r.From[i])*progress
+	}
+	return w
+}
+
+// pick draws a format from the mix at t.
+func (r *formatRamp) pick(t time.Time) int {
+	w := r.weights(t)
+	x := rng.Float64()
+	for i, p := range w {
+		if x < p {
+			return i
+		}
+		x -= p
+	}
+	for i := len(w) - 1; i > 0; i-- { // rounding left x just above the total
+		if w[i] > 0 {
+			return i
+		}
+	}
+	return 0
+}
+
+func (r *formatRamp) printSummary() {
+	end := r.weights(time.Now())
+	var total uint64
+	for i := range formatCounts {
+		total += atomic.LoadUint64(&formatCounts[i])
+	}
+	if r.From == r.To {
+		fmt.Print("   Format weights: target")
+	} else {
+		fmt.Print("   Format ramp: mix at end")
+	}
+	for i, p := range end {
+		if formatListed(i) {
+			fmt.Printf(" F%d %.0f%%", i+1, p*100)
+		}
+	}
+	fmt.Print(" | whole run")
+	for i := range formatCounts {
+		if formatListed(i) {
+			fmt.Printf(" F%d %.1f%%", i+1, pct(atomic.LoadUint64(&formatCounts[i]), total))
+		}
+	}
+	fmt.Println()
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// Records submitted while the rate was still ramping up (-ramp) and once
+// it held steady.
+var rampRecords, steadyRecords uint64
+
+// rampRate is the rate for the second starting at elapsed into a run that
+// ramps linearly from 0 to rate over ramp: each second gets the rate due
+// at its end, so the first one is never empty.
+func rampRate(rate int, ramp, elapsed time.Duration) (int, bool) {
+	if elapsed >= ramp {
+		return rate, false
+	}
+	frac := min(float64(elapsed+time.Second)/float64(ramp), 1)
+	return max(1, int(math.Round(float64(rate)*frac))), true
+}
+
+// rampTarget is how many records a -duration run sends with the ramp.
+func rampTarget(rate int, ramp, d time.Duration) int {
+	n := 0
+	for t := time.Duration(0); t < d; t += time.Second {
+		r, _ := rampRate(rate, ramp, t)
+		n += r
+	}
+	return n
+}
+
+func printRampUp(ramp time.Duration) {
+	fmt.Printf("   Ramp-up: %v | %d records while ramping | %d at steady rate\n",
+		ramp, atomic.LoadUint64(&rampRecords), atomic.LoadUint64(&steadyRecords))
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+// reading is what a device measures at one instant, in the raw units of
+// Format 1 (see Config); the formats differ only in how they name and
+// scale it. Serial is the number the device's serial is built from.
+type reading struct {
+	Voltage, Power, Frequency, Temperature int
+	TodayEnergy, TotalEnergy               int // Wh
+	Fault                                  int
+	Signal                                 string // RSSI, dBm; only for the formats that report it
+	Serial                                 int
+}
+
+// deviceReading is what deviceNum reports at now in the run: the values
+// are drawn from rng and the device's state moves on, energy integrating
+// and faults and signal drifting, the same as for a sent record.
+func deviceReading(formatType, deviceNum int, now time.Time) reading {
+	rd := reading{
+		Voltage:   sampleInt("voltage", cfg.VoltageRange),
+		Power:     devicePower(now),
+		Frequency: sampleInt("frequency", cfg.FrequencyRange),
+	}
+	rd.TodayEnergy, rd.TotalEnergy = deviceEnergy(deviceNum, now, rd.Power)
+	rd.Temperature = sampleInt("temperature", cfg.TemperatureRange)
+	rd.Fault = deviceFault(deviceNum, now)
+	if customFormats == nil && (formatType == 0 || formatType == protobufFormat) {
+		rd.Signal = deviceSignal(deviceNum)
+	}
+	rd.Serial = deviceSerial(deviceNum)
+	return rd
+}
+
+// sampleReading draws a reading for deviceNum at now from src alone. It
+// reads the configuration (ranges, -diurnal, fault rate) but no device
+// state and changes nothing, so the same src gives the same reading: the
+// energy counters are drawn from their ranges rather than integrated, and
+// the signal is drawn around the device's starting level.
+func sampleReading(src *rand.Rand, now time.Time, deviceNum int) reading {
+	rd := reading{
+		Voltage:   int(cfg.VoltageRange.SampleFrom(src)),
+		Power:     int(cfg.PowerRange.SampleFrom(src)),
+		Frequency: int(cfg.FrequencyRange.SampleFrom(src)),
+	}
+	if diurnal {
+		rd.Power = int(float64(rd.Power) * daylight(now))
+	}
+	rd.TodayEnergy = int(cfg.TodayEnergyRange.SampleFrom(src))
+	rd.TotalEnergy = int(cfg.TotalEnergyRange.SampleFrom(src))
+	rd.Temperature = int(cfg.TemperatureRange.SampleFrom(src))
+	if faultRate > 0 && src.Float64() < faultRate {
+		rd.Fault = faultCodes[src.Intn(len(faultCodes))]
+	}
+	level := startSignal(deviceNum) + src.NormFloat64()*1.5
+	rd.Signal = strconv.Itoa(int(min(signalBest, max(signalWorst, level))))
+	rd.Serial = identityOf(deviceNum).Serial
+	return rd
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ErrConnLost can be wrapped by a transport to say "this connection is dead,
+// redial me" when the underlying error isn't one of the usual socket errors.
+var ErrConnLost = errors.New("connection lost")
+
+var totalReconnects uint64
+var totalDowntimeNs int64
+
+// Dialer opens a fresh underlying transport.
+type Dialer func(ctx context.Context) (Sender, error)
+
+// ReconnectingSender wraps a stateful transport (stream, WebSocket, MQTT, ...)
+// and transparently redials it with backoff when a send hits a dead
+// connection. Stateless transports like HTTPSender don't need it.
+type ReconnectingSender struct {
+	Dial       Dialer
+	BackoffMin time.Duration
+	BackoffMax time.Duration
+
+	mu        sync.Mutex
+	cur       Sender
+	redial    chan struct{} // closed when the redial in progress ends, nil when none is
+	redialErr error         // why the last redial gave up
+}
+
+func NewReconnectingSender(dial Dialer) *ReconnectingSender {
+	return &ReconnectingSender{
+		Dial:       dial,
+		BackoffMin: 100 * time.Millisecond,
+		BackoffMax: 5 * time.Second,
+	}
+}
+
+func (r *ReconnectingSender) Send(ctx context.Context, msg Message) error {
+	s, err := r.current(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = s.Send(ctx, msg)
+	if err == nil || !isConnDead(err) {
+		return err
+	}
+
+	// Connection died under us: redial once and resend on the new one
+	s, err = r.reconnect(ctx, s)
+	if err != nil {
+		return err
+	}
+	return s.Send(ctx, msg)
+}
+
+func (r *ReconnectingSender) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cur == nil {
+		return nil
+	}
+	err := r.cur.Close()
+	r.cur = nil
+	return err
+}
+
+func (r *ReconnectingSender) current(ctx context.Context) (Sender, error) {
+	r.mu.Lock()
+	if r.cur == nil && r.redial != nil {
+		ch := r.redial
+		r.mu.Unlock()
+		return r.awaitRedial(ctx, ch)
+	}
+	defer r.mu.Unlock()
+	if r.cur != nil {
+		return r.cur, nil
+	}
+	s, err := r.Dial(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("dial: %w", err)
+	}
+	r.cur = s
+	return s, nil
+}
+
+// reconnect replaces dead with a freshly dialed sender. If another goroutine
+// already replaced it, the new one is returned without dialing again, and
+// if one is redialing, its outcome is awaited. The redial backs off between
+// attempts without holding r.mu, and gives up once the run is stopping or
+// past its deadline, so a server that stays down can't hold the run open.
+func (r *ReconnectingSender) reconnect(ctx context.Context, dead Sender) (Sender, error) {
+	r.mu.Lock()
+	if r.cur != nil && r.cur != dead {
+		defer r.mu.Unlock()
+		return r.cur, nil
+	}
+	if r.redial != nil {
+		ch := r.redial
+		r.mu.Unlock()
+		return r.awaitRedial(ctx, ch)
+	}
+	if r.cur != nil {
+		r.cur.Close()
+		r.cur = nil
+	}
+	ch := make(chan struct{})
+	r.redial, r.redialErr = ch, nil
+	r.mu.Unlock()
+
+	down := time.Now()
+	defer func() {
+		atomic.AddInt64(&totalDowntimeNs, int64(time.Since(down)))
+	}()
+	finish := func(s Sender, err error) (Sender, error) {
+		r.mu.Lock()
+		r.cur, r.redial, r.redialErr = s, nil, err
+		r.mu.Unlock()
+		close(ch)
+		return s, err
+	}
+
+	backoff := r.BackoffMin
+	for {
+		s, err := r.Dial(ctx)
+		if err == nil {
+			atomic.AddUint64(&totalReconnects, 1)
+			return finish(s, nil)
+		}
+		select {
+		case <-ctx.Done():
+			return finish(nil, fmt.Errorf("reconnect: %w", ctx.Err()))
+		case <-stopping:
+			return finish(nil, fmt.Errorf("reconnect: run stopped: %w", err))
+		case <-runOver:
+			return finish(nil, fmt.Errorf("reconnect: run ended: %w", err))
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > r.BackoffMax {
+			backoff = r.BackoffMax
+		}
+	}
+}
+
+// awaitRedial waits for the redial signalled by ch and returns its result.
+func (r *ReconnectingSender) awaitRedial(ctx context.Context, ch chan struct{}) (Sender, error) {
+	select {
+	case <-ch:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("reconnect: %w", ctx.Err())
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cur == nil {
+		return nil, r.redialErr
+	}
+	return r.cur, nil
+}
+
+// isConnDead reports whether err means the connection itself is gone rather
+// than a single bad send.
+func isConnDead(err error) bool {
+	switch {
+	case errors.Is(err, ErrConnLost),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, net.ErrClosed),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.EPIPE),
+		errors.Is(err, syscall.ECONNABORTED):
+		return true
+	}
+	return false
+}
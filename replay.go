@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// replayEvent is one recorded request: when it went out relative to the
+// start of the recording, and which format and device sent it. Events from
+// a -record-failures capture also carry the exact payload and device name.
+type replayEvent struct {
+	At     time.Duration
+	Format int
+	Device int
+	Name   string
+	Body   []byte
+}
+
+// loadReplay reads a recording into events ordered by time, keeping those
+// inside [from, to) of the recording (to 0 = the end). A -results-csv
+// recording supplies the timing, formats and devices, and payloads are
+// regenerated on replay; a .jsonl -record-failures capture is replayed
+// byte for byte.
+func loadReplay(path string, from, to time.Duration) ([]replayEvent, error) {
+	if strings.HasSuffix(path, ".jsonl") {
+		return loadFailureReplay(path, from, to)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(rows) < 2 {
+		return nil, fmt.Errorf("%s: no recorded requests", path)
+	}
+	col := map[string]int{}
+	for i, name := range rows[0] {
+		col[name] = i
+	}
+	for _, name := range []string{"timestamp", "format", "device"} {
+		if _, ok := col[name]; !ok {
+			return nil, fmt.Errorf("%s: missing %q column (want a -results-csv file)", path, name)
+		}
+	}
+
+	type row struct {
+		t      time.Time
+		format int
+		device int
+	}
+	var recs []row
+	for i, r := range rows[1:] {
+		t, err := time.Parse(time.RFC3339Nano, r[col["timestamp"]])
+		if err != nil {
+			return nil, fmt.Errorf("%s: row %d: %w", path, i+2, err)
+		}
+		format, err := strconv.Atoi(r[col["format"]])
+		if err != nil || format < 1 || format > numFormats {
+			return nil, fmt.Errorf("%s: row %d: invalid format %q", path, i+2, r[col["format"]])
+		}
+		recs = append(recs, row{t, format - 1, deviceNumber(r[col["device"]])})
+	}
+	slices.SortFunc(recs, func(a, b row) int { return a.t.Compare(b.t) })
+
+	times := make([]time.Time, len(recs))
+	events := make([]replayEvent, len(recs))
+	for i, r := range recs {
+		times[i] = r.t
+		events[i] = replayEvent{Format: r.format, Device: r.device}
+	}
+	return windowEvents(path, times, events, from, to)
+}
+
+// loadFailureReplay reads a -record-failures capture.
+func loadFailureReplay(path string, from, to time.Duration) ([]replayEvent, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var recs []FailureRecord
+	dec := json.NewDecoder(f)
+	for line := 1; ; line++ {
+		var r FailureRecord
+		if err := dec.Decode(&r); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: record %d: %w", path, line, err)
+		}
+		if r.Format < 1 || r.Format > numFormats {
+			return nil, fmt.Errorf("%s: record %d: invalid format %d", path, line, r.Format)
+		}
+		recs = append(recs, r)
+	}
+	if len(recs) == 0 {
+		return nil, fmt.Errorf("%s: no captured failures", path)
+	}
+	slices.SortFunc(recs, func(a, b FailureRecord) int { return a.Time.Compare(b.Time) })
+
+	times := make([]time.Time, len(recs))
+	events := make([]replayEvent, len(recs))
+	for i := range recs {
+		r := &recs[i]
+		times[i] = r.Time
+		events[i] = replayEvent{Format: r.Format - 1, Device: deviceNumber(r.Device), Name: r.Device, Body: r.body()}
+	}
+	return windowEvents(path, times, events, from, to)
+}
+
+// windowEvents sets each event's offset from the first recorded time and
+// keeps those inside [from, to), shifted to start at from.
+func windowEvents(path string, times []time.Time, all []replayEvent, from, to time.Duration) ([]replayEvent, error) {
+	var events []replayEvent
+	for i, ev := range all {
+		at := times[i].Sub(times[0])
+		if at < from || (to > 0 && at >= to) {
+			continue
+		}
+		ev.At = at - from
+		events = append(events, ev)
+	}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("%s: no recorded requests in the replay window", path)
+	}
+	return events, nil
+}
+
+// deviceNumber recovers the device number from a name like "INV_B_12",
+// falling back to device 1 for rows without one.
+func deviceNumber(name string) int {
+	i := len(name)
+	for i > 0 && name[i-1] >= '0' && name[i-1] <= '9' {
+		i--
+	}
+	n, err := strconv.Atoi(name[i:])
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
+
+// parseReplayWindow parses "start:end" offsets into the recording, e.g.
+// "2h:3h", ":30m" or "6h:". An empty end means the end of the recording.
+func parseReplayWindow(s string) (from, to time.Duration, err error) {
+	a, b, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("want start:end, e.g. 2h:3h")
+	}
+	if a != "" {
+		if from, err = time.ParseDuration(a); err != nil {
+			return 0, 0, err
+		}
+	}
+	if b != "" {
+		if to, err = time.ParseDuration(b); err != nil {
+			return 0, 0, err
+		}
+		if to <= from {
+			return 0, 0, fmt.Errorf("end %v is not after start %v", to, from)
+		}
+	}
+	return from, to, nil
+}
+
+// replaySpan is how long the recording covers.
+func replaySpan(events []replayEvent) time.Duration {
+	return events[len(events)-1].At
+}
+
+// ReplayStats is what a replay achieved.
+type ReplayStats struct {
+	Replayed int
+	Disabled int           // skipped as not in use (-disable-format, -enable-format)
+	Span     time.Duration // recorded time the replayed requests covered
+	Took     time.Duration
+}
+
+// runReplay submits each event at its recorded offset divided by speed.
+func runReplay(pool *workerPool, events []replayEvent, speed float64) ReplayStats {
+	start := time.Now()
+	var st ReplayStats
+	for _, ev := range events {
+		if stopReached() {
+			break
+		}
+		if wait := time.Until(start.Add(time.Duration(float64(ev.At) / speed))); wait > time.Millisecond {
+			pause(wait)
+		}
+		st.Span = ev.At
+		if !formatOn(ev.Format) {
+			st.Disabled++
+			continue
+		}
+		if ev.Body != nil {
+			pool.submitBody(ev.Format, ev.Device, ev.Name, ev.Body)
+		} else {
+			pool.submit(ev.Format, ev.Device)
+		}
+		st.Replayed++
+	}
+	pool.drain()
+	st.Took = time.Since(start)
+	return st
+}
+
+func printReplay(st ReplayStats, speed float64) {
+	fmt.Printf("   Replay: %d requests covering %v of the recording at %gx | took %v\n",
+		st.Replayed, st.Span.Round(time.Millisecond), speed, st.Took.Round(time.Millisecond))
+	if st.Disabled > 0 {
+		fmt.Printf("   Replay: %d requests of formats not in use skipped\n", st.Disabled)
+	}
+	if st.Span > 0 && st.Took > 0 {
+		target := float64(st.Replayed) / (st.Span.Seconds() / speed)
+		fmt.Printf("   Replay speed: %.1fx achieved vs %gx target | %.2f/sec vs %.2f/sec\n",
+			st.Span.Seconds()/st.Took.Seconds(), speed, float64(st.Replayed)/st.Took.Seconds(), target)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Result is the outcome of one request, as written by -results-csv.
+type Result struct {
+	Time     time.Time
+	Format   int
+	Device   string
+	Endpoint string
+	Status   int // HTTP status, 0 if the request never got an answer
+	Latency  time.Duration
+	Bytes    int
+	Retries  int
+}
+
+var resultsHeader = []string{"timestamp", "format", "device", "endpoint", "status", "latency_ms", "bytes", "retries"}
+
+// ResultsWriter appends one CSV row per request. It is safe for concurrent
+// use; rows are buffered and only hit the disk on Flush/Close.
+type ResultsWriter struct {
+	mu  sync.Mutex
+	f   *os.File
+	buf *bufio.Writer
+	w   *csv.Writer
+}
+
+func NewResultsWriter(path string) (*ResultsWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	buf := bufio.NewWriterSize(f, 256*1024)
+	rw := &ResultsWriter{f: f, buf: buf, w: csv.NewWriter(buf)}
+	if err := rw.w.Write(resultsHeader); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return rw, nil
+}
+
+func (rw *ResultsWriter) Write(r Result) {
+	row := []string{
+		r.Time.Format(time.RFC3339Nano),
+		strconv.Itoa(r.Format + 1),
+		r.Device,
+		r.Endpoint,
+		strconv.Itoa(r.Status),
+		strconv.FormatFloat(float64(r.Latency)/float64(time.Millisecond), 'f', 3, 64),
+		strconv.Itoa(r.Bytes),
+		strconv.Itoa(r.Retries),
+	}
+	rw.mu.Lock()
+	rw.w.Write(row) // errors surface on Close via csv.Writer.Error
+	rw.mu.Unlock()
+}
+
+func (rw *ResultsWriter) Close() error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	rw.w.Flush()
+	if err := rw.w.Error(); err != nil {
+		rw.f.Close()
+		return err
+	}
+	if err := rw.buf.Flush(); err != nil {
+		rw.f.Close()
+		return err
+	}
+	return rw.f.Close()
+}
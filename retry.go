@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Retry totals (-retries): extra attempts made, records that got through
+// on one of them, and records that were still failing when retries ran out.
+var (
+	totalRetried     uint64
+	retriesRecovered uint64
+	retriesExhausted uint64
+)
+
+// RetrySender resends messages that failed transiently: no answer at all,
+// 429, or a 5xx. Waits double from Backoff up to BackoffMax, with jitter
+// so a fleet of workers doesn't retry in lockstep. Retries never wait past
+// Deadline or a shutdown, so they can't stretch the run.
+type RetrySender struct {
+	Next       Sender
+	Retries    int
+	Backoff    time.Duration
+	BackoffMax time.Duration
+	Deadline   time.Time // zero = none
+}
+
+// NewRetrySender wraps next, keeping it usable as an Exchanger if it is one.
+func NewRetrySender(next Sender, retries int, backoff time.Duration, deadline time.Time) Sender {
+	r := &RetrySender{Next: next, Retries: retries, Backoff: backoff, BackoffMax: 5 * time.Second, Deadline: deadline}
+	if _, ok := next.(Exchanger); ok {
+		return retryExchanger{r}
+	}
+	return r
+}
+
+func (r *RetrySender) Send(ctx context.Context, msg Message) error {
+	_, err := r.do(ctx, func() ([]byte, error) { return nil, r.Next.Send(ctx, msg) })
+	return err
+}
+
+func (r *RetrySender) do(ctx context.Context, attempt func() ([]byte, error)) ([]byte, error) {
+	body, err := attempt()
+	for n := 1; err != nil && n <= r.Retries && retryable(err); n++ {
+		wait := r.backoff(n)
+		if !r.Deadline.IsZero() && time.Now().Add(wait).After(r.Deadline) {
+			break
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, err
+		case <-stopping:
+			return nil, err
+		}
+		atomic.AddUint64(&totalRetried, 1)
+		if c, ok := ctx.Value(retryCountKey{}).(*int); ok {
+			*c = n
+		}
+		if body, err = attempt(); err == nil {
+			atomic.AddUint64(&retriesRecovered, 1)
+			return body, nil
+		}
+	}
+	if err != nil && r.Retries > 0 && retryable(err) {
+		atomic.AddUint64(&retriesExhausted, 1)
+	}
+	return body, err
+}
+
+// backoff is the wait before retry n (1-based): Backoff·2^(n-1), capped,
+// then drawn from its upper half.
+func (r *RetrySender) backoff(n int) time.Duration {
+	d := min(r.Backoff<<(n-1), r.BackoffMax)
+	if d <= 0 { // shifted out of range
+		d = r.BackoffMax
+	}
+	return d/2 + time.Duration(rng.Int63n(int64(d/2)+1))
+}
+
+// retryable reports whether err looks transient, i.e. worth sending again.
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, errAborted) {
+		return false
+	}
+	switch code := statusOf(err); {
+	case code == 0, code == http.StatusTooManyRequests, code >= 500:
+		return true
+	}
+	return false
+}
+
+// Target is where Next delivers to.
+func (r *RetrySender) Target() string { return targetOf(r.Next) }
+
+func (r *RetrySender) Close() error { return r.Next.Close() }
+
+// retryExchanger is a RetrySender over an Exchanger.
+type retryExchanger struct{ *RetrySender }
+
+func (r retryExchanger) Exchange(ctx context.Context, msg Message) ([]byte, error) {
+	return r.do(ctx, func() ([]byte, error) { return r.Next.(Exchanger).Exchange(ctx, msg) })
+}
+
+// retryCountKey carries a *int through a Send's context; RetrySender sets
+// it to the number of retries the message took, for -results-csv.
+type retryCountKey struct{}
+
+func withRetryCount(ctx context.Context, n *int) context.Context {
+	return context.WithValue(ctx, retryCountKey{}, n)
+}
+
+func printRetries(retries int) {
+	fmt.Printf("   Retries: %d extra attempts | %d records recovered | %d still failing after %d retries\n",
+		atomic.LoadUint64(&totalRetried), atomic.LoadUint64(&retriesRecovered), atomic.LoadUint64(&retriesExhausted), retries)
+}
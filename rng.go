@@ -0,0 +1,42 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// rng is the source behind every random choice the simulator makes: devices,
+// field values, faults, formats and chaos. -seed fixes it so a run can be
+// reproduced. Workers draw from it concurrently, so the exact sequence of
+// payloads only repeats single-threaded (-workers 1); with more workers the
+// same values come out, but which request gets which depends on scheduling.
+var rng = rand.New(&lockedSource{src: rand.NewSource(time.Now().UnixNano())})
+
+// runSeed is the seed rng was started from, printed so any run can be
+// repeated with -seed.
+var runSeed int64
+
+// seedRandom restarts rng from seed.
+func seedRandom(seed int64) {
+	runSeed = seed
+	rng = rand.New(&lockedSource{src: rand.NewSource(seed)})
+}
+
+// lockedSource makes a rand.Source safe for the worker pool to share.
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.src.Seed(seed)
+}
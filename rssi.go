@@ -0,0 +1,46 @@
+package main
+
+import (
+	"math"
+	"strconv"
+)
+
+// Signal strength (RSSI, dBm) as Format 1 reports it. "-1" is what a
+// logger sends when it has no reading.
+const (
+	signalBest  = -50
+	signalWorst = -110
+	noSignal    = "-1"
+)
+
+// signalDropoutRate is the fraction (0-1) of reports taken during a
+// dropout (-signal-dropout-rate): no reading, or one weaker than
+// signalWorst.
+var signalDropoutRate = 0.02
+
+// deviceSignal is the RSSI a device reports now. Each device starts at a
+// level of its own, derived from its number so reruns agree, then drifts a
+// few dBm per report within signalBest..signalWorst.
+func deviceSignal(deviceNum int) string {
+	if signalDropoutRate > 0 && rng.Float64() < signalDropoutRate {
+		if rng.Intn(2) == 0 {
+			return noSignal
+		}
+		return strconv.Itoa(signalWorst - 1 - rng.Intn(10))
+	}
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	st := stateOf(deviceNum)
+	if st.signal == 0 {
+		st.signal = startSignal(deviceNum)
+	} else {
+		st.signal = min(signalBest, max(signalWorst, st.signal+rng.NormFloat64()*1.5))
+	}
+	return strconv.Itoa(int(math.Round(st.signal)))
+}
+
+// startSignal is the level deviceNum's signal starts its drift from.
+func startSignal(deviceNum int) float64 {
+	h := splitmix64(uint64(deviceNum) ^ 0x51a7)
+	return signalWorst + float64(h%(signalBest-signalWorst+1))
+}
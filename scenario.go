@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ScriptedFault makes one device report a fault code for a window of the
+// run, overriding the random fault model for that device meanwhile.
+type ScriptedFault struct {
+	Device   int           `yaml:"device"`
+	Code     int           `yaml:"code"`
+	Start    time.Duration `yaml:"start"`    // offset from the start of the run
+	Duration time.Duration `yaml:"duration"` // then the device recovers
+
+	fired uint64 // records that carried this fault
+}
+
+// FaultScenario is the -fault-scenario file, e.g.
+//
+//	faults:
+//	  - {device: 12, code: 3, start: 2m, duration: 90s}
+type FaultScenario struct {
+	Faults []*ScriptedFault `yaml:"faults"`
+}
+
+var (
+	scenario      *FaultScenario // nil without -fault-scenario
+	scenarioStart time.Time
+)
+
+// The random fault model: each record carries a fault with probability
+// faultRate (-fault-rate), its code drawn evenly from faultCodes
+// (-fault-codes).
+var (
+	faultRate  = 0.1
+	faultCodes = []int{1, 2, 3, 4, 5}
+)
+
+// parseFaultCodes parses "3" or "1,2,7" into the codes to draw from.
+func parseFaultCodes(s string) ([]int, error) {
+	var codes []int
+	for _, f := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil {
+			return nil, fmt.Errorf("invalid fault code %q", f)
+		}
+		if n == 0 {
+			return nil, fmt.Errorf("code 0 means no fault")
+		}
+		codes = append(codes, n)
+	}
+	return codes, nil
+}
+
+func loadFaultScenario(path string) (*FaultScenario, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sc := &FaultScenario{}
+	if err := yaml.Unmarshal(b, sc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(sc.Faults) == 0 {
+		return nil, fmt.Errorf("%s: no faults", path)
+	}
+	for i, f := range sc.Faults {
+		switch {
+		case f.Device < 1:
+			return nil, fmt.Errorf("%s: fault %d: device must be 1 or more", path, i+1)
+		case f.Code == 0:
+			return nil, fmt.Errorf("%s: fault %d: code 0 means no fault", path, i+1)
+		case f.Start < 0 || f.Duration <= 0:
+			return nil, fmt.Errorf("%s: fault %d: start must not be negative and duration must be positive", path, i+1)
+		}
+	}
+	return sc, nil
+}
+
+// deviceFault is the fault code a device reports at now, its clock's time:
+// a scripted one while its window is open, otherwise the random model's.
+func deviceFault(deviceNum int, now time.Time) int {
+	if scenario != nil {
+		at := time.Since(scenarioStart)
+		for _, f := range scenario.Faults {
+			if f.Device == deviceNum && at >= f.Start && at < f.Start+f.Duration {
+				atomic.AddUint64(&f.fired, 1)
+				return f.Code
+			}
+		}
+	}
+	if faultMeanDuration > 0 {
+		return burstFault(deviceNum, now)
+	}
+	return randomFault()
+}
+
+func printScenario() {
+	fmt.Println("   Scripted faults:")
+	for _, f := range scenario.Faults {
+		n := atomic.LoadUint64(&f.fired)
+		state := "fired"
+		if n == 0 {
+			state = "never fired"
+		}
+		fmt.Printf("     device %d code %d at +%v for %v: %s (%d records)\n",
+			f.Device, f.Code, f.Start, f.Duration, state, n)
+	}
+}
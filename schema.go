@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// schemaVariant is one firmware schema version of a base format: the
+// fields it adds and the fields it renames relative to version 1.
+type schemaVariant struct {
+	Version string
+	Add     map[string]any    // dotted path -> value
+	Rename  map[string]string // old dotted path -> new dotted path
+}
+
+// schemaVariants lists, per format, the versions a fleet mid-rollout can
+// report. Version 1 is the base struct unchanged; 2 adds fields; 3 also
+// renames the temperature field.
+var schemaVariants = [4][]schemaVariant{
+	{
+		{Version: "1"},
+		{Version: "2", Add: map[string]any{"firmware_version": "2.1.0", "data.power_factor": 0.98}},
+		{Version: "3", Add: map[string]any{"firmware_version": "3.0.2", "data.power_factor": 0.98},
+			Rename: map[string]string{"data.inv_temp": "data.inverter_temp"}},
+	},
+	{
+		{Version: "1"},
+		{Version: "2", Add: map[string]any{"firmware_version": "2.1.0", "data.reactive_power_var": 1200}},
+		{Version: "3", Add: map[string]any{"firmware_version": "3.0.2", "data.reactive_power_var": 1200},
+			Rename: map[string]string{"data.temp_celsius": "data.temperature_c"}},
+	},
+	{
+		{Version: "1"},
+		{Version: "2", Add: map[string]any{"fw": "2.1.0", "PF": 0.98}},
+		{Version: "3", Add: map[string]any{"fw": "3.0.2", "PF": 0.98},
+			Rename: map[string]string{"temp": "temperature"}},
+	},
+	{
+		{Version: "1"},
+		{Version: "2", Add: map[string]any{"firmware_version": "2.1.0", "readings.power_factor": 0.98}},
+		{Version: "3", Add: map[string]any{"firmware_version": "3.0.2", "readings.power_factor": 0.98},
+			Rename: map[string]string{"readings.temp_f": "readings.temperature_f"}},
+	},
+}
+
+// schemaMix is the percentage of devices on each schema version (-schema-mix),
+// nil when the whole fleet is on the base schema and no schema_version is sent.
+var schemaMix []int
+
+var schemaCounts [3]uint64 // sends per schema version
+
+// parseSchemaMix parses "70,20,10" into per-version percentages summing to 100.
+func parseSchemaMix(s string) ([]int, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) < 2 || len(parts) > len(schemaVariants[0]) {
+		return nil, fmt.Errorf("want 2-%d percentages, got %d", len(schemaVariants[0]), len(parts))
+	}
+	mix := make([]int, len(parts))
+	sum := 0
+	for i, p := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid percentage %q", p)
+		}
+		mix[i] = n
+		sum += n
+	}
+	if sum != 100 {
+		return nil, fmt.Errorf("percentages sum to %d, want 100", sum)
+	}
+	return mix, nil
+}
+
+// deviceSchema returns the schema version index a device runs. Devices are
+// split across versions in order of device number, so each device stays on
+// one version for the whole run and the split matches the percentages.
+// Devices added mid-run wrap around the same split.
+func deviceSchema(deviceNum int) int {
+	pos := (deviceNum - 1) % numDevices * 100 / numDevices
+	acc := 0
+	for i, pct := range schemaMix {
+		acc += pct
+		if pos < acc {
+			return i
+		}
+	}
+	return len(schemaMix) - 1
+}
+
+// applySchema reshapes a version-1 payload into variant v of its format.
+func applySchema(body []byte, formatType, v int) ([]byte, error) {
+	variant := schemaVariants[formatType][v]
+	if len(variant.Add) == 0 && len(variant.Rename) == 0 {
+		return body, nil
+	}
+	return reencode(body, func(m map[string]any) {
+		for from, to := range variant.Rename {
+			if val, ok := getPath(m, from); ok {
+				deletePath(m, from)
+				setPath(m, to, val)
+			}
+		}
+		for path, val := range variant.Add {
+			setPath(m, path, val)
+		}
+	})
+}
+
+func printSchemaMix() {
+	var total uint64
+	for i := range schemaCounts {
+		total += atomic.LoadUint64(&schemaCounts[i])
+	}
+	fmt.Print("   Schema versions:")
+	for i := range schemaMix {
+		n := atomic.LoadUint64(&schemaCounts[i])
+		fmt.Printf(" v%s %d (%.1f%%)", schemaVariants[0][i].Version, n, pct(n, total))
+	}
+	fmt.Println()
+}
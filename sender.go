@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+)
+
+// Message is one marshaled payload plus what a transport needs to know
+// about its encoding.
+type Message struct {
+	Body        []byte
+	ContentType string
+	Encoding    string // Content-Encoding of Body, "" when sent as is
+	Device      string // device name, for transports with a session per device; "" when none
+}
+
+// Sender delivers one message to the ingest side.
+// Every transport (HTTP, MQTT, UDP, WebSocket, and the batching, retrying
+// and streaming wrappers around them) implements it so the generation and
+// stats code never cares how bytes leave the process.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+	Close() error
+}
+
+// Exchanger is implemented by senders that can hand back what the server
+// answered, for features that inspect response bodies.
+type Exchanger interface {
+	Exchange(ctx context.Context, msg Message) ([]byte, error)
+}
+
+// maxResponseBody caps how much of a response we ever read into memory.
+const maxResponseBody = 1 << 20
+
+// StatusError is returned when the server answered but not with 200.
+type StatusError struct {
+	Status string
+	Code   int
+	Body   string // start of the response body, see errorBodyLimit
+}
+
+func (e *StatusError) Error() string {
+	return "bad response: " + e.Status
+}
+
+// statusOf maps a Send result to an HTTP-ish status code: 200 on success,
+// the server's code for a StatusError, 0 when there was no answer at all.
+func statusOf(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Code
+	}
+	return 0
+}
+
+// connection reuse, as seen by httptrace on every request
+var connsReused uint64
+var connsNew uint64
+
+var connTrace = &httptrace.ClientTrace{
+	GotConn: func(info httptrace.GotConnInfo) {
+		if info.Reused {
+			atomic.AddUint64(&connsReused, 1)
+		} else {
+			atomic.AddUint64(&connsNew, 1)
+		}
+	},
+	TLSHandshakeDone: recordTLS,
+}
+
+// HTTPSender POSTs each payload as its own request.
+type HTTPSender struct {
+	Client *http.Client
+	URL    string
+	Header http.Header // extra headers set on every request
+
+	UserAgents *userAgentPool // one drawn per request; nil keeps Go's default
+}
+
+func (s *HTTPSender) Send(ctx context.Context, msg Message) error {
+	_, err := s.post(ctx, msg, false)
+	return err
+}
+
+// Exchange is Send that also returns the (size-capped) response body.
+func (s *HTTPSender) Exchange(ctx context.Context, msg Message) ([]byte, error) {
+	return s.post(ctx, msg, true)
+}
+
+func (s *HTTPSender) post(ctx context.Context, msg Message, readBody bool) (body []byte, err error) {
+	ctx = httptrace.WithClientTrace(ctx, connTrace)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(msg.Body))
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+	for k, vs := range s.Header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Content-Type", msg.ContentType)
+	if msg.Encoding != "" {
+		req.Header.Set("Content-Encoding", msg.Encoding)
+	}
+	if s.UserAgents != nil {
+		req.Header.Set("User-Agent", s.UserAgents.pick())
+	}
+	if kind := applyHeaderChaos(req.Header); kind >= 0 {
+		defer func() { recordHeaderChaos(kind, err) }()
+	}
+
+	atomic.AddUint64(&totalAttempts, 1)
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if httpVersionReport {
+		recordProto(resp.Proto)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{Status: resp.Status, Code: resp.StatusCode, Body: readErrorBody(resp.Body)}
+	}
+	if !readBody {
+		return nil, nil
+	}
+	body, err = io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	return body, nil
+}
+
+// Target is the URL requests go to, used when reporting per-request results.
+func (s *HTTPSender) Target() string { return s.URL }
+
+// Close is a no-op; the shared http.Client owns the connection pool.
+func (s *HTTPSender) Close() error { return nil }
+
+// targetOf names where a sender delivers to, if it can tell us.
+func targetOf(s Sender) string {
+	if t, ok := s.(interface{ Target() string }); ok {
+		return t.Target()
+	}
+	return ""
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// serialFormats are the built-in serial styles per format; format 4 has
+// no serial field.
+var serialFormats = [numFormats]string{"%d", "SN_%d", "FLAT_SN_%d", "", "PB_%d"}
+
+// serialTypes is what {type} expands to per format.
+var serialTypes = [numFormats]string{"ESIN", "INVB", "FLAT", "", "PBUF"}
+
+// serialPart is a literal run of a template or one {field[:0Nd]}.
+type serialPart struct {
+	lit   string
+	field string
+	width int // zero-pad numeric fields to this many digits
+}
+
+// serialTemplate is a parsed -serial-template, e.g.
+// "{type}-{year}-{seq:06d}". Fields: type (the format's device type),
+// year (a manufacturing year fixed per device), seq (the device number),
+// format (its number) and hex (a hash of the device number). Every field but type
+// is stable per device, so serials are too.
+type serialTemplate []serialPart
+
+var serialFields = map[string]bool{"type": true, "year": true, "seq": true, "format": true, "hex": true}
+
+func parseSerialTemplate(s string) (serialTemplate, error) {
+	var t serialTemplate
+	for s != "" {
+		open := strings.IndexAny(s, "{}")
+		if open < 0 {
+			t = append(t, serialPart{lit: s})
+			break
+		}
+		if s[open] == '}' {
+			return nil, fmt.Errorf("unmatched } in %q", s)
+		}
+		if open > 0 {
+			t = append(t, serialPart{lit: s[:open]})
+		}
+		end := strings.IndexByte(s[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed { in %q", s)
+		}
+		p, err := parseSerialField(s[open+1 : open+end])
+		if err != nil {
+			return nil, err
+		}
+		t = append(t, p)
+		s = s[open+end+1:]
+	}
+	if len(t) == 0 {
+		return nil, fmt.Errorf("empty template")
+	}
+	return t, nil
+}
+
+// parseSerialField parses "seq" or "seq:06d".
+func parseSerialField(f string) (serialPart, error) {
+	name, spec, hasSpec := strings.Cut(f, ":")
+	if !serialFields[name] {
+		return serialPart{}, fmt.Errorf("unknown field {%s} (want type, year, seq, format or hex)", f)
+	}
+	p := serialPart{field: name}
+	if hasSpec {
+		digits, ok := strings.CutSuffix(spec, "d")
+		n, err := strconv.Atoi(digits)
+		if !ok || !strings.HasPrefix(digits, "0") || err != nil || n < 1 || n > 20 {
+			return serialPart{}, fmt.Errorf("invalid width %q in {%s} (want e.g. :06d)", spec, f)
+		}
+		if name == "type" || name == "hex" {
+			return serialPart{}, fmt.Errorf("{%s} takes no width", name)
+		}
+		p.width = n
+	}
+	return p, nil
+}
+
+func (t serialTemplate) render(format, deviceNum int) string {
+	var b strings.Builder
+	h := splitmix64(uint64(deviceNum) ^ 0x5e41a1)
+	for _, p := range t {
+		switch p.field {
+		case "":
+			b.WriteString(p.lit)
+		case "type":
+			b.WriteString(serialTypes[format])
+		case "hex":
+			fmt.Fprintf(&b, "%08X", uint32(h))
+		default:
+			n := map[string]int{"year": 2018 + int((h>>32)%7), "seq": deviceNum, "format": format + 1}[p.field]
+			fmt.Fprintf(&b, "%0*d", p.width, n)
+		}
+	}
+	return b.String()
+}
+
+// serialTemplates holds -serial-template per format, nil entries keeping
+// the built-in style.
+var serialTemplates [numFormats]serialTemplate
+
+// serialTemplateFlag is the repeatable -serial-template: "TEMPLATE" for
+// every format with a serial, or "N=TEMPLATE" for format N alone.
+type serialTemplateFlag struct{ set []string }
+
+func (f *serialTemplateFlag) String() string { return strings.Join(f.set, " ") }
+
+func (f *serialTemplateFlag) Set(v string) error {
+	var formats []int
+	for i, f := range serialFormats {
+		if f != "" {
+			formats = append(formats, i)
+		}
+	}
+	tpl := v
+	if n, rest, ok := strings.Cut(v, "="); ok && len(n) == 1 && n[0] >= '1' && n[0] <= '9' {
+		i := int(n[0] - '1')
+		if i >= len(serialFormats) || serialFormats[i] == "" {
+			return fmt.Errorf("format %s has no serial field", n)
+		}
+		formats, tpl = []int{i}, rest
+	}
+	t, err := parseSerialTemplate(tpl)
+	if err != nil {
+		return err
+	}
+	for _, i := range formats {
+		serialTemplates[i] = t
+	}
+	f.set = append(f.set, v)
+	return nil
+}
+
+// serialNo is the serial a device of format reports, serial being the
+// number it is built from (see reading).
+func serialNo(format, deviceNum, serial int) string {
+	if t := serialTemplates[format]; t != nil {
+		return t.render(format, deviceNum)
+	}
+	return fmt.Sprintf(serialFormats[format], serial)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// serverTimeField is the dotted path of a receive timestamp in the
+// server's response (-server-time-field), "" when ingestion lag isn't
+// measured.
+var serverTimeField string
+
+var (
+	ingestLagHist     = &Histogram{}
+	ingestLagNegative uint64 // server stamp before our send: clocks disagree
+	ingestLagMissing  uint64 // response without a usable timestamp
+)
+
+// recordIngestLag reads the server's receive time from resp and records
+// how long after sent it was.
+func recordIngestLag(sent time.Time, resp []byte) {
+	v, err := decodeNumbers(resp)
+	m, ok := v.(map[string]any)
+	if err != nil || !ok {
+		atomic.AddUint64(&ingestLagMissing, 1)
+		return
+	}
+	raw, ok := getPath(m, serverTimeField)
+	if !ok {
+		atomic.AddUint64(&ingestLagMissing, 1)
+		return
+	}
+	at, err := parseServerTime(raw)
+	if err != nil {
+		atomic.AddUint64(&ingestLagMissing, 1)
+		return
+	}
+	lag := at.Sub(sent)
+	if lag < 0 {
+		atomic.AddUint64(&ingestLagNegative, 1)
+		return
+	}
+	ingestLagHist.Record(lag)
+}
+
+// parseServerTime accepts an RFC 3339 string or a Unix epoch number, whose
+// unit (s, ms, µs or ns) is inferred from its magnitude.
+func parseServerTime(v any) (time.Time, error) {
+	switch v := v.(type) {
+	case string:
+		return time.Parse(time.RFC3339Nano, v)
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return time.Time{}, err
+		}
+		switch {
+		case f >= 1e17:
+			if n, err := v.Int64(); err == nil {
+				return time.Unix(0, n), nil // exact for integer ns
+			}
+			return time.Unix(0, int64(f)), nil
+		case f >= 1e14:
+			return time.Unix(0, int64(f*1e3)), nil
+		case f >= 1e11:
+			return time.Unix(0, int64(f*1e6)), nil
+		default:
+			return time.Unix(0, int64(f*1e9)), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unsupported timestamp %v", v)
+}
+
+func printIngestLag() {
+	fmt.Printf("   Ingestion lag (%s): p50 %v | p90 %v | p99 %v | max %v | %d measured\n",
+		serverTimeField,
+		ingestLagHist.Quantile(0.50).Round(time.Microsecond), ingestLagHist.Quantile(0.90).Round(time.Microsecond),
+		ingestLagHist.Quantile(0.99).Round(time.Microsecond), ingestLagHist.Max().Round(time.Microsecond),
+		ingestLagHist.Count())
+	if neg, miss := atomic.LoadUint64(&ingestLagNegative), atomic.LoadUint64(&ingestLagMissing); neg+miss > 0 {
+		fmt.Printf("     %d server stamps before the send (clock offset) | %d responses without a timestamp\n", neg, miss)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// The first SIGINT or SIGTERM, or q in the -tui dashboard, stops the run:
+// the send loops end, queued records are dropped and in-flight requests get
+// -shutdown-grace to finish, so the summary still prints soon after. Those
+// still running then are aborted and count as failed, as they are at once
+// on the next signal; the one after that exits at once.
+var (
+	interrupted   atomic.Bool
+	interruptedAt time.Time
+	stopping      = make(chan struct{}) // closed when the run is asked to stop
+	stopOnce      sync.Once
+	stopGrace     time.Duration
+	graceOver     *time.Timer // aborts in-flight requests once the grace is up
+
+	// runDeadline is when -duration ends the run, zero in the modes
+	// that don't end on it (sweep, bench, replay, compare); runOver is
+	// closed when it passes. Both are set before the first send.
+	runDeadline time.Time
+	runOver     = make(chan struct{})
+
+	// requestCtx is what every request runs under.
+	requestCtx, abortRequests = context.WithCancel(context.Background())
+)
+
+// requestStop stops the run for why, the first time it's called, and
+// reports whether it did.
+func requestStop(why string) bool {
+	first := false
+	stopOnce.Do(func() {
+		first = true
+		interruptedAt = time.Now()
+		interrupted.Store(true)
+		close(stopping)
+		fmt.Printf("\n🛑 %s: stopping, waiting up to %v for in-flight requests (Ctrl-C to abort them)\n", why, stopGrace)
+		graceOver = time.AfterFunc(stopGrace, abortRequests)
+	})
+	return first
+}
+
+func handleSignals(grace time.Duration) {
+	stopGrace = grace
+	sigs := make(chan os.Signal, 3)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		aborted := false
+		for sig := range sigs {
+			switch {
+			case requestStop(sig.String()):
+			case !aborted:
+				aborted = true
+				graceOver.Stop()
+				fmt.Println("🛑 aborting in-flight requests (again to exit now)")
+				abortRequests()
+			default:
+				os.Exit(130)
+			}
+		}
+	}()
+}
+
+// setRunDeadline makes t the run's deadline, closing runOver when it comes.
+func setRunDeadline(t time.Time) {
+	runDeadline = t
+	time.AfterFunc(time.Until(t), func() { close(runOver) })
+}
+
+// pastDeadline reports whether the run's deadline, if it has one, is past.
+func pastDeadline() bool {
+	select {
+	case <-runOver:
+		return true
+	default:
+		return false
+	}
+}
+
+// pause sleeps for d, returning early once the run is interrupted.
+func pause(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-stopping:
+	}
+}
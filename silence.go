@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Devices that stop reporting entirely partway through the run
+// (-silent-devices / -silent-after), for exercising missing-data alerts.
+var (
+	silentDevices map[int]bool
+	silentList    []int // same devices, sorted, for reporting
+	silenceAt     time.Time
+)
+
+// parseDeviceList parses "3,7,12" into device numbers within the base fleet.
+func parseDeviceList(s string) ([]int, error) {
+	var devices []int
+	for _, f := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || n < 1 || n > numDevices {
+			return nil, fmt.Errorf("invalid device %q (want 1-%d)", f, numDevices)
+		}
+		if !slices.Contains(devices, n) {
+			devices = append(devices, n)
+		}
+	}
+	slices.Sort(devices)
+	return devices, nil
+}
+
+func setupSilence(devices []int, at time.Time) {
+	silentList = devices
+	silentDevices = map[int]bool{}
+	for _, d := range devices {
+		silentDevices[d] = true
+	}
+	silenceAt = at
+}
+
+// isSilent reports whether deviceNum has gone silent by now.
+func isSilent(deviceNum int) bool {
+	return silentDevices[deviceNum] && !time.Now().Before(silenceAt)
+}
+
+func printSilence(start time.Time) {
+	names := make([]string, len(silentList))
+	for i, d := range silentList {
+		names[i] = strconv.Itoa(d)
+	}
+	if time.Now().Before(silenceAt) {
+		fmt.Printf("   Silent devices: none went silent (run ended before %v)\n", silenceAt.Sub(start))
+		return
+	}
+	fmt.Printf("   Silent devices: %s stopped at %s (%v into the run)\n",
+		strings.Join(names, ","), silenceAt.Format(time.RFC3339), silenceAt.Sub(start))
+}
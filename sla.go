@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// slaMinSamples is how many requests the window needs before its p99 is
+// judged, so a quiet second can't flap the alert.
+const slaMinSamples = 20
+
+// slaMonitor watches the p99 latency over a sliding window of one-second
+// slots (-sla-p99) and alerts when it crosses the SLA and when it recovers.
+type slaMonitor struct {
+	SLA     time.Duration
+	Webhook string // POSTed a JSON event on breach and recovery, "" for none
+
+	slots []Histogram
+	cur   atomic.Int32
+
+	breachedAt time.Time // zero while within the SLA
+	breaches   int
+	breachTime time.Duration
+}
+
+// sla is nil unless -sla-p99 is set.
+var sla *slaMonitor
+
+func newSLAMonitor(p99 time.Duration, window time.Duration, webhook string) *slaMonitor {
+	return &slaMonitor{SLA: p99, Webhook: webhook, slots: make([]Histogram, max(int(window/time.Second), 1))}
+}
+
+func (m *slaMonitor) record(d time.Duration) {
+	m.slots[m.cur.Load()].Record(d)
+}
+
+// run evaluates the window once a second until done is closed.
+func (m *slaMonitor) run(done <-chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			if !m.breachedAt.IsZero() {
+				m.breachTime += time.Since(m.breachedAt)
+			}
+			return
+		case <-ticker.C:
+		}
+		var window Histogram
+		for i := range m.slots {
+			m.slots[i].AddTo(&window)
+		}
+		// The oldest slot becomes the current one; nobody records there.
+		next := (int(m.cur.Load()) + 1) % len(m.slots)
+		m.slots[next].Reset()
+		m.cur.Store(int32(next))
+
+		if window.Count() < slaMinSamples {
+			continue
+		}
+		p99 := window.Quantile(0.99)
+		switch {
+		case p99 > m.SLA && m.breachedAt.IsZero():
+			m.breachedAt = time.Now()
+			m.breaches++
+			logWarn("SLA breach", "p99", p99.Round(time.Millisecond), "window", time.Duration(len(m.slots))*time.Second, "sla", m.SLA)
+			m.notify("breach", p99)
+		case p99 <= m.SLA && !m.breachedAt.IsZero():
+			lasted := time.Since(m.breachedAt)
+			m.breachTime += lasted
+			m.breachedAt = time.Time{}
+			logInfo("SLA recovered", "p99", p99.Round(time.Millisecond), "breached_for", lasted.Round(time.Second))
+			m.notify("recovered", p99)
+		}
+	}
+}
+
+// notify posts the event to the webhook without holding up the monitor.
+func (m *slaMonitor) notify(event string, p99 time.Duration) {
+	if m.Webhook == "" {
+		return
+	}
+	body, _ := json.Marshal(map[string]any{
+		"event":  event,
+		"run_id": runID,
+		"p99_ms": ms(p99),
+		"sla_ms": ms(m.SLA),
+		"at":     time.Now().UTC().Format(time.RFC3339),
+	})
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.Webhook, bytes.NewReader(body))
+		if err != nil {
+			logError("SLA webhook failed", "err", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			logError("SLA webhook failed", "err", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			logError("SLA webhook failed", "status", resp.Status)
+		}
+	}()
+}
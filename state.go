@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// stateVersion is bumped when a field changes meaning. Fields may be
+// added without a bump: older files leave them zero, and a zero field is
+// drawn fresh on the device's next report.
+const stateVersion = 1
+
+// deviceState is what a device carries from one report to the next, and
+// across restarts with -state-file.
+type deviceState struct {
+	TotalEnergy float64   `json:"total_energy_wh"`
+	Serial      int       `json:"serial,omitempty"`
+	Seq         uint64    `json:"seq,omitempty"`
+	EnergyDay   time.Time `json:"energy_day,omitzero"`
+	TodayEnergy float64   `json:"today_energy_wh,omitempty"`
+
+	lastReport time.Time // not saved, so downtime adds no energy
+	lastPower  int       // power at lastReport
+	signal     float64   // dBm, see deviceSignal
+	faultCode  int       // burst in progress, see burstFault
+	faultUntil time.Time
+}
+
+type stateFile struct {
+	Version int                  `json:"version"`
+	SavedAt time.Time            `json:"saved_at"`
+	Devices map[int]*deviceState `json:"devices"`
+}
+
+// devState holds every device that has reported, keyed by device number
+// (each has one identity, see identityOf). -state-file loads it at start
+// and saves it periodically.
+var (
+	stateMu   sync.Mutex
+	devState  = map[int]*deviceState{}
+	stateSave uint64 // snapshots written
+	stateErrs uint64 // snapshots that failed
+)
+
+// loadState reads a state file; a missing file starts every device fresh.
+func loadState(path string) (map[int]*deviceState, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[int]*deviceState{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f stateFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if f.Version > stateVersion {
+		return nil, fmt.Errorf("%s: written by a newer version (state version %d, this build reads up to %d)", path, f.Version, stateVersion)
+	}
+	if f.Devices == nil {
+		f.Devices = map[int]*deviceState{}
+	}
+	for d, st := range f.Devices {
+		if st == nil {
+			delete(f.Devices, d)
+		}
+	}
+	return f.Devices, nil
+}
+
+// setupState loads path and seeds the per-device counters that live
+// elsewhere (sequence numbers, daily energy) from it.
+func setupState(path string) (int, error) {
+	devices, err := loadState(path)
+	if err != nil {
+		return 0, err
+	}
+	devState = devices
+	for d, st := range devices {
+		if st.Seq > 0 {
+			seqNext[d], seqAcked[d] = st.Seq, st.Seq
+		}
+		if !st.EnergyDay.IsZero() {
+			energyDay[d] = st.EnergyDay
+		}
+	}
+	return len(devices), nil
+}
+
+// stateOf returns the device's state, creating it on first report. The
+// caller must hold stateMu.
+func stateOf(deviceNum int) *deviceState {
+	st := devState[deviceNum]
+	if st == nil {
+		st = &deviceState{}
+		devState[deviceNum] = st
+	}
+	if st.TotalEnergy == 0 {
+		st.TotalEnergy = float64(sampleInt("total_energy", cfg.TotalEnergyRange))
+	}
+	return st
+}
+
+// deviceSerial is the number a device's serial is built from: its
+// identity's, or with -state-file the one it had in earlier runs.
+func deviceSerial(deviceNum int) int {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	st := stateOf(deviceNum)
+	if st.Serial == 0 {
+		st.Serial = identityOf(deviceNum).Serial
+	}
+	return st.Serial
+}
+
+// saveState snapshots every device to path, via a rename so an
+// interrupted write never leaves a truncated file behind.
+func saveState(path string) error {
+	stateMu.Lock()
+	seqMu.Lock()
+	energyMu.Lock()
+	for d, n := range seqNext {
+		stateOf(d).Seq = n
+	}
+	for d, day := range energyDay {
+		stateOf(d).EnergyDay = day
+	}
+	energyMu.Unlock()
+	seqMu.Unlock()
+	b, err := json.MarshalIndent(stateFile{Version: stateVersion, SavedAt: time.Now(), Devices: devState}, "", "  ")
+	stateMu.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(b, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// runStateSnapshots saves the state every interval until done closes.
+func runStateSnapshots(path string, interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			snapshotState(path)
+		}
+	}
+}
+
+func snapshotState(path string) {
+	if err := saveState(path); err != nil {
+		stateMu.Lock()
+		stateErrs++
+		stateMu.Unlock()
+		logError("state snapshot failed", "path", path, "err", err)
+		return
+	}
+	stateMu.Lock()
+	stateSave++
+	stateMu.Unlock()
+}
+
+func printState(path string) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	fmt.Printf("   State file %s: %d devices | %d snapshots | %d failed\n", path, len(devState), stateSave, stateErrs)
+}
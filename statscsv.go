@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+var statsHeader = []string{"timestamp", "sent", "failed", "total_sent", "total_failed", "in_flight"}
+
+// startStatsCSV appends one row per second to path (-stats-csv): what was
+// sent and failed in that second, the running totals and how many records
+// were queued or in flight at the tick. Rows are buffered; the returned
+// stop writes a last row for the partial second, flushes and closes.
+func startStatsCSV(path string, inFlight func() int64) (stop func() error, err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	buf := bufio.NewWriterSize(f, 64*1024)
+	w := csv.NewWriter(buf)
+	if err := w.Write(statsHeader); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	var lastSent, lastFailed uint64
+	row := func(t time.Time) {
+		sent, failed := atomic.LoadUint64(&totalSent), atomic.LoadUint64(&totalFailed)
+		w.Write([]string{ // errors surface on stop via csv.Writer.Error
+			t.Format(time.RFC3339Nano),
+			strconv.FormatUint(sent-lastSent, 10),
+			strconv.FormatUint(failed-lastFailed, 10),
+			strconv.FormatUint(sent, 10),
+			strconv.FormatUint(failed, 10),
+			strconv.FormatInt(inFlight(), 10),
+		})
+		lastSent, lastFailed = sent, failed
+	}
+
+	done, exited := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(exited)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				row(time.Now())
+				return
+			case t := <-ticker.C:
+				row(t)
+			}
+		}
+	}()
+	return func() error {
+		close(done)
+		<-exited
+		w.Flush()
+		if err := w.Error(); err != nil {
+			f.Close()
+			return err
+		}
+		if err := buf.Flush(); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}, nil
+}
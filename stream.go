@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errStreamEnded is what writes to a stream get once its POST has returned
+// without error: the server answered before the body was finished.
+var errStreamEnded = errors.New("server ended the stream early")
+
+// StreamSender writes every record as one line of a newline-delimited JSON
+// body, streamed chunked through a single long POST (-stream), to exercise
+// the server's streaming parser. Records are buffered and flushed into the
+// request every Flush, or sooner when the buffer fills. When the server
+// closes the stream early, the next record opens a new one, counted as a
+// restart.
+//
+// A record counts as sent once it is written into a stream; records still
+// buffered when a stream dies are counted as lost, not failed. Those the
+// transport had already taken may have been dropped by the server too, so
+// the lost count is a floor.
+type StreamSender struct {
+	Client *http.Client // without a timeout: a stream lasts the whole run
+	URL    string
+	Header http.Header
+	Flush  time.Duration
+
+	mu        sync.Mutex
+	cur       *ndjsonStream
+	unflushed int // records in cur's buffer
+	lastErr   error
+	stop      chan struct{}
+	closeOnce sync.Once
+
+	streams, failedStreams, restarts, records, lost uint64
+}
+
+// ndjsonStream is one POST in flight, its body fed through a pipe.
+type ndjsonStream struct {
+	pw   *io.PipeWriter
+	bw   *bufio.Writer
+	done chan struct{} // closed once the POST has returned
+	err  error         // its outcome, set before done is closed
+}
+
+func NewStreamSender(client *http.Client, url string, header http.Header, flush time.Duration) *StreamSender {
+	s := &StreamSender{Client: client, URL: url, Header: header, Flush: flush, stop: make(chan struct{})}
+	go s.flushLoop()
+	return s
+}
+
+func (s *StreamSender) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cur != nil {
+		select {
+		case <-s.cur.done:
+			s.drop(cmp.Or(s.cur.err, errStreamEnded))
+		default:
+		}
+	}
+	for try := 0; ; try++ {
+		if s.cur == nil {
+			s.cur = s.open()
+		}
+		err := s.write(msg.Body)
+		if err == nil {
+			atomic.AddUint64(&s.records, 1)
+			return nil
+		}
+		s.drop(err)
+		if try == 1 {
+			return fmt.Errorf("stream: %w", err)
+		}
+	}
+}
+
+// open starts a new POST whose body is read from a pipe as records are
+// flushed into it. The caller must hold s.mu.
+func (s *StreamSender) open() *ndjsonStream {
+	pr, pw := io.Pipe()
+	st := &ndjsonStream{pw: pw, bw: bufio.NewWriter(pw), done: make(chan struct{})}
+	if atomic.AddUint64(&s.streams, 1) > 1 {
+		atomic.AddUint64(&s.restarts, 1)
+	}
+	go func() {
+		st.err = s.post(pr)
+		if st.err != nil {
+			atomic.AddUint64(&s.failedStreams, 1)
+		}
+		pr.CloseWithError(cmp.Or(st.err, errStreamEnded)) // fail the writes still to come
+		close(st.done)
+	}()
+	return st
+}
+
+func (s *StreamSender) post(body io.Reader) error {
+	req, err := http.NewRequestWithContext(requestCtx, http.MethodPost, s.URL, body)
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	for k, vs := range s.Header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	atomic.AddUint64(&totalAttempts, 1)
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{Status: resp.Status, Code: resp.StatusCode, Body: readErrorBody(resp.Body)}
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBody))
+	return nil
+}
+
+// write buffers one line, flushing first if it wouldn't fit, so a failed
+// flush loses exactly the records counted in unflushed. The caller must
+// hold s.mu.
+func (s *StreamSender) write(body []byte) error {
+	if s.cur.bw.Available() < len(body)+1 {
+		if err := s.flush(); err != nil {
+			return err
+		}
+	}
+	s.cur.bw.Write(body)
+	if err := s.cur.bw.WriteByte('\n'); err != nil {
+		return err
+	}
+	s.unflushed++
+	return nil
+}
+
+// flush pushes the buffered records into the request body. It blocks until
+// the transport has read them. The caller must hold s.mu.
+func (s *StreamSender) flush() error {
+	if err := s.cur.bw.Flush(); err != nil {
+		return err
+	}
+	s.unflushed = 0
+	return nil
+}
+
+// drop abandons the current stream after err. The caller must hold s.mu.
+func (s *StreamSender) drop(err error) {
+	if errors.Is(err, io.ErrClosedPipe) {
+		// the transport closed the body on its way out; say why
+		<-s.cur.done
+		err = cmp.Or(s.cur.err, errStreamEnded)
+	}
+	atomic.AddUint64(&s.lost, uint64(s.unflushed))
+	s.unflushed = 0
+	s.lastErr = err
+	s.cur.pw.CloseWithError(err)
+	s.cur = nil
+}
+
+func (s *StreamSender) flushLoop() {
+	t := time.NewTicker(s.Flush)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			s.mu.Lock()
+			if s.cur != nil && s.unflushed > 0 {
+				if err := s.flush(); err != nil {
+					s.drop(err)
+				}
+			}
+			s.mu.Unlock()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Target is the URL streams are POSTed to.
+func (s *StreamSender) Target() string { return s.URL }
+
+// Close finishes the open stream and waits for the server's answer to it.
+func (s *StreamSender) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.cur == nil {
+			return
+		}
+		st := s.cur
+		select {
+		case <-st.done:
+			s.drop(cmp.Or(st.err, errStreamEnded))
+			return
+		default:
+		}
+		if err := s.flush(); err != nil {
+			s.drop(err)
+		} else {
+			st.pw.Close()
+			s.cur = nil
+		}
+		<-st.done
+		if st.err != nil {
+			s.lastErr = st.err
+		}
+	})
+	return nil
+}
+
+func (s *StreamSender) printSummary() {
+	fmt.Printf("   Stream: %d records over %d POSTs to %s | %d restarts | %d failed | %d records lost in dropped streams\n",
+		atomic.LoadUint64(&s.records), atomic.LoadUint64(&s.streams), s.URL,
+		atomic.LoadUint64(&s.restarts), atomic.LoadUint64(&s.failedStreams), atomic.LoadUint64(&s.lost))
+	if s.lastErr != nil {
+		fmt.Printf("     last stream error: %v\n", s.lastErr)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// strictSchema checks every response against the fields the request sent
+// plus the format's declared server-added fields (-strict-schema), and
+// fails responses that drift from that contract.
+var strictSchema bool
+
+var (
+	driftMu     sync.Mutex
+	driftCounts [numFormats]uint64            // drifted responses per format
+	driftPaths  [numFormats]map[string]string // path -> "unknown" or "missing"
+)
+
+// leafPaths collects the dotted paths of every non-object value in v.
+func leafPaths(prefix string, v any, out map[string]bool) {
+	m, ok := v.(map[string]any)
+	if !ok {
+		if prefix != "" {
+			out[prefix] = true
+		}
+		return
+	}
+	for k, child := range m {
+		leafPaths(joinPath(prefix, k), child, out)
+	}
+}
+
+// checkSchemaDrift compares the response's fields with what was sent and
+// the format's declared response fields. unknown are paths the server
+// returned that the contract doesn't have; missing are paths we sent that
+// didn't come back.
+func checkSchemaDrift(formatType int, sent, resp []byte) (unknown, missing []string, err error) {
+	want, err := decodeNumbers(sent)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decode sent: %w", err)
+	}
+	got, err := decodeNumbers(resp)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decode response: %w", err)
+	}
+	expected, returned := map[string]bool{}, map[string]bool{}
+	leafPaths("", want, expected)
+	leafPaths("", got, returned)
+	allowed := map[string]bool{}
+	for _, p := range cfg.ResponseFields[fmt.Sprint(formatType+1)] {
+		allowed[p] = true
+	}
+	if serverTimeField != "" {
+		allowed[serverTimeField] = true
+	}
+
+	for p := range returned {
+		if !expected[p] && !allowed[p] {
+			unknown = append(unknown, p)
+		}
+	}
+	for p := range expected {
+		if !returned[p] {
+			missing = append(missing, p)
+		}
+	}
+	sort.Strings(unknown)
+	sort.Strings(missing)
+	return unknown, missing, nil
+}
+
+func recordSchemaDrift(formatType int, unknown, missing []string) {
+	driftMu.Lock()
+	defer driftMu.Unlock()
+	driftCounts[formatType]++
+	if driftPaths[formatType] == nil {
+		driftPaths[formatType] = map[string]string{}
+	}
+	for _, p := range unknown {
+		driftPaths[formatType][p] = "unknown"
+	}
+	for _, p := range missing {
+		driftPaths[formatType][p] = "missing"
+	}
+}
+
+func printSchemaDrift() {
+	driftMu.Lock()
+	defer driftMu.Unlock()
+	fmt.Print("   Schema drift:")
+	sep := ""
+	for i, n := range driftCounts {
+		if formatListed(i) {
+			fmt.Printf("%s format %d: %d", sep, i+1, n)
+			sep = " |"
+		}
+	}
+	fmt.Println()
+	for i, paths := range driftPaths {
+		if !formatListed(i) {
+			continue
+		}
+		keys := make([]string, 0, len(paths))
+		for k := range paths {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Printf("     format %d %s: %s\n", i+1, k, paths[k])
+		}
+	}
+}
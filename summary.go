@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// summaryFormats are the values -summary-format accepts: the rich
+// multi-line block, one key=value line, or one JSON object.
+var summaryFormats = []string{"rich", "oneline", "json"}
+
+// RunSummary is the end-of-run result as -summary-format oneline and json
+// report it, and as -summary-json writes it for CI gates.
+type RunSummary struct {
+	RunID       string             `json:"run_id"`
+	ElapsedSec  float64            `json:"elapsed_sec"`
+	Sent        uint64             `json:"sent"`
+	Failed      uint64             `json:"failed"`
+	FailureRate float64            `json:"failure_rate"`       // failed / (sent + failed)
+	Failures    map[string]uint64  `json:"failures,omitempty"` // failed sends by cause (failureNames)
+	Goodput     uint64             `json:"goodput"`            // accepted exactly once
+	Attempts    uint64             `json:"attempts"`           // requests on the wire
+	Rate        float64            `json:"rate"`
+	TargetRate  float64            `json:"target_rate"`
+	Bytes       uint64             `json:"bytes"`
+	P50Ms       float64            `json:"p50_ms"`
+	P90Ms       float64            `json:"p90_ms"`
+	P99Ms       float64            `json:"p99_ms"`
+	MaxMs       float64            `json:"max_ms"`
+	Formats     [numFormats]uint64 `json:"formats"`
+	Abandoned   int64              `json:"abandoned"`
+	Interrupted bool               `json:"interrupted"` // stopped early by SIGINT/SIGTERM or the dashboard
+}
+
+func newRunSummary(runID string, elapsed time.Duration, targetRate float64, abandoned int64) RunSummary {
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	s := RunSummary{
+		RunID:       runID,
+		ElapsedSec:  elapsed.Seconds(),
+		Sent:        atomic.LoadUint64(&totalSent),
+		Failed:      atomic.LoadUint64(&totalFailed),
+		Attempts:    atomic.LoadUint64(&totalAttempts),
+		TargetRate:  targetRate,
+		Bytes:       atomic.LoadUint64(&totalBytes),
+		P50Ms:       ms(latencyHist.Quantile(0.50)),
+		P90Ms:       ms(latencyHist.Quantile(0.90)),
+		P99Ms:       ms(latencyHist.Quantile(0.99)),
+		MaxMs:       ms(latencyHist.Max()),
+		Abandoned:   abandoned,
+		Interrupted: interrupted.Load(),
+	}
+	s.Rate = float64(s.Sent) / elapsed.Seconds()
+	if s.Sent+s.Failed > 0 {
+		s.FailureRate = float64(s.Failed) / float64(s.Sent+s.Failed)
+	}
+	for k, name := range failureNames {
+		if n := atomic.LoadUint64(&failureCounts[k]); n > 0 {
+			if s.Failures == nil {
+				s.Failures = map[string]uint64{}
+			}
+			s.Failures[strings.ToLower(strings.NewReplacer(" ", "_", "-", "_").Replace(name))] = n // "non_200_status"
+		}
+	}
+	for i := range s.Formats {
+		s.Formats[i] = atomic.LoadUint64(&formatCounts[i])
+	}
+	return s
+}
+
+// oneline renders the summary as space-separated key=value pairs, e.g.
+// "sent=540000 failed=12 rate=599.98 p99=210ms", for grep and shell
+// pipelines.
+func (s RunSummary) oneline() string {
+	lat := func(v float64) string {
+		return time.Duration(v * float64(time.Millisecond)).Round(100 * time.Microsecond).String()
+	}
+	f := []string{
+		"run_id=" + s.RunID,
+		fmt.Sprintf("elapsed=%.1fs", s.ElapsedSec),
+		fmt.Sprintf("sent=%d", s.Sent),
+		fmt.Sprintf("failed=%d", s.Failed),
+		fmt.Sprintf("goodput=%d", s.Goodput),
+		fmt.Sprintf("attempts=%d", s.Attempts),
+		fmt.Sprintf("rate=%.2f", s.Rate),
+		fmt.Sprintf("target=%.0f", s.TargetRate),
+		fmt.Sprintf("bytes=%d", s.Bytes),
+		"p50=" + lat(s.P50Ms),
+		"p90=" + lat(s.P90Ms),
+		"p99=" + lat(s.P99Ms),
+		"max=" + lat(s.MaxMs),
+	}
+	for i, n := range s.Formats {
+		f = append(f, fmt.Sprintf("f%d=%d", i+1, n))
+	}
+	if s.Abandoned > 0 {
+		f = append(f, fmt.Sprintf("abandoned=%d", s.Abandoned))
+	}
+	if s.Interrupted {
+		f = append(f, "interrupted=true")
+	}
+	return strings.Join(f, " ")
+}
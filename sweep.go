@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// SweepStep is the outcome of one rate in a -sweep run.
+type SweepStep struct {
+	Rate       int     `json:"rate"`
+	ActualRate float64 `json:"actual_rate"`
+	Sent       uint64  `json:"sent"`
+	Failed     uint64  `json:"failed"`
+	ErrorRate  float64 `json:"error_rate"`
+	P50Ms      float64 `json:"p50_ms"`
+	P90Ms      float64 `json:"p90_ms"`
+	P99Ms      float64 `json:"p99_ms"`
+	MaxMs      float64 `json:"max_ms"`
+}
+
+// parseRates parses a comma-separated list of positive rates like
+// "100,200,400".
+func parseRates(s string) ([]int, error) {
+	var rates []int
+	for _, f := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid rate %q", f)
+		}
+		rates = append(rates, n)
+	}
+	return rates, nil
+}
+
+// runSweep runs the global-rate loop once per rate for step each, draining
+// in-flight requests and pausing for cooldown between steps, and returns
+// one summary per step.
+func runSweep(pool *workerPool, rates []int, step, cooldown time.Duration) []SweepStep {
+	var steps []SweepStep
+	for i, rate := range rates {
+		if stopReached() {
+			break
+		}
+		fmt.Printf("🔁 Sweep step %d/%d: %d/sec for %v\n", i+1, len(rates), rate, step)
+
+		steps = append(steps, runStep(pool, rate, step, nil))
+
+		if i < len(rates)-1 && cooldown > 0 {
+			pause(cooldown)
+		}
+	}
+	return steps
+}
+
+// runStep runs the global-rate loop at rate for d, waits for in-flight
+// requests and returns what that step achieved. payloads, if not nil, is
+// sent instead of generating records.
+func runStep(pool *workerPool, rate int, d time.Duration, payloads *payloadReplay) SweepStep {
+	sent0, failed0 := atomic.LoadUint64(&totalSent), atomic.LoadUint64(&totalFailed)
+	latencyHist.Reset()
+	start := time.Now()
+
+	runGlobalRate(pool, rate, 0, start.Add(d), payloads)
+	pool.drain()
+
+	elapsed := time.Since(start)
+	s := SweepStep{
+		Rate:   rate,
+		Sent:   atomic.LoadUint64(&totalSent) - sent0,
+		Failed: atomic.LoadUint64(&totalFailed) - failed0,
+		P50Ms:  ms(latencyHist.Quantile(0.50)),
+		P90Ms:  ms(latencyHist.Quantile(0.90)),
+		P99Ms:  ms(latencyHist.Quantile(0.99)),
+		MaxMs:  ms(latencyHist.Max()),
+	}
+	s.ActualRate = float64(s.Sent) / elapsed.Seconds()
+	if total := s.Sent + s.Failed; total > 0 {
+		s.ErrorRate = float64(s.Failed) / float64(total)
+	}
+	return s
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func printSweepTable(steps []SweepStep) {
+	fmt.Println("\n📈 Sweep results")
+	fmt.Printf("   %8s %10s %9s %8s %7s %9s %9s %9s %9s\n",
+		"rate", "actual/s", "sent", "failed", "err%", "p50ms", "p90ms", "p99ms", "maxms")
+	for _, s := range steps {
+		fmt.Printf("   %8d %10.2f %9d %8d %7.2f %9.1f %9.1f %9.1f %9.1f\n",
+			s.Rate, s.ActualRate, s.Sent, s.Failed, s.ErrorRate*100, s.P50Ms, s.P90Ms, s.P99Ms, s.MaxMs)
+	}
+}
+
+func writeSweepJSON(path string, steps []SweepStep) error {
+	return writeJSONFile(path, steps)
+}
+
+func writeJSONFile(path string, v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
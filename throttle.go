@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Tuning for -graceful-ramp-on-throttle. A second in which more than
+// throttleTolerance of the answers were 429s counts as throttled: the
+// answers that weren't 429s estimate the server's limit, the rate drops
+// to throttleNear of that (at least to throttleBackoff of itself) and the
+// rate it was throttled at becomes the ceiling. The second after a cut is
+// ignored, since answers to the old rate are still arriving. After
+// throttleHold clean seconds it probes up, by throttleProbe while well
+// below the ceiling and by throttleCreep once close to it, so it settles
+// just under the limit instead of bouncing off.
+const (
+	throttleTolerance = 0.01
+	throttleBackoff   = 0.5
+	throttleHold      = 3
+	throttleProbe     = 0.05
+	throttleCreep     = 0.01
+	throttleNear      = 0.95 // of the ceiling
+)
+
+// throttle is nil unless -graceful-ramp-on-throttle is set.
+var throttle *throttleController
+
+type ratePoint struct {
+	At   time.Duration // into the run
+	Rate int
+}
+
+// throttleController adjusts the global send rate once a second from the
+// 429s seen in the second before. Only the send loop calls next, so
+// everything but the answer counters is single-goroutine.
+type throttleController struct {
+	max     int // the configured rate; never exceeded
+	rate    int
+	ceiling int // rate at the last throttle, 0 before the first
+	clean   int // consecutive seconds without throttling
+	settle  bool
+	start   time.Time
+
+	answered, throttled uint64 // this second, reset by next
+	total429            uint64
+	events              int
+	trajectory          []ratePoint
+}
+
+func newThrottleController(rate int) *throttleController {
+	return &throttleController{max: rate, rate: rate}
+}
+
+// note counts one answer; code is from statusOf.
+func (c *throttleController) note(code int) {
+	if code == 0 {
+		return // no answer tells us nothing about the rate limit
+	}
+	atomic.AddUint64(&c.answered, 1)
+	if code == http.StatusTooManyRequests {
+		atomic.AddUint64(&c.throttled, 1)
+		atomic.AddUint64(&c.total429, 1)
+	}
+}
+
+// next returns the rate for the coming second.
+func (c *throttleController) next() int {
+	if c.start.IsZero() {
+		c.start = time.Now()
+		c.trajectory = append(c.trajectory, ratePoint{0, c.rate})
+		return c.rate
+	}
+	answered := atomic.SwapUint64(&c.answered, 0)
+	throttled := atomic.SwapUint64(&c.throttled, 0)
+	prev := c.rate
+	switch {
+	case c.settle:
+		c.settle = false
+	case answered == 0:
+		// nothing came back; hold
+	case float64(throttled) > throttleTolerance*float64(answered):
+		c.events++
+		c.ceiling = c.rate
+		limit := float64(answered - throttled)
+		c.rate = max(1, int(float64(c.rate)*throttleBackoff), min(c.rate-1, int(limit*throttleNear)))
+		c.clean = 0
+		c.settle = true
+	default:
+		c.clean++
+		if c.clean >= throttleHold && c.rate < c.max {
+			c.clean = 0
+			step := throttleProbe
+			if c.ceiling > 0 && float64(c.rate) >= throttleNear*float64(c.ceiling) {
+				step = throttleCreep
+			}
+			c.rate = min(c.max, c.rate+max(1, int(float64(c.rate)*step)))
+		}
+	}
+	if c.rate != prev {
+		c.trajectory = append(c.trajectory, ratePoint{time.Since(c.start).Round(time.Second), c.rate})
+	}
+	return c.rate
+}
+
+// maxTrajectory caps how many rate changes the summary lists.
+const maxTrajectory = 30
+
+func (c *throttleController) printSummary() {
+	lo, hi := c.max, 0
+	for _, p := range c.trajectory {
+		lo, hi = min(lo, p.Rate), max(hi, p.Rate)
+	}
+	fmt.Printf("   Throttle control: %d throttled seconds | %d 429s | rate %d-%d/sec, final %d/sec\n",
+		c.events, atomic.LoadUint64(&c.total429), lo, hi, c.rate)
+	points := c.trajectory
+	if len(points) > maxTrajectory {
+		fmt.Printf("     (last %d of %d rate changes)\n", maxTrajectory, len(points))
+		points = points[len(points)-maxTrajectory:]
+	}
+	var b strings.Builder
+	for i, p := range points {
+		if i > 0 {
+			b.WriteString(" → ")
+		}
+		fmt.Fprintf(&b, "%v %d", p.At, p.Rate)
+	}
+	fmt.Printf("     Trajectory: %s\n", b.String())
+}
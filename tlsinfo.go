@@ -0,0 +1,92 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// parseTLSVersion maps "1.0".."1.3" to the crypto/tls constant.
+func parseTLSVersion(s string) (uint16, error) {
+	switch s {
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unknown TLS version %q (want 1.0, 1.1, 1.2 or 1.3)", s)
+}
+
+// loadClientTLS adds mutual TLS to cfg: the client certificate and key
+// presented to the server (-client-cert, -client-key) and the CA bundle
+// the server's certificate must chain to (-ca-cert, default: the system
+// roots). Any path may be empty, but a cert needs its key.
+func loadClientTLS(cfg *tls.Config, certPath, keyPath, caPath string) error {
+	if (certPath == "") != (keyPath == "") {
+		return fmt.Errorf("-client-cert and -client-key must be given together")
+	}
+	if certPath != "" {
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath) // also checks the key matches
+		if err != nil {
+			return fmt.Errorf("client certificate %s / key %s: %w", certPath, keyPath, err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if caPath != "" {
+		pem, err := os.ReadFile(caPath)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("%s: no PEM certificates found", caPath)
+		}
+		cfg.RootCAs = pool
+	}
+	return nil
+}
+
+// negotiated TLS parameters per new connection, from httptrace
+var (
+	tlsMu         sync.Mutex
+	tlsNegotiated = map[string]uint64{} // "TLS 1.3 TLS_AES_128_GCM_SHA256" -> connections
+	tlsFailed     uint64
+)
+
+func recordTLS(state tls.ConnectionState, err error) {
+	tlsMu.Lock()
+	defer tlsMu.Unlock()
+	if err != nil {
+		tlsFailed++
+		return
+	}
+	tlsNegotiated[tls.VersionName(state.Version)+" "+tls.CipherSuiteName(state.CipherSuite)]++
+}
+
+func printTLS() {
+	tlsMu.Lock()
+	defer tlsMu.Unlock()
+	if len(tlsNegotiated) == 0 && tlsFailed == 0 {
+		return
+	}
+	keys := make([]string, 0, len(tlsNegotiated))
+	for k := range tlsNegotiated {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	ok := uint64(0)
+	for _, n := range tlsNegotiated {
+		ok += n
+	}
+	fmt.Printf("   TLS handshakes: %d ok | %d failed\n", ok, tlsFailed)
+	for _, k := range keys {
+		fmt.Printf("     %s: %d connections\n", k, tlsNegotiated[k])
+	}
+}
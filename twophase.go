@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// TwoPhaseSender delivers records through a prepare/commit protocol
+// (-two-phase-batch): records are grouped into batches, each batch is
+// POSTed to Prepare as a JSON array, and the token in the answer is then
+// POSTed to Commit. A record only counts as delivered once its batch's
+// commit succeeds.
+//
+// Send blocks until its batch has been committed; see batcher for when a
+// batch is flushed.
+type TwoPhaseSender struct {
+	Prepare    Sender // must also be an Exchanger, to read the token
+	Commit     Sender
+	TokenField string // dotted path of the token in the prepare answer
+	BatchSize  int
+	Linger     time.Duration
+	AbortRate  float64 // fraction of batches prepared but never committed
+
+	pending batcher
+
+	prepareHist, commitHist Histogram
+
+	batches, committed, aborted uint64
+	prepareFailed, commitFailed uint64
+	noToken                     uint64
+}
+
+// errAborted marks a batch the client walked away from between the two
+// phases, the way a crashed producer leaves a prepared batch behind.
+var errAborted = errors.New("two-phase: batch prepared but deliberately not committed")
+
+func (t *TwoPhaseSender) Send(ctx context.Context, msg Message) error {
+	return t.pending.add(ctx, msg.Body, t.BatchSize, t.Linger, t.run)
+}
+
+func (t *TwoPhaseSender) run(bodies [][]byte) error {
+	atomic.AddUint64(&t.batches, 1)
+	ctx := requestCtx
+	batch := jsonArray(bodies)
+
+	start := time.Now()
+	answer, err := t.Prepare.(Exchanger).Exchange(ctx, Message{Body: batch, ContentType: "application/json"})
+	t.prepareHist.Record(time.Since(start))
+	if err != nil {
+		atomic.AddUint64(&t.prepareFailed, 1)
+		return fmt.Errorf("prepare: %w", err)
+	}
+	token, err := t.token(answer)
+	if err != nil {
+		atomic.AddUint64(&t.noToken, 1)
+		return err
+	}
+
+	if t.AbortRate > 0 && rng.Float64() < t.AbortRate {
+		atomic.AddUint64(&t.aborted, 1)
+		return errAborted
+	}
+	commit, err := json.Marshal(map[string]string{t.TokenField: token})
+	if err != nil {
+		return err
+	}
+	start = time.Now()
+	err = t.Commit.Send(ctx, Message{Body: commit, ContentType: "application/json"})
+	t.commitHist.Record(time.Since(start))
+	if err != nil {
+		atomic.AddUint64(&t.commitFailed, 1)
+		return fmt.Errorf("commit: %w", err)
+	}
+	atomic.AddUint64(&t.committed, 1)
+	return nil
+}
+
+// token pulls the commit token out of a prepare answer.
+func (t *TwoPhaseSender) token(answer []byte) (string, error) {
+	var m map[string]any
+	if err := json.Unmarshal(answer, &m); err != nil {
+		return "", fmt.Errorf("prepare answer: %w", err)
+	}
+	v, ok := getPath(m, t.TokenField)
+	if !ok {
+		return "", fmt.Errorf("prepare answer has no %q", t.TokenField)
+	}
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return fmt.Sprint(v), nil
+	}
+	return "", fmt.Errorf("prepare answer %q is not a string", t.TokenField)
+}
+
+// Target names the prepare URL, where batches are sent.
+func (t *TwoPhaseSender) Target() string { return targetOf(t.Prepare) }
+
+// Close flushes any partial batch, then closes both legs.
+func (t *TwoPhaseSender) Close() error {
+	t.pending.flushOpen()
+	return errors.Join(t.Prepare.Close(), t.Commit.Close())
+}
+
+func (t *TwoPhaseSender) printSummary() {
+	batches := atomic.LoadUint64(&t.batches)
+	fmt.Printf("   Two-phase: %d batches | %d committed (%.1f%%) | %d prepare failed | %d without token | %d aborted | %d commit failed\n",
+		batches, atomic.LoadUint64(&t.committed), pct(atomic.LoadUint64(&t.committed), batches),
+		atomic.LoadUint64(&t.prepareFailed), atomic.LoadUint64(&t.noToken),
+		atomic.LoadUint64(&t.aborted), atomic.LoadUint64(&t.commitFailed))
+	for _, leg := range []struct {
+		name string
+		h    *Histogram
+	}{{"prepare", &t.prepareHist}, {"commit", &t.commitHist}} {
+		if leg.h.Count() == 0 {
+			continue
+		}
+		fmt.Printf("     %s latency: p50 %v | p90 %v | p99 %v | max %v\n", leg.name,
+			leg.h.Quantile(0.50).Round(time.Microsecond), leg.h.Quantile(0.90).Round(time.Microsecond),
+			leg.h.Quantile(0.99).Round(time.Microsecond), leg.h.Max().Round(time.Microsecond))
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// maxDatagram is the largest UDP payload IPv4 can carry.
+const maxDatagram = 65507
+
+// checkUDPAddr reports whether addr is a host:port -transport udp can dial.
+func checkUDPAddr(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("%q has no valid port", addr)
+	}
+	return nil
+}
+
+// UDPSender writes each payload as one datagram, StatsD style, for
+// throughput tests that leave TCP and HTTP out of it. Nothing comes back, so
+// a send fails only when the write does: a datagram the collector drops or
+// never receives still counts as sent. Message.ContentType is dropped. A
+// socket the kernel reports closed is redialed by the embedded
+// ReconnectingSender.
+type UDPSender struct {
+	*ReconnectingSender
+	Addr string
+}
+
+// NewUDPSender dials lazily, on the first Send.
+func NewUDPSender(addr string, timeout time.Duration) *UDPSender {
+	dial := func(ctx context.Context) (Sender, error) {
+		d := net.Dialer{Timeout: timeout}
+		c, err := d.DialContext(ctx, "udp", addr)
+		if err != nil {
+			return nil, err
+		}
+		return &udpConn{conn: c}, nil
+	}
+	return &UDPSender{ReconnectingSender: NewReconnectingSender(dial), Addr: addr}
+}
+
+// Target is the collector address, used when reporting per-request results.
+func (s *UDPSender) Target() string { return "udp://" + s.Addr }
+
+// udpConn is one connected socket; writes on it are safe to share across
+// workers.
+type udpConn struct {
+	conn net.Conn
+}
+
+func (c *udpConn) Send(ctx context.Context, msg Message) error {
+	if len(msg.Body) > maxDatagram {
+		return fmt.Errorf("payload of %d bytes doesn't fit in a %d-byte datagram", len(msg.Body), maxDatagram)
+	}
+	atomic.AddUint64(&totalAttempts, 1)
+	if _, err := c.conn.Write(msg.Body); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	return nil
+}
+
+func (c *udpConn) Close() error { return c.conn.Close() }
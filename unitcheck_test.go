@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// unitField is one quantity every base format reports, each in its own
+// units. canon converts a format's value back to the raw units of Format 1
+// (see Config), e.g. W, Wh and tenths of a °C. tol is the most two formats
+// may differ once converted, from the rounding their units force, e.g.
+// Format 2's whole kWh.
+type unitField struct {
+	name  string
+	paths [numBaseFormats]string
+	canon [numBaseFormats]func(float64) float64
+	tol   float64
+}
+
+func asIs(v float64) float64 { return v }
+
+var unitFields = []unitField{
+	{"voltage", [numBaseFormats]string{"data.s1v", "data.voltage_input", "V", "readings.voltage_mv"},
+		[numBaseFormats]func(float64) float64{asIs, asIs, asIs, func(mv float64) float64 { return mv / 10 }}, 0},
+	{"power", [numBaseFormats]string{"data.total_output_power", "data.power_watts", "P", "readings.power_kw"},
+		[numBaseFormats]func(float64) float64{asIs, asIs, asIs, func(kw float64) float64 { return kw * 1000 }}, 1},
+	{"frequency", [numBaseFormats]string{"data.f", "data.freq_hz", "Hz", "readings.frequency_hz"},
+		[numBaseFormats]func(float64) float64{asIs, asIs, asIs, asIs}, 0},
+	{"today_energy", [numBaseFormats]string{"data.today_e", "data.energy_today_wh", "E_today", "readings.today_kwh"},
+		[numBaseFormats]func(float64) float64{asIs, asIs, asIs, func(kwh float64) float64 { return kwh * 1000 }}, 1},
+	{"total_energy", [numBaseFormats]string{"data.total_e", "data.energy_total_kwh", "E_total", "readings.total_kwh"},
+		[numBaseFormats]func(float64) float64{asIs, func(kwh float64) float64 { return kwh * 1000 }, asIs, func(kwh float64) float64 { return kwh * 1000 }}, 1000},
+	{"temperature", [numBaseFormats]string{"data.inv_temp", "data.temp_celsius", "temp", "readings.temp_f"},
+		[numBaseFormats]func(float64) float64{asIs, func(c float64) float64 { return c * 10 }, asIs, func(f float64) float64 { return (f - 32) * 5 / 9 * 10 }}, 10},
+}
+
+// TestUnitsAgree generates one record of each base format for the same
+// device under the same conditions, every range pinned to its midpoint so
+// no draw differs, converts each field back to Format 1's units and
+// fails on the fields whose formats disagree. It guards the unit
+// conversions in generateFormat against regressions.
+func TestUnitsAgree(t *testing.T) {
+	saved := cfg
+	defer func() { cfg = saved }()
+	for _, r := range []*Range{&cfg.VoltageRange, &cfg.PowerRange, &cfg.FrequencyRange,
+		&cfg.TodayEnergyRange, &cfg.TotalEnergyRange, &cfg.TemperatureRange} {
+		mid := (r.Min + r.Max) / 2
+		*r = Range{Min: mid, Max: mid}
+	}
+
+	var records [numBaseFormats]map[string]any
+	for f := range records {
+		var body []byte
+		switch p := GenerateFormat(f, rand.New(rand.NewSource(1)), testNow, 1).(type) {
+		case *Format1Payload:
+			body = marshalFormat1(p)
+		case *Format2Payload:
+			body = marshalFormat2(p)
+		case *Format3Payload:
+			body = marshalFormat3(p)
+		case *Format4Payload:
+			body = marshalFormat4(p)
+		}
+		if err := json.Unmarshal(body, &records[f]); err != nil {
+			t.Fatalf("format %d: %v", f+1, err)
+		}
+	}
+
+	for _, uf := range unitFields {
+		var vals [numBaseFormats]float64
+		lo, hi := math.Inf(1), math.Inf(-1)
+		for f, m := range records {
+			v, ok := getPath(m, uf.paths[f])
+			n, isNum := v.(float64)
+			if !ok || !isNum {
+				t.Fatalf("format %d has no number at %s", f+1, uf.paths[f])
+			}
+			vals[f] = uf.canon[f](n)
+			lo, hi = min(lo, vals[f]), max(hi, vals[f])
+		}
+		if hi-lo > uf.tol {
+			t.Errorf("%s disagrees across formats: %v in Format 1 units (spread %.1f, allowed %.0f)", uf.name, vals, hi-lo, uf.tol)
+		}
+	}
+}
+
+// Format 4's temp_f is converted from tenths of a °C, the raw unit every
+// other format starts from; 65.0 °C used to go out as 1202 °F.
+func TestFormat4TempFahrenheit(t *testing.T) {
+	for _, c := range []struct{ tenths, want int }{{650, 149}, {0, 32}, {1000, 212}, {-400, -40}} {
+		p := generateFormat(3, 1, testNow, PayloadMeta{}, reading{Temperature: c.tenths}).(*Format4Payload)
+		if got := p.Data.TempFahrenheit; got != c.want {
+			t.Errorf("%d tenths of a °C: temp_f %d, want %d", c.tenths, got, c.want)
+		}
+	}
+}
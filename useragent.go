@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// userAgentPool is the User-Agent strings requests carry (-user-agent,
+// -user-agent-file), one drawn per request, with how often each was sent.
+type userAgentPool struct {
+	agents []string
+	counts []uint64
+}
+
+func newUserAgentPool(agents []string) *userAgentPool {
+	return &userAgentPool{agents: agents, counts: make([]uint64, len(agents))}
+}
+
+// loadUserAgents reads one User-Agent per line, skipping blank lines and
+// # comments.
+func loadUserAgents(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var agents []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		agents = append(agents, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(agents) == 0 {
+		return nil, fmt.Errorf("%s: no user agents", path)
+	}
+	return agents, nil
+}
+
+func (p *userAgentPool) pick() string {
+	i := rng.Intn(len(p.agents))
+	atomic.AddUint64(&p.counts[i], 1)
+	return p.agents[i]
+}
+
+func (p *userAgentPool) printSummary() {
+	if len(p.agents) == 1 {
+		fmt.Printf("   User-Agent: %q on %d requests\n", p.agents[0], atomic.LoadUint64(&p.counts[0]))
+		return
+	}
+	var total uint64
+	for i := range p.counts {
+		total += atomic.LoadUint64(&p.counts[i])
+	}
+	fmt.Println("   User-Agents:")
+	for i, ua := range p.agents {
+		n := atomic.LoadUint64(&p.counts[i])
+		fmt.Printf("     %q: %d (%.1f%%)\n", ua, n, pct(n, total))
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebSocket totals (-transport ws): messages the server's socket accepted
+// and writes that failed, each of which drops the connection.
+var wsWritten, wsWriteFailures uint64
+
+// checkWSURL reports whether u is something -transport ws can dial.
+func checkWSURL(u string) error {
+	p, err := url.Parse(u)
+	if err != nil {
+		return err
+	}
+	if (p.Scheme != "ws" && p.Scheme != "wss") || p.Host == "" {
+		return fmt.Errorf("%q is not a ws:// or wss:// URL", u)
+	}
+	return nil
+}
+
+// WSSender streams every payload over one WebSocket, one JSON record per
+// text message (protobuf goes as binary). Workers hand their messages to
+// the connection's single writer goroutine, so the pool's concurrency
+// collapses onto one ordered stream, as a real gateway sees it. When the
+// connection drops, the embedded ReconnectingSender redials it with
+// backoff and resends the message that found it dead.
+type WSSender struct {
+	*ReconnectingSender
+	URL string
+}
+
+// NewWSSender connects lazily, on the first Send. header (X-Run-Id, -header,
+// -bearer-token) goes on the handshake; tlsConfig applies to wss:// URLs.
+func NewWSSender(u string, header http.Header, timeout time.Duration, tlsConfig *tls.Config) *WSSender {
+	dial := func(ctx context.Context) (Sender, error) {
+		d := websocket.Dialer{HandshakeTimeout: timeout, TLSClientConfig: tlsConfig}
+		c, resp, err := d.DialContext(ctx, u, header)
+		if err != nil {
+			if resp != nil {
+				return nil, fmt.Errorf("%s: handshake answered %s", u, resp.Status)
+			}
+			return nil, fmt.Errorf("%s: %w", u, err)
+		}
+		return newWSConn(c, timeout), nil
+	}
+	return &WSSender{ReconnectingSender: NewReconnectingSender(dial), URL: u}
+}
+
+// Target is the stream URL, used when reporting per-request results.
+func (s *WSSender) Target() string { return s.URL }
+
+// wsConn is one open WebSocket: a writer goroutine draining writes, and a
+// reader that handles control frames and notices the connection go.
+type wsConn struct {
+	conn    *websocket.Conn
+	timeout time.Duration
+	writes  chan wsWrite
+	dead    chan struct{} // closed once the connection is unusable
+	once    sync.Once
+}
+
+type wsWrite struct {
+	msg  Message
+	done chan error
+}
+
+func newWSConn(conn *websocket.Conn, timeout time.Duration) *wsConn {
+	c := &wsConn{conn: conn, timeout: timeout, writes: make(chan wsWrite), dead: make(chan struct{})}
+	go c.writeLoop()
+	go c.readLoop()
+	return c
+}
+
+func (c *wsConn) writeLoop() {
+	for {
+		select {
+		case w := <-c.writes:
+			typ := websocket.TextMessage
+			if !utf8.Valid(w.msg.Body) {
+				typ = websocket.BinaryMessage
+			}
+			c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+			err := c.conn.WriteMessage(typ, w.msg.Body)
+			if err != nil {
+				atomic.AddUint64(&wsWriteFailures, 1)
+				c.kill() // a failed write leaves the stream unusable
+				err = fmt.Errorf("write: %w: %v", ErrConnLost, err)
+			} else {
+				atomic.AddUint64(&wsWritten, 1)
+			}
+			w.done <- err
+		case <-c.dead:
+			return
+		}
+	}
+}
+
+// readLoop discards what the server sends; reading is what gets pings
+// answered and a close or reset noticed.
+func (c *wsConn) readLoop() {
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			c.kill()
+			return
+		}
+	}
+}
+
+func (c *wsConn) kill() {
+	c.once.Do(func() {
+		close(c.dead)
+		c.conn.Close()
+	})
+}
+
+func (c *wsConn) Send(ctx context.Context, msg Message) error {
+	atomic.AddUint64(&totalAttempts, 1)
+	w := wsWrite{msg: msg, done: make(chan error, 1)}
+	select {
+	case c.writes <- w:
+	case <-c.dead:
+		return fmt.Errorf("write: %w", ErrConnLost)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-w.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close says goodbye with a normal close frame before dropping the socket.
+func (c *wsConn) Close() error {
+	c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	c.kill()
+	return nil
+}
+
+func printWebSocket() {
+	fmt.Printf("   WebSocket: %d messages written | %d write failures | %d reconnects | Downtime: %v\n",
+		atomic.LoadUint64(&wsWritten), atomic.LoadUint64(&wsWriteFailures), atomic.LoadUint64(&totalReconnects),
+		time.Duration(atomic.LoadInt64(&totalDowntimeNs)).Round(time.Millisecond))
+}